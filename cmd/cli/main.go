@@ -9,6 +9,14 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "export" {
+		if err := cli.RunExport(os.Args[2:]); err != nil {
+			fmt.Printf("Error exporting playlist: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	p := tea.NewProgram(
 		cli.NewModel(),
 		tea.WithAltScreen(),
@@ -2,24 +2,55 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"regexp"
+	"strings"
 	"syscall"
 	"time"
 	"yokai/internal/anime"
+	"yokai/internal/auth"
 	"yokai/internal/config"
+	"yokai/internal/events"
+	"yokai/internal/feed"
+	"yokai/internal/graph"
 	"yokai/internal/handler"
+	"yokai/internal/health"
+	"yokai/internal/imageproxy"
+	"yokai/internal/jobs"
+	"yokai/internal/logging"
+	"yokai/internal/metrics"
+	"yokai/internal/progress"
+	"yokai/internal/settings"
+	"yokai/internal/storage"
+	"yokai/internal/users"
+	"yokai/internal/watchlist"
+	"yokai/internal/webhook"
 
 	"github.com/common-nighthawk/go-figure"
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
 )
 
 type Server struct {
-	config *config.Config
-	router *mux.Router
-	server *http.Server
+	config     *config.Config
+	router     *mux.Router
+	server     *http.Server
+	broker     *events.Broker
+	poller     *events.Poller
+	dispatcher *webhook.Dispatcher
+	jobs       *jobs.Manager
+	db         *bolt.DB
+	watchlists *watchlist.Store
+	// middleware wraps the router, so it also sees unmatched routes
+	middleware handler.Chain
+	// metricsServer listens on MetricsAddr, when set
+	metricsServer *http.Server
 }
 
 func NewServer(config *config.Config) *Server {
@@ -29,32 +60,315 @@ func NewServer(config *config.Config) *Server {
 	}
 }
 
+// loggingMiddleware tags the request with the X-Request-ID sent by the
+// client, or a generated one, and logs its start and completion
 func (s *Server) loggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(logging.HeaderRequestID)
+		if !logging.ValidRequestID(requestID) {
+			requestID = logging.NewRequestID()
+		}
+		w.Header().Set(logging.HeaderRequestID, requestID)
+
+		ctx := logging.WithRequestID(r.Context(), requestID)
+		log := logging.FromContext(ctx).WithFields(logrus.Fields{
+			"method": r.Method,
+			"path":   r.URL.Path,
+		})
+
 		start := time.Now()
-		logrus.Infof("Started %s %s", r.Method, r.URL.Path)
+		log.Info("Started request")
+		next.ServeHTTP(w, r.WithContext(ctx))
+		log.WithField("duration_ms", time.Since(start).Milliseconds()).Info("Completed request")
+	})
+}
+
+// routeVariable matches the {name} variables of a successor route
+var routeVariable = regexp.MustCompile(`\{(\w+)\}`)
+
+// deprecated marks a route as superseded by the successor route template.
+// Its variables are filled from the query string of the request, which
+// carries the query parameters left over.
+func deprecated(successor string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		if link, ok := successorURL(successor, r.URL.Query()); ok {
+			w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", link))
+		}
 		next.ServeHTTP(w, r)
-		logrus.Infof("Completed %s in %v", r.URL.Path, time.Since(start))
 	})
 }
 
+// successorURL fills the variables of a successor route template from
+// query, false when the request lacks one of them
+func successorURL(template string, query url.Values) (string, bool) {
+	path, rawQuery, _ := strings.Cut(template, "?")
+
+	missing := false
+	fill := func(part string, escape func(string) string) string {
+		return routeVariable.ReplaceAllStringFunc(part, func(variable string) string {
+			name := routeVariable.FindStringSubmatch(variable)[1]
+			value := query.Get(name)
+			if value == "" {
+				missing = true
+			}
+			query.Del(name)
+			return escape(value)
+		})
+	}
+
+	path = fill(path, url.PathEscape)
+	rawQuery = fill(rawQuery, url.QueryEscape)
+	if missing {
+		return "", false
+	}
+
+	if rest := query.Encode(); rest != "" {
+		if rawQuery != "" {
+			rawQuery += "&"
+		}
+		rawQuery += rest
+	}
+	if rawQuery != "" {
+		path += "?" + rawQuery
+	}
+	return path, true
+}
+
 func (s *Server) setupRoutes() {
 	scraper := &anime.Jkanime{}
-	handler := handler.NewHandler(*scraper)
+	ranking := anime.NewRanking(filepath.Join(s.config.DataDir, "ranking.json"))
+	images := imageproxy.New(filepath.Join(s.config.CacheDir, "images"), s.config.ImageAllowedHosts)
+
+	schema, err := graph.NewSchema(*scraper)
+	if err != nil {
+		logrus.Fatal("Error building GraphQL schema:", err)
+	}
+	graphQL := handler.NewGraphQLHandler(schema, s.config.GraphQLMaxComplexity)
+
+	s.broker = events.NewBroker(s.config.EventsBufferSize)
+	s.poller = events.NewPoller(*scraper, s.config.PollInterval, s.broker)
+	eventsHandler := handler.NewEventsHandler(s.broker)
+
+	webhooks, err := webhook.NewStore(filepath.Join(s.config.DataDir, "webhooks.json"))
+	if err != nil {
+		logrus.Fatal("Error loading webhooks:", err)
+	}
+	s.dispatcher = webhook.NewDispatcher(webhooks, s.config.WebhookMaxAttempts, s.config.WebhookBackoff)
+	webhookHandler := handler.NewWebhookHandler(webhooks)
+	feedHandler := handler.NewFeedHandler(*scraper, feed.NewTracker(filepath.Join(s.config.DataDir, "feed.json")))
+	s.jobs = jobs.NewManager(s.config.JobWorkers, s.config.JobQueueSize, s.config.JobTTL)
+	jobsHandler := handler.NewJobsHandler(s.jobs, *scraper, ranking)
+
+	s.db, err = storage.Open(databasePath(s.config))
+	if err != nil {
+		logrus.Fatal("Error opening database:", err)
+	}
+	progressStore, err := progress.NewStore(s.db)
+	if err != nil {
+		logrus.Fatal("Error opening progress store:", err)
+	}
+	accounts, err := users.NewStore(s.db)
+	if err != nil {
+		logrus.Fatal("Error opening user store:", err)
+	}
+	if err := accounts.ExpireSessions(); err != nil {
+		logrus.Warnf("Error expiring sessions: %v", err)
+	}
+	accountHandler := handler.NewAccountHandler(accounts, s.config.SessionTTL)
+	s.watchlists, err = watchlist.NewStore(s.db)
+	if err != nil {
+		logrus.Fatal("Error opening watchlist store:", err)
+	}
+	watchlistHandler := handler.NewWatchlistHandler(s.watchlists, *scraper, s.poller)
+	progressHandler := handler.NewProgressHandler(progressStore, s.watchlists, s.poller)
+	runtimeSettings, err := settings.NewStore(s.db)
+	if err != nil {
+		logrus.Fatal("Error opening settings store:", err)
+	}
+	// Changes made through the admin API outlive restarts
+	saved, err := runtimeSettings.Load()
+	if err == nil {
+		err = saved.Apply()
+	}
+	if err != nil {
+		logrus.Warnf("Error applying saved settings: %v", err)
+	}
+	adminHandler := handler.NewAdminHandler(runtimeSettings, ranking, images)
+
+	guard := auth.NewGuard(
+		auth.ParseKeys(s.config.APIKeys),
+		map[auth.Class]auth.Limit{
+			auth.Cheap:     {PerMinute: s.config.RateLimitCheap},
+			auth.Expensive: {PerMinute: s.config.RateLimitExpensive},
+		},
+	)
+	guard.UseSessions(accounts.Resolve)
+	if err := guard.UseAdmins(s.config.Admins); err != nil {
+		logrus.Fatal("Error configuring admins:", err)
+	}
+	if err := guard.UseTrustedProxies(s.config.TrustedProxies); err != nil {
+		logrus.Fatal("Error configuring trusted proxies:", err)
+	}
+	authHandler := handler.NewAuthHandler(guard)
+	handler.UsePrivateCache(guard.Enabled())
+	handler.TrustForwardedHeaders(guard.FromTrustedProxy)
+
+	checker := health.NewChecker(s.config.ReadyTimeout, s.config.ReadyCacheTTL)
+	checker.Add("chromium", anime.CheckBrowser)
+	checker.Add("upstream", anime.CheckUpstream)
+	checker.Add("cache", health.WritableDir(filepath.Join(s.config.CacheDir, "images")))
+	checker.Add("storage", health.WritableDir(s.config.DataDir))
+	healthHandler := handler.NewHealthHandler(checker)
+
+	// Middlewares around the router, each can be turned off in the config
+	s.middleware = handler.NewChain(handler.Middleware{Name: "logging", Wrap: s.loggingMiddleware})
+	if s.config.RecoverPanics {
+		s.middleware = s.middleware.With(handler.Recover())
+	}
+	if len(s.config.CORSAllowedOrigins) > 0 {
+		s.middleware = s.middleware.With(handler.CORS(s.config.CORSAllowedOrigins, s.config.CORSAllowedMethods, s.config.CORSAllowedHeaders))
+	}
+
+	// Middlewares of the matched routes, routes opt out of them by name
+	routes := handler.NewChain()
+	if s.config.Compression {
+		routes = routes.With(handler.Compress())
+	}
+	if s.config.MaxBodyBytes > 0 {
+		routes = routes.With(handler.MaxBytes(int64(s.config.MaxBodyBytes)))
+	}
+	if s.config.RequestTimeout > 0 {
+		routes = routes.With(handler.Timeout(s.config.RequestTimeout))
+	}
+	// Event streams stay open and flush every event, the timeout and
+	// compression would buffer them
+	streaming := routes.Without(handler.MiddlewareTimeout, handler.MiddlewareCompress)
+
+	handler := handler.NewHandler(*scraper, ranking, images)
+
+	// Every route is authenticated and limited by how much upstream work it does
+	cheap := func(next http.HandlerFunc) http.Handler {
+		return routes.Then(authHandler.Require(auth.Cheap)(next))
+	}
+	expensive := func(next http.HandlerFunc) http.Handler {
+		return routes.Then(authHandler.Require(auth.Expensive)(next))
+	}
+	admin := func(next http.HandlerFunc) http.Handler {
+		return routes.Then(authHandler.Require(auth.Cheap)(authHandler.RequireAdmin(next)))
+	}
+	// Progress and watchlists belong to user accounts, not keys or addresses
+	user := func(next http.HandlerFunc) http.Handler {
+		return routes.Then(authHandler.Require(auth.Cheap)(authHandler.RequireUser(next)))
+	}
+	// Following an anime scrapes its episodes
+	expensiveUser := func(next http.HandlerFunc) http.Handler {
+		return routes.Then(authHandler.Require(auth.Expensive)(authHandler.RequireUser(next)))
+	}
+
+	s.router.Use(metrics.Middleware)
+	s.router.NotFoundHandler = http.HandlerFunc(handler.NotFound)
+	s.router.MethodNotAllowedHandler = http.HandlerFunc(handler.MethodNotAllowed)
 
 	apiRouter := s.router.PathPrefix("/api").Subrouter()
 
-	apiRouter.HandleFunc("/latest", handler.GetLatestEpisodes).Methods("GET")
-	apiRouter.HandleFunc("/anime", handler.GetAnime).Methods("GET")
-	apiRouter.HandleFunc("/episodes", handler.GetEpisodes).Methods("GET")
-	apiRouter.HandleFunc("/servers", handler.GetServers).Methods("GET")
-	apiRouter.HandleFunc("/play", handler.PlayStreaming).Methods("GET")
-	apiRouter.HandleFunc("/search", handler.GetSearch).Methods("GET")
-
-	s.router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("Welcome to Yokai API!"))
-	}).Methods("GET")
+	v1 := apiRouter.PathPrefix("/v1").Subrouter()
+	v1.Handle("/latest", cheap(handler.GetLatestEpisodes)).Methods("GET")
+	v1.Handle("/search", cheap(handler.GetSearch)).Methods("GET")
+	v1.Handle("/anime/{slug}", cheap(handler.GetAnime)).Methods("GET")
+	v1.Handle("/anime/{slug}/playlist.m3u8", expensive(handler.GetPlaylist)).Methods("GET")
+	v1.Handle("/anime/{slug}/episodes", expensive(handler.GetEpisodes)).Methods("GET")
+	v1.Handle("/anime/{slug}/episodes/{episode:[0-9]+}/servers", expensive(handler.GetServers)).Methods("GET")
+	v1.Handle("/anime/{slug}/episodes/{episode:[0-9]+}/play", expensive(handler.StreamEpisode)).Methods("GET")
+	v1.Handle("/play", expensive(handler.PlayStreaming)).Methods("GET")
+	v1.Handle("/image", cheap(handler.GetImage)).Methods("GET")
+	v1.Handle("/webhooks", cheap(webhookHandler.ListWebhooks)).Methods("GET")
+	v1.Handle("/webhooks", cheap(webhookHandler.CreateWebhook)).Methods("POST")
+	v1.Handle("/webhooks/{id}", cheap(webhookHandler.GetWebhook)).Methods("GET")
+	v1.Handle("/webhooks/{id}", cheap(webhookHandler.DeleteWebhook)).Methods("DELETE")
+	v1.Handle("/webhooks/{id}/deliveries", cheap(webhookHandler.GetDeliveries)).Methods("GET")
+	v1.Handle("/usage", cheap(authHandler.GetUsage)).Methods("GET")
+
+	apiRouter.Handle("/graphql", expensive(graphQL.ServeHTTP)).Methods("GET", "POST")
+	apiRouter.Handle("/events", streaming.Then(authHandler.Require(auth.Cheap)(eventsHandler))).Methods("GET")
+	apiRouter.Handle("/jobs", expensive(jobsHandler.CreateJob)).Methods("POST")
+	apiRouter.Handle("/jobs/{id}", cheap(jobsHandler.GetJob)).Methods("GET")
+	apiRouter.Handle("/jobs/{id}", cheap(jobsHandler.CancelJob)).Methods("DELETE")
+	apiRouter.Handle("/jobs/{id}/events", streaming.Then(authHandler.Require(auth.Cheap)(http.HandlerFunc(jobsHandler.GetJobEvents)))).Methods("GET")
+
+	// Logging in is open to anyone, limited like a browser route to slow down guessing
+	apiRouter.Handle("/auth/login", routes.Then(authHandler.Limit(auth.Expensive)(http.HandlerFunc(accountHandler.Login)))).Methods("POST")
+	apiRouter.Handle("/auth/logout", cheap(accountHandler.Logout)).Methods("POST")
+
+	// Account, watch state and lists of the calling client
+	apiRouter.Handle("/me", cheap(accountHandler.GetMe)).Methods("GET")
+	me := apiRouter.PathPrefix("/me").Subrouter()
+	me.Handle("/progress", user(progressHandler.ListProgress)).Methods("GET")
+	me.Handle("/progress/{slug}", user(progressHandler.GetProgress)).Methods("GET")
+	me.Handle("/progress/{slug}", user(progressHandler.DeleteProgress)).Methods("DELETE")
+	me.Handle("/progress/{slug}/episodes/{episode:[0-9]+}", user(progressHandler.SaveProgress)).Methods("PUT")
+	me.Handle("/history", user(progressHandler.GetHistory)).Methods("GET")
+	me.Handle("/watchlist", user(watchlistHandler.ListWatchlist)).Methods("GET")
+	me.Handle("/watchlist/{slug}", user(watchlistHandler.GetWatchlistItem)).Methods("GET")
+	me.Handle("/watchlist/{slug}", expensiveUser(watchlistHandler.PutWatchlistItem)).Methods("PUT")
+	me.Handle("/watchlist/{slug}", user(watchlistHandler.DeleteWatchlistItem)).Methods("DELETE")
+
+	// Runtime settings, only for the identities listed in ADMINS
+	adminRouter := apiRouter.PathPrefix("/admin").Subrouter()
+	adminRouter.Handle("/servers", admin(adminHandler.ListServers)).Methods("GET")
+	adminRouter.Handle("/servers/{name}", admin(adminHandler.PutServer)).Methods("PUT")
+	adminRouter.Handle("/providers", admin(adminHandler.ListProviders)).Methods("GET")
+	adminRouter.Handle("/providers/{name}", admin(adminHandler.PutProvider)).Methods("PUT")
+	adminRouter.Handle("/browsers", admin(adminHandler.GetBrowsers)).Methods("GET")
+	adminRouter.Handle("/log-level", admin(adminHandler.GetLogLevel)).Methods("GET")
+	adminRouter.Handle("/log-level", admin(adminHandler.PutLogLevel)).Methods("PUT")
+	adminRouter.Handle("/cache/purge", admin(adminHandler.PurgeCache)).Methods("POST")
+	adminRouter.Handle("/users", admin(accountHandler.CreateUser)).Methods("POST")
+
+	apiRouter.Handle("/openapi.json", routes.ThenFunc(handler.GetOpenAPI)).Methods("GET")
+	apiRouter.Handle("/docs", routes.ThenFunc(handler.GetDocs)).Methods("GET")
+	apiRouter.Handle("/docs/{file}", routes.ThenFunc(handler.GetDocsAsset)).Methods("GET")
+
+	// Query string routes kept as deprecated aliases of the v1 routes
+	apiRouter.Handle("/latest", deprecated("/api/v1/latest", cheap(handler.GetLatestEpisodes))).Methods("GET")
+	apiRouter.Handle("/anime", deprecated("/api/v1/anime/{slug}", cheap(handler.GetAnime))).Methods("GET")
+	apiRouter.Handle("/episodes", deprecated("/api/v1/anime/{slug}/episodes", expensive(handler.GetEpisodes))).Methods("GET")
+	apiRouter.Handle("/servers", deprecated("/api/v1/anime/{slug}/episodes/{episode}/servers", expensive(handler.GetServers))).Methods("GET")
+	apiRouter.Handle("/play", deprecated("/api/v1/play?remote={slug}", expensive(handler.PlayStreaming))).Methods("GET")
+	apiRouter.Handle("/search", deprecated("/api/v1/search", cheap(handler.GetSearch))).Methods("GET")
+	apiRouter.Handle("/playlist.m3u8", deprecated("/api/v1/anime/{slug}/playlist.m3u8", expensive(handler.GetPlaylist))).Methods("GET")
+	apiRouter.Handle("/stream", deprecated("/api/v1/anime/{slug}/episodes/{episode}/play", expensive(handler.StreamEpisode))).Methods("GET")
+	apiRouter.Handle("/image", deprecated("/api/v1/image", cheap(handler.GetImage))).Methods("GET")
+
+	feedRouter := s.router.PathPrefix("/feed").Subrouter()
+	feedRouter.Handle("/latest.xml", cheap(feedHandler.GetLatestFeed)).Methods("GET")
+	feedRouter.Handle("/anime/{slug}.xml", expensive(feedHandler.GetAnimeFeed)).Methods("GET")
+
+	// Metrics tell what's scraped and by how many clients, keep them private
+	if s.config.MetricsAddr == "" {
+		s.router.Handle("/metrics", admin(metrics.Handler().ServeHTTP)).Methods("GET")
+	} else {
+		metricsRouter := http.NewServeMux()
+		metricsRouter.Handle("GET /metrics", metrics.Handler())
+		s.metricsServer = &http.Server{
+			Addr:         s.config.MetricsAddr,
+			Handler:      metricsRouter,
+			ReadTimeout:  10 * time.Second,
+			WriteTimeout: 10 * time.Second,
+		}
+	}
+	s.router.HandleFunc("/healthz", healthHandler.Healthz).Methods("GET")
+	s.router.HandleFunc("/readyz", healthHandler.Readyz).Methods("GET")
+
+	// Web UI, rendered from the same scraper calls as the API
+	s.router.PathPrefix("/static/").Handler(routes.ThenFunc(handler.GetStatic)).Methods("GET", "HEAD")
+	s.router.Handle("/", cheap(handler.WebLatest)).Methods("GET")
+	s.router.Handle("/login", routes.Then(authHandler.Limit(auth.Cheap)(http.HandlerFunc(accountHandler.WebLogin)))).Methods("GET")
+	s.router.Handle("/login", routes.Then(authHandler.Limit(auth.Expensive)(http.HandlerFunc(accountHandler.WebLoginSubmit)))).Methods("POST")
+	s.router.Handle("/logout", routes.ThenFunc(accountHandler.WebLogout)).Methods("POST")
+	s.router.Handle("/search", cheap(handler.WebSearch)).Methods("GET")
+	s.router.Handle("/anime/{slug}", expensive(handler.WebAnime)).Methods("GET")
+	s.router.Handle("/anime/{slug}/episodes/{episode:[0-9]+}", expensive(handler.WebWatch)).Methods("GET")
 }
 
 func (s *Server) Run() error {
@@ -62,11 +376,26 @@ func (s *Server) Run() error {
 
 	s.server = &http.Server{
 		Addr:         ":" + s.config.Port,
-		Handler:      s.loggingMiddleware(s.router),
+		Handler:      s.middleware.Then(s.router),
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 10 * time.Second,
 	}
 
+	defer s.db.Close()
+
+	background, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+
+	if s.config.PollInterval > 0 {
+		go s.poller.Run(background)
+	}
+	go s.dispatcher.Run(background, s.broker)
+	go s.watchlists.Follow(background, s.broker)
+	go s.jobs.Run(background)
+
+	// Event streams never finish on their own, end them so Shutdown can complete
+	s.server.RegisterOnShutdown(s.broker.Close)
+
 	// Graceful shutdown
 	go func() {
 		stop := make(chan os.Signal, 1)
@@ -77,11 +406,23 @@ func (s *Server) Run() error {
 		defer cancel()
 
 		logrus.Info("Shutting down server...")
+		if s.metricsServer != nil {
+			s.metricsServer.Shutdown(ctx)
+		}
 		if err := s.server.Shutdown(ctx); err != nil {
 			logrus.Error("Server shutdown error:", err)
 		}
 	}()
 
+	if s.metricsServer != nil {
+		go func() {
+			logrus.Infof("Metrics served on %s", s.metricsServer.Addr)
+			if err := s.metricsServer.ListenAndServe(); err != http.ErrServerClosed {
+				logrus.Fatal("Error serving metrics:", err)
+			}
+		}()
+	}
+
 	logrus.Infof("Server running on port %s", s.config.Port)
 	if err := s.server.ListenAndServe(); err != http.ErrServerClosed {
 		return err
@@ -91,10 +432,23 @@ func (s *Server) Run() error {
 }
 
 func main() {
+	cfg := config.New()
+
+	if len(os.Args) > 1 && os.Args[1] == "useradd" {
+		if err := userAdd(cfg, os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, "Error adding user:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	goFigure := figure.NewColorFigure("Okarun", "", "Red", true)
 	goFigure.Print()
 
-	cfg := config.New()
+	if err := logging.Setup(cfg.Environment, cfg.LogLevel); err != nil {
+		logrus.Warnf("Invalid LOG_LEVEL %q, using info: %v", cfg.LogLevel, err)
+	}
+
 	server := NewServer(cfg)
 
 	if err := server.Run(); err != nil {
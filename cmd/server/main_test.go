@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"yokai/internal/config"
+	"yokai/internal/handler"
+
+	"github.com/gorilla/mux"
+)
+
+// routePattern matches the regular expression of a mux route variable
+var routePattern = regexp.MustCompile(`\{(\w+):[^}]+\}`)
+
+func TestOpenAPISpecCoversRoutes(t *testing.T) {
+	var spec struct {
+		Paths map[string]map[string]any `json:"paths"`
+	}
+	if err := json.Unmarshal(handler.OpenAPISpec(), &spec); err != nil {
+		t.Fatalf("invalid OpenAPI document: %v", err)
+	}
+
+	server := NewServer(&config.Config{DataDir: t.TempDir(), CacheDir: t.TempDir()})
+	server.setupRoutes()
+
+	err := server.router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil || !strings.HasPrefix(path, "/api/") {
+			return nil
+		}
+		path = routePattern.ReplaceAllString(path, "{$1}")
+
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+
+		operations, ok := spec.Paths[path]
+		if !ok {
+			t.Errorf("route %s is missing from the OpenAPI document", path)
+			return nil
+		}
+
+		for _, method := range methods {
+			if _, ok := operations[strings.ToLower(method)]; !ok {
+				t.Errorf("route %s %s is missing from the OpenAPI document", method, path)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSuccessorURL(t *testing.T) {
+	tests := []struct {
+		template string
+		query    string
+		want     string
+		ok       bool
+	}{
+		{"/api/v1/latest", "", "/api/v1/latest", true},
+		{"/api/v1/anime/{slug}", "slug=one-piece", "/api/v1/anime/one-piece", true},
+		{"/api/v1/anime/{slug}/episodes", "slug=one-piece&page=2", "/api/v1/anime/one-piece/episodes?page=2", true},
+		{"/api/v1/anime/{slug}/episodes/{episode}/servers", "slug=a%2Fb&episode=3", "/api/v1/anime/a%2Fb/episodes/3/servers", true},
+		{"/api/v1/play?remote={slug}", "server=Streamwish&slug=aHR0cA%3D%3D", "/api/v1/play?remote=aHR0cA%3D%3D&server=Streamwish", true},
+		{"/api/v1/search", "name=naruto", "/api/v1/search?name=naruto", true},
+		{"/api/v1/anime/{slug}", "", "", false},
+	}
+
+	for _, tt := range tests {
+		query, _ := url.ParseQuery(tt.query)
+		got, ok := successorURL(tt.template, query)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("successorURL(%q, %q) = %q, %v, want %q, %v", tt.template, tt.query, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"yokai/internal/config"
+	"yokai/internal/storage"
+	"yokai/internal/users"
+
+	"golang.org/x/term"
+)
+
+// databasePath is where the server keeps users, progress and watchlists
+func databasePath(cfg *config.Config) string {
+	return filepath.Join(cfg.DataDir, "okarun.db")
+}
+
+// userAdd creates a user from the command line:
+//
+//	server useradd [-password-stdin] <username>
+//
+// The password is prompted for, or read from the first line of stdin with
+// -password-stdin for scripts. The database is locked while the server
+// runs, so it has to be stopped first.
+func userAdd(cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("useradd", flag.ContinueOnError)
+	passwordStdin := flags.Bool("password-stdin", false, "read the password from stdin")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: server useradd [-password-stdin] <username>")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("a username is required")
+	}
+	username := flags.Arg(0)
+
+	var password string
+	var err error
+	if *passwordStdin {
+		password, err = readLine(os.Stdin)
+	} else {
+		password, err = promptPassword()
+	}
+	if err != nil {
+		return err
+	}
+
+	db, err := storage.Open(databasePath(cfg))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	accounts, err := users.NewStore(db)
+	if err != nil {
+		return err
+	}
+
+	user, err := accounts.Create(username, password)
+	if errors.Is(err, users.ErrWeakPassword) {
+		return fmt.Errorf("%w, use at least %d characters", err, users.MinPasswordLength)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Created user %s\n", user.Username)
+	return nil
+}
+
+// promptPassword asks for the password twice without echoing it
+func promptPassword() (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", errors.New("stdin is not a terminal, use -password-stdin")
+	}
+
+	fmt.Print("Password: ")
+	password, err := term.ReadPassword(fd)
+	fmt.Println()
+	if err != nil {
+		return "", err
+	}
+
+	fmt.Print("Repeat password: ")
+	repeated, err := term.ReadPassword(fd)
+	fmt.Println()
+	if err != nil {
+		return "", err
+	}
+
+	if string(password) != string(repeated) {
+		return "", errors.New("passwords don't match")
+	}
+	return string(password), nil
+}
+
+func readLine(r io.Reader) (string, error) {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
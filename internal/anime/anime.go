@@ -6,24 +6,65 @@ import (
 	"errors"
 	"fmt"
 	"net/url"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
+	"yokai/internal/logging"
+	"yokai/internal/metrics"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/chromedp/chromedp"
 	"github.com/gocolly/colly/v2"
+	"github.com/sirupsen/logrus"
 )
 
-type Jkanime struct{}
+type Jkanime struct {
+	ctx context.Context
+}
+
+// WithContext returns a copy of the scraper bound to ctx. Cancelling ctx
+// stops its requests and browsers, and its request ID tags the scraper logs.
+func (j Jkanime) WithContext(ctx context.Context) Jkanime {
+	j.ctx = ctx
+	return j
+}
+
+// Context returns the context the scraper is bound to
+func (j Jkanime) Context() context.Context {
+	if j.ctx == nil {
+		return context.Background()
+	}
+	return j.ctx
+}
+
+func (j Jkanime) log() *logrus.Entry {
+	return logging.FromContext(j.Context())
+}
+
+// ErrUnsupportedServer is returned for stream servers without an extractor
+var ErrUnsupportedServer = errors.New("unsupported server")
 
 func (j Jkanime) GetLatestEpisodes() ([]LatestEpisode, error) {
-	var episodes []LatestEpisode
+	if err := checkProvider(); err != nil {
+		return nil, err
+	}
+
+	return coalesce(j.Context(), "GetLatestEpisodes", slices.Clone, func(ctx context.Context) ([]LatestEpisode, error) {
+		return j.WithContext(ctx).scrapeLatestEpisodes()
+	})
+}
+
+func (j Jkanime) scrapeLatestEpisodes() (episodes []LatestEpisode, err error) {
+	defer j.observe("GetLatestEpisodes", jkanimeHost, time.Now(), &err)
 
 	c := colly.NewCollector(
 		colly.UserAgent("Mozilla/5.0 (Windows NT 10.0; Win64; x64)..."),
 		colly.Async(true),
+		colly.StdlibContext(j.Context()),
 	)
 	c.Limit(&colly.LimitRule{Parallelism: 5, Delay: 500 * time.Millisecond})
+	observeCollector(c)
 
 	c.OnHTML("#animes .card a", func(e *colly.HTMLElement) {
 		slug := strings.Split(e.Attr("href"), "/")[3]
@@ -44,7 +85,7 @@ func (j Jkanime) GetLatestEpisodes() ([]LatestEpisode, error) {
 		})
 	})
 
-	err := c.Visit("https://jkanime.net/")
+	err = c.Visit("https://jkanime.net/")
 	if err != nil {
 		return nil, err
 	}
@@ -54,17 +95,31 @@ func (j Jkanime) GetLatestEpisodes() ([]LatestEpisode, error) {
 }
 
 func (j Jkanime) GetAnime(slug string) (*Anime, error) {
+	if err := checkProvider(); err != nil {
+		return nil, err
+	}
+
+	return coalesce(j.Context(), "GetAnime", cloneAnime, func(ctx context.Context) (*Anime, error) {
+		return j.WithContext(ctx).scrapeAnime(slug)
+	}, slug)
+}
+
+func (j Jkanime) scrapeAnime(slug string) (anime *Anime, err error) {
+	defer j.observe("GetAnime", jkanimeHost, time.Now(), &err)
+
 	if slug == "" {
 		return nil, errors.New("slug cannot be empty")
 	}
 
-	anime := &Anime{
+	anime = &Anime{
 		AdditionalInfo: make(map[string]interface{}),
 	}
 
 	c := colly.NewCollector(
 		colly.UserAgent("Mozilla/5.0 (Windows NT 10.0; Win64; x64)..."),
+		colly.StdlibContext(j.Context()),
 	)
+	observeCollector(c)
 
 	// Título
 	c.OnHTML(".anime_info h3", func(e *colly.HTMLElement) {
@@ -108,7 +163,7 @@ func (j Jkanime) GetAnime(slug string) (*Anime, error) {
 		}
 	})
 
-	err := c.Visit("https://jkanime.net/" + slug)
+	err = c.Visit("https://jkanime.net/" + slug)
 	if err != nil {
 		return nil, err
 	}
@@ -117,22 +172,23 @@ func (j Jkanime) GetAnime(slug string) (*Anime, error) {
 }
 
 func (j Jkanime) GetEpisodes(slug string, page int) (*Episode, error) {
+	if err := checkProvider(); err != nil {
+		return nil, err
+	}
+
+	return coalesce(j.Context(), "GetEpisodes", cloneEpisode, func(ctx context.Context) (*Episode, error) {
+		return j.WithContext(ctx).scrapeEpisodes(slug, page)
+	}, slug, strconv.Itoa(page))
+}
+
+func (j Jkanime) scrapeEpisodes(slug string, page int) (_ *Episode, err error) {
+	defer j.observe("GetEpisodes", jkanimeHost, time.Now(), &err)
 
 	if slug == "" {
 		return nil, errors.New("slug cannot be empty")
 	}
 
-	opts := append(chromedp.DefaultExecAllocatorOptions[:],
-		chromedp.Flag("headless", true),
-		chromedp.Flag("disable-gpu", true),
-		chromedp.Flag("no-sandbox", true),
-		chromedp.UserAgent("Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 Chrome/120.0.0.0 Safari/537.36"),
-	)
-
-	allocCtx, cancel := chromedp.NewExecAllocator(context.Background(), opts...)
-	defer cancel()
-
-	ctx, cancel := chromedp.NewContext(allocCtx)
+	ctx, cancel := newBrowser(j.Context(), "GetEpisodes")
 	defer cancel()
 
 	var episode Episode
@@ -149,8 +205,11 @@ func (j Jkanime) GetEpisodes(slug string, page int) (*Episode, error) {
 		url = fmt.Sprintf("https://jkanime.net/%s/#pag%d", slug, page)
 	}
 
-	err := chromedp.Run(ctx,
-		chromedp.Navigate(url),
+	if err := navigate(ctx, url); err != nil {
+		return nil, err
+	}
+
+	err = chromedp.Run(ctx,
 		chromedp.Sleep(1*time.Second),
 		chromedp.Evaluate(`
 			(() => ({
@@ -175,7 +234,26 @@ func (j Jkanime) GetEpisodes(slug string, page int) (*Episode, error) {
 	return &episode, nil
 }
 
+// GetServers returns the stream servers of an episode, leaving out the
+// disabled ones
 func (j Jkanime) GetServers(slug, episode string) ([]Server, error) {
+	if err := checkProvider(); err != nil {
+		return nil, err
+	}
+
+	servers, err := coalesce(j.Context(), "GetServers", slices.Clone, func(ctx context.Context) ([]Server, error) {
+		return j.WithContext(ctx).scrapeServers(slug, episode)
+	}, slug, episode)
+	if err != nil {
+		return nil, err
+	}
+
+	return enabledServers(servers), nil
+}
+
+func (j Jkanime) scrapeServers(slug, episode string) (_ []Server, err error) {
+	defer j.observe("GetServers", jkanimeHost, time.Now(), &err)
+
 	if slug == "" {
 		return nil, errors.New("slug cannot be empty")
 	}
@@ -184,23 +262,16 @@ func (j Jkanime) GetServers(slug, episode string) ([]Server, error) {
 		return nil, errors.New("episode cannot be empty")
 	}
 
-	opts := append(chromedp.DefaultExecAllocatorOptions[:],
-		chromedp.Flag("headless", true),
-		chromedp.Flag("disable-gpu", true),
-		chromedp.Flag("no-sandbox", true),
-		chromedp.UserAgent("Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 Chrome/120.0.0.0 Safari/537.36"),
-	)
-
-	allocCtx, cancel := chromedp.NewExecAllocator(context.Background(), opts...)
-	defer cancel()
-
-	ctx, cancel := chromedp.NewContext(allocCtx)
+	ctx, cancel := newBrowser(j.Context(), "GetServers")
 	defer cancel()
 
 	var servers []Server
 
-	err := chromedp.Run(ctx,
-		chromedp.Navigate(fmt.Sprintf("https://jkanime.net/%s/%s", slug, episode)),
+	if err := navigate(ctx, fmt.Sprintf("https://jkanime.net/%s/%s", slug, episode)); err != nil {
+		return nil, err
+	}
+
+	err = chromedp.Run(ctx,
 		chromedp.Evaluate(`(() => {
 			const desu = document.querySelector('#btn-show-0').textContent
 			const magi = document.querySelector('#btn-show-1').textContent
@@ -210,8 +281,6 @@ func (j Jkanime) GetServers(slug, episode string) ([]Server, error) {
 			return match ? match[1] : null;
 			});
 
-			const excludedServers = ['Mega', 'Mediafire', 'Mixdrop', 'Mp4upload', 'SaveFiles'];
-
 			let videos = [
 				{
 					server: desu,
@@ -224,9 +293,7 @@ func (j Jkanime) GetServers(slug, episode string) ([]Server, error) {
 				...servers
 			]
 
-			return videos
-				.filter(video => !excludedServers.includes(video.server))
-				.map(({ server, remote }) => ({ server, remote }));
+			return videos.map(({ server, remote }) => ({ server, remote }));
 		})()`, &servers),
 	)
 
@@ -237,7 +304,36 @@ func (j Jkanime) GetServers(slug, episode string) ([]Server, error) {
 	return servers, nil
 }
 
+// GetStreaming resolves the stream URL of a server and makes sure it is playable
 func (j Jkanime) GetStreaming(server, slug string) (string, error) {
+	if !ServerEnabled(server) {
+		return "", ErrServerDisabled
+	}
+
+	streaming, err := j.resolveStreaming(server, slug)
+	if err != nil {
+		return "", err
+	}
+
+	if status, err := Probe(j.Context(), streaming); status == StatusDead {
+		return "", err
+	}
+
+	return streaming, nil
+}
+
+func (j Jkanime) resolveStreaming(server, slug string) (string, error) {
+	return coalesce(j.Context(), "GetStreaming", same, func(ctx context.Context) (string, error) {
+		return j.WithContext(ctx).scrapeStreaming(server, slug)
+	}, server, slug)
+}
+
+func (j Jkanime) scrapeStreaming(server, slug string) (_ string, err error) {
+	host := "unknown"
+	defer func(start time.Time) {
+		j.observe("GetStreaming", host, start, &err)
+	}(time.Now())
+
 	if server == "" {
 		return "", errors.New("server cannot be empty")
 	}
@@ -253,22 +349,16 @@ func (j Jkanime) GetStreaming(server, slug string) (string, error) {
 
 	decodedStr, err := url.QueryUnescape(string(decoded))
 	if err != nil {
-		panic(err)
+		return "", err
 	}
 
-	fmt.Println("Decoded URL:", decodedStr)
-
-	opts := append(chromedp.DefaultExecAllocatorOptions[:],
-		chromedp.Flag("headless", true),
-		chromedp.Flag("disable-gpu", true),
-		chromedp.Flag("no-sandbox", true),
-		chromedp.UserAgent("Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 Chrome/120.0.0.0 Safari/537.36"),
-	)
-
-	allocCtx, cancel := chromedp.NewExecAllocator(context.Background(), opts...)
-	defer cancel()
+	host = metrics.Host(decodedStr)
+	j.log().WithFields(logrus.Fields{
+		"server": server,
+		"remote": logging.RedactURL(decodedStr),
+	}).Debug("Decoded remote URL")
 
-	ctx, cancel := chromedp.NewContext(allocCtx)
+	ctx, cancel := newBrowser(j.Context(), "GetStreaming")
 	defer cancel()
 
 	var script string
@@ -289,13 +379,16 @@ func (j Jkanime) GetStreaming(server, slug string) (string, error) {
 	case "Streamtape":
 		script = `player.source`
 	default:
-		return "", errors.New("unsupported server")
+		return "", ErrUnsupportedServer
 	}
 
 	var streaming string
 
+	if err := navigate(ctx, decodedStr); err != nil {
+		return "", err
+	}
+
 	err = chromedp.Run(ctx,
-		chromedp.Navigate(decodedStr),
 		chromedp.Evaluate(script, &streaming),
 	)
 
@@ -307,13 +400,43 @@ func (j Jkanime) GetStreaming(server, slug string) (string, error) {
 }
 
 func (j Jkanime) GetSearch(name string, page int) ([]Anime, error) {
+	result, err := j.GetSearchResults(name, page)
+	if err != nil {
+		return nil, err
+	}
+
+	return result.Results, nil
+}
+
+// GetSearchResults searches anime by name and reports whether more pages exist
+func (j Jkanime) GetSearchResults(name string, page int) (*SearchResult, error) {
+	if err := checkProvider(); err != nil {
+		return nil, err
+	}
+
+	return coalesce(j.Context(), "GetSearch", cloneSearchResult, func(ctx context.Context) (*SearchResult, error) {
+		return j.WithContext(ctx).scrapeSearch(name, page)
+	}, name, strconv.Itoa(page))
+}
+
+func (j Jkanime) scrapeSearch(name string, page int) (_ *SearchResult, err error) {
+	defer j.observe("GetSearch", jkanimeHost, time.Now(), &err)
+
 	if name == "" {
 		return nil, errors.New("name cannot be empty")
 	}
 
-	var results []Anime
+	if page < 1 {
+		page = 1
+	}
+
+	result := &SearchResult{
+		Results: []Anime{},
+		Page:    page,
+	}
 
-	c := colly.NewCollector()
+	c := colly.NewCollector(colly.StdlibContext(j.Context()))
+	observeCollector(c)
 
 	c.OnHTML(".anime__item", func(e *colly.HTMLElement) {
 		anime := Anime{
@@ -342,7 +465,21 @@ func (j Jkanime) GetSearch(name string, page int) ([]Anime, error) {
 			anime.AdditionalInfo["tipo"] = strings.TrimSpace(tipo)
 		}
 
-		results = append(results, anime)
+		result.Results = append(result.Results, anime)
+	})
+
+	// Any link to /buscar/{name}/{page+1} means there is a next page
+	nextPage := strconv.Itoa(page + 1)
+	c.OnHTML("a[href*='/buscar/']", func(e *colly.HTMLElement) {
+		u, err := url.Parse(e.Attr("href"))
+		if err != nil {
+			return
+		}
+
+		segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+		if len(segments) == 3 && segments[0] == "buscar" && segments[2] == nextPage {
+			result.HasNext = true
+		}
 	})
 
 	searchURL := fmt.Sprintf("https://jkanime.net/buscar/%s", url.PathEscape(name))
@@ -354,5 +491,5 @@ func (j Jkanime) GetSearch(name string, page int) ([]Anime, error) {
 		return nil, err
 	}
 
-	return results, nil
+	return result, nil
 }
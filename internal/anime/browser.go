@@ -0,0 +1,129 @@
+package anime
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+	"yokai/internal/metrics"
+
+	"github.com/chromedp/chromedp"
+	"github.com/gocolly/colly/v2"
+	"github.com/sirupsen/logrus"
+)
+
+// jkanimeHost labels the metrics of requests made to jkanime
+const jkanimeHost = "jkanime.net"
+
+var browserOptions = append(chromedp.DefaultExecAllocatorOptions[:],
+	chromedp.Flag("headless", true),
+	chromedp.Flag("disable-gpu", true),
+	chromedp.Flag("no-sandbox", true),
+	chromedp.UserAgent("Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 Chrome/120.0.0.0 Safari/537.36"),
+)
+
+// Browser is a headless browser the scraper is running
+type Browser struct {
+	ID        uint64    `json:"id"`
+	Task      string    `json:"task"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// BrowserStatus describes the headless browsers of the process
+type BrowserStatus struct {
+	Active int `json:"active"`
+	// Started counts every browser since the process started
+	Started  uint64    `json:"started"`
+	Browsers []Browser `json:"browsers"`
+}
+
+var (
+	browsersMu sync.Mutex
+	browsers   = map[uint64]Browser{}
+	started    uint64
+)
+
+// Browsers returns the running browsers, oldest first
+func Browsers() BrowserStatus {
+	browsersMu.Lock()
+	defer browsersMu.Unlock()
+
+	status := BrowserStatus{
+		Active:   len(browsers),
+		Started:  started,
+		Browsers: make([]Browser, 0, len(browsers)),
+	}
+	for _, browser := range browsers {
+		status.Browsers = append(status.Browsers, browser)
+	}
+	sort.Slice(status.Browsers, func(i, j int) bool {
+		return status.Browsers[i].ID < status.Browsers[j].ID
+	})
+
+	return status
+}
+
+// newBrowser starts a headless browser bound to parent for task and
+// returns a tab on it. The browser is closed and stops being counted as
+// active on the first cancel.
+func newBrowser(parent context.Context, task string) (context.Context, context.CancelFunc) {
+	allocCtx, cancelAlloc := chromedp.NewExecAllocator(parent, browserOptions...)
+	ctx, cancelTab := chromedp.NewContext(allocCtx)
+	done := metrics.BrowserStarted()
+
+	browsersMu.Lock()
+	started++
+	id := started
+	browsers[id] = Browser{ID: id, Task: task, StartedAt: time.Now().UTC()}
+	browsersMu.Unlock()
+
+	var once sync.Once
+	return ctx, func() {
+		once.Do(func() {
+			cancelTab()
+			cancelAlloc()
+			done()
+
+			browsersMu.Lock()
+			delete(browsers, id)
+			browsersMu.Unlock()
+		})
+	}
+}
+
+// navigate loads rawURL in the browser and records the status it answered with
+func navigate(ctx context.Context, rawURL string) error {
+	resp, err := chromedp.RunResponse(ctx, chromedp.Navigate(rawURL))
+	if resp != nil {
+		metrics.UpstreamResponse(metrics.Host(rawURL), int(resp.Status))
+	}
+	return err
+}
+
+// observeCollector records the status of every response a collector receives
+func observeCollector(c *colly.Collector) {
+	c.OnResponse(func(r *colly.Response) {
+		metrics.UpstreamResponse(r.Request.URL.Hostname(), r.StatusCode)
+	})
+	c.OnError(func(r *colly.Response, err error) {
+		if r.StatusCode != 0 {
+			metrics.UpstreamResponse(r.Request.URL.Hostname(), r.StatusCode)
+		}
+	})
+}
+
+// observe records and logs a scraper call once it returns, meant to be
+// deferred with the named error result of the call
+func (j Jkanime) observe(method, host string, start time.Time, err *error) {
+	metrics.ObserveScrape(method, host, start, *err)
+
+	entry := j.log().WithFields(logrus.Fields{
+		"method":      method,
+		"host":        host,
+		"duration_ms": time.Since(start).Milliseconds(),
+	})
+	if *err != nil {
+		entry = entry.WithError(*err)
+	}
+	entry.Debug("Scrape finished")
+}
@@ -0,0 +1,126 @@
+package anime
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"yokai/internal/metrics"
+)
+
+// flight is an upstream fetch shared by every concurrent caller asking
+// for the same thing
+type flight struct {
+	done    chan struct{}
+	val     any
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+var (
+	flightsMu sync.Mutex
+	flights   = map[string]*flight{}
+)
+
+// coalesce runs fetch once for concurrent calls of method with the same
+// args, every caller gets the result or the error. The fetch outlives the
+// caller that started it and is only cancelled once every caller is gone.
+// Callers get their own copy of the result through clone, since handlers
+// rewrite what they receive.
+func coalesce[T any](ctx context.Context, method string, clone func(T) T, fetch func(ctx context.Context) (T, error), args ...string) (T, error) {
+	key := method + "\x00" + strings.Join(args, "\x00")
+
+	flightsMu.Lock()
+	f, shared := flights[key]
+	if shared {
+		f.waiters++
+	} else {
+		// The request ID of the first caller keeps tagging the logs
+		fetchCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		f = &flight{done: make(chan struct{}), waiters: 1, cancel: cancel}
+		flights[key] = f
+
+		go func() {
+			defer func() {
+				// Nothing up the stack would recover a scraper panic here
+				if p := recover(); p != nil {
+					f.err = fmt.Errorf("%s panicked: %v", method, p)
+				}
+
+				flightsMu.Lock()
+				if flights[key] == f {
+					delete(flights, key)
+				}
+				flightsMu.Unlock()
+
+				cancel()
+				close(f.done)
+			}()
+
+			f.val, f.err = fetch(fetchCtx)
+		}()
+	}
+	flightsMu.Unlock()
+
+	if shared {
+		metrics.CoalescedScrape(method)
+	}
+
+	var zero T
+	select {
+	case <-f.done:
+		if f.err != nil {
+			return zero, f.err
+		}
+		return clone(f.val.(T)), nil
+	case <-ctx.Done():
+		flightsMu.Lock()
+		f.waiters--
+		if f.waiters == 0 {
+			f.cancel()
+			// Later callers start over instead of joining a cancelled fetch
+			if flights[key] == f {
+				delete(flights, key)
+			}
+		}
+		flightsMu.Unlock()
+		return zero, ctx.Err()
+	}
+}
+
+func cloneAnime(anime *Anime) *Anime {
+	if anime == nil {
+		return nil
+	}
+	cloned := *anime
+	cloned.AdditionalInfo = maps.Clone(anime.AdditionalInfo)
+	return &cloned
+}
+
+func cloneEpisode(episode *Episode) *Episode {
+	if episode == nil {
+		return nil
+	}
+	cloned := *episode
+	cloned.Episodes = slices.Clone(episode.Episodes)
+	return &cloned
+}
+
+func cloneSearchResult(result *SearchResult) *SearchResult {
+	if result == nil {
+		return nil
+	}
+	cloned := *result
+	cloned.Results = make([]Anime, len(result.Results))
+	for i, anime := range result.Results {
+		cloned.Results[i] = *cloneAnime(&anime)
+	}
+	return &cloned
+}
+
+func same[T any](v T) T {
+	return v
+}
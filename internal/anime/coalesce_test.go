@@ -0,0 +1,266 @@
+package anime
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// waitWaiters blocks until n callers share the fetch of method
+func waitWaiters(t *testing.T, method string, n int) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		flightsMu.Lock()
+		f := flights[method+"\x00slug"]
+		waiters := 0
+		if f != nil {
+			waiters = f.waiters
+		}
+		flightsMu.Unlock()
+
+		if waiters == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("%s: never got %d waiters", method, n)
+}
+
+// coalescedCount reads scrape_coalesced_total for method
+func coalescedCount(t *testing.T, method string) float64 {
+	t.Helper()
+
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() != "okarun_scrape_coalesced_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "method" && label.GetValue() == method {
+					return metric.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	return 0
+}
+
+func TestCoalesceSharesOneFetch(t *testing.T) {
+	const method, callers = "TestShared", 10
+
+	var fetches atomic.Int32
+	release := make(chan struct{})
+	fetch := func(ctx context.Context) (int, error) {
+		fetches.Add(1)
+		<-release
+		return 42, nil
+	}
+
+	before := coalescedCount(t, method)
+	var wg sync.WaitGroup
+	results := make([]int, callers)
+	errs := make([]error, callers)
+	for i := range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = coalesce(context.Background(), method, same[int], fetch, "slug")
+		}()
+	}
+	waitWaiters(t, method, callers)
+	close(release)
+	wg.Wait()
+
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("fetched %d times, want 1", n)
+	}
+	for i := range callers {
+		if results[i] != 42 || errs[i] != nil {
+			t.Errorf("caller %d got %d, %v, want 42", i, results[i], errs[i])
+		}
+	}
+	if n := coalescedCount(t, method) - before; n != callers-1 {
+		t.Errorf("scrape_coalesced_total = %v, want %d", n, callers-1)
+	}
+
+	// Once done, the next call fetches again
+	release = make(chan struct{})
+	close(release)
+	coalesce(context.Background(), method, same[int], fetch, "slug")
+	if n := fetches.Load(); n != 2 {
+		t.Errorf("fetched %d times after the first fetch ended, want 2", n)
+	}
+}
+
+func TestCoalesceSharesErrors(t *testing.T) {
+	const method, callers = "TestErrors", 5
+
+	errUpstream := errors.New("upstream is down")
+	release := make(chan struct{})
+	fetch := func(ctx context.Context) (int, error) {
+		<-release
+		return 0, errUpstream
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, callers)
+	for i := range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = coalesce(context.Background(), method, same[int], fetch, "slug")
+		}()
+	}
+	waitWaiters(t, method, callers)
+	close(release)
+	wg.Wait()
+
+	for i, err := range errs {
+		if !errors.Is(err, errUpstream) {
+			t.Errorf("caller %d got %v, want %v", i, err, errUpstream)
+		}
+	}
+}
+
+func TestCoalesceRecoversPanics(t *testing.T) {
+	_, err := coalesce(context.Background(), "TestPanic", same[int], func(ctx context.Context) (int, error) {
+		panic("boom")
+	}, "slug")
+	if err == nil {
+		t.Error("got no error from a panicking fetch")
+	}
+}
+
+func TestCoalesceCancelledWaiter(t *testing.T) {
+	const method = "TestCancelledWaiter"
+
+	release := make(chan struct{})
+	fetchErr := make(chan error, 1)
+	fetch := func(ctx context.Context) (int, error) {
+		select {
+		case <-release:
+			fetchErr <- nil
+			return 42, nil
+		case <-ctx.Done():
+			fetchErr <- ctx.Err()
+			return 0, ctx.Err()
+		}
+	}
+
+	staying := make(chan error, 1)
+	go func() {
+		v, err := coalesce(context.Background(), method, same[int], fetch, "slug")
+		if err == nil && v != 42 {
+			err = errors.New("wrong result")
+		}
+		staying <- err
+	}()
+	waitWaiters(t, method, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	leaving := make(chan error, 1)
+	go func() {
+		_, err := coalesce(ctx, method, same[int], fetch, "slug")
+		leaving <- err
+	}()
+	waitWaiters(t, method, 2)
+
+	cancel()
+	if err := <-leaving; !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled caller got %v, want context.Canceled", err)
+	}
+
+	close(release)
+	if err := <-staying; err != nil {
+		t.Errorf("remaining caller got %v", err)
+	}
+	if err := <-fetchErr; err != nil {
+		t.Errorf("fetch ended with %v, want it to finish", err)
+	}
+}
+
+func TestCoalesceCancelledByLastWaiter(t *testing.T) {
+	const method = "TestLastWaiter"
+
+	fetchErr := make(chan error, 1)
+	fetch := func(ctx context.Context) (int, error) {
+		<-ctx.Done()
+		fetchErr <- ctx.Err()
+		return 0, ctx.Err()
+	}
+
+	// Cancelling the first caller alone leaves the fetch running
+	first, cancelFirst := context.WithCancel(context.Background())
+	second, cancelSecond := context.WithCancel(context.Background())
+	done := make(chan struct{}, 2)
+	for i, ctx := range []context.Context{first, second} {
+		go func() {
+			coalesce(ctx, method, same[int], fetch, "slug")
+			done <- struct{}{}
+		}()
+		waitWaiters(t, method, i+1)
+	}
+
+	cancelFirst()
+	<-done
+	select {
+	case err := <-fetchErr:
+		t.Fatalf("fetch ended with %v while a caller waits", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	cancelSecond()
+	<-done
+	select {
+	case err := <-fetchErr:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("fetch ended with %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("fetch kept running after the last caller left")
+	}
+
+	flightsMu.Lock()
+	_, inFlight := flights[method+"\x00slug"]
+	flightsMu.Unlock()
+	if inFlight {
+		t.Error("a later caller would join the cancelled fetch")
+	}
+}
+
+func TestCoalesceClonesResults(t *testing.T) {
+	const method = "TestClones"
+
+	release := make(chan struct{})
+	fetch := func(ctx context.Context) (*Episode, error) {
+		<-release
+		return &Episode{Episodes: []LatestEpisode{{Slug: "dandadan", Episode: "1"}}}, nil
+	}
+
+	results := make(chan *Episode, 2)
+	for range 2 {
+		go func() {
+			episode, _ := coalesce(context.Background(), method, cloneEpisode, fetch, "slug")
+			results <- episode
+		}()
+	}
+	waitWaiters(t, method, 2)
+	close(release)
+
+	a, b := <-results, <-results
+	a.Episodes[0].Episode = "2"
+	if b.Episodes[0].Episode != "1" {
+		t.Error("callers share the episodes of the result")
+	}
+}
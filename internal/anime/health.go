@@ -0,0 +1,46 @@
+package anime
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/chromedp/chromedp"
+)
+
+// BaseURL is the site every scraper starts from
+const BaseURL = "https://jkanime.net/"
+
+// CheckBrowser launches a headless browser to make sure Chromium is installed and starts
+func CheckBrowser(ctx context.Context) error {
+	browser, cancel := newBrowser(ctx, "CheckBrowser")
+	defer cancel()
+
+	if err := chromedp.Run(browser); err != nil {
+		return fmt.Errorf("launching chromium: %w", err)
+	}
+
+	return nil
+}
+
+// CheckUpstream makes sure jkanime answers. Client errors still prove it
+// is reachable, only server errors and network failures count.
+func CheckUpstream(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, BaseURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 Chrome/120.0.0.0 Safari/537.36")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("upstream answered %s", resp.Status)
+	}
+
+	return nil
+}
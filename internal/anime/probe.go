@@ -0,0 +1,162 @@
+package anime
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"yokai/internal/metrics"
+)
+
+// ProbeStatus describes whether a stream can be played
+type ProbeStatus string
+
+const (
+	StatusAlive   ProbeStatus = "alive"
+	StatusDead    ProbeStatus = "dead"
+	StatusUnknown ProbeStatus = "unknown"
+)
+
+// ErrUnplayable is returned when a resolved stream fails the playability probe
+var ErrUnplayable = errors.New("stream is not playable")
+
+// probeBytes is how much of the stream is read to recognize its format
+const probeBytes = 64 * 1024
+
+var probeClient = &http.Client{Timeout: 10 * time.Second}
+
+// Probe checks that a stream URL answers with a parseable playlist or a
+// known media container. Network failures that say nothing about the
+// stream itself, like timeouts, are reported as unknown.
+func Probe(ctx context.Context, streamURL string) (ProbeStatus, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, streamURL, nil)
+	if err != nil {
+		return StatusDead, err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 Chrome/120.0.0.0 Safari/537.36")
+	req.Header.Set("Range", fmt.Sprintf("bytes=0-%d", probeBytes-1))
+
+	resp, err := probeClient.Do(req)
+	if err != nil {
+		return StatusUnknown, err
+	}
+	defer resp.Body.Close()
+	metrics.UpstreamResponse(req.URL.Hostname(), resp.StatusCode)
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return StatusDead, fmt.Errorf("%w: upstream answered %s", ErrUnplayable, resp.Status)
+	}
+
+	head, err := io.ReadAll(io.LimitReader(resp.Body, probeBytes))
+	if err != nil && len(head) == 0 {
+		return StatusUnknown, err
+	}
+
+	if err := checkStream(head); err != nil {
+		return StatusDead, err
+	}
+
+	return StatusAlive, nil
+}
+
+// checkStream recognizes HLS playlists and common media containers
+func checkStream(head []byte) error {
+	trimmed := bytes.TrimLeft(bytes.TrimPrefix(head, []byte("\xef\xbb\xbf")), " \t\r\n")
+
+	switch {
+	case len(trimmed) == 0:
+		return fmt.Errorf("%w: empty response", ErrUnplayable)
+	case bytes.HasPrefix(trimmed, []byte("#EXTM3U")):
+		return checkPlaylist(trimmed)
+	case bytes.HasPrefix(trimmed, []byte("<MPD")), bytes.HasPrefix(trimmed, []byte("<?xml")) && bytes.Contains(trimmed, []byte("<MPD")):
+		return nil
+	case len(head) >= 8 && isMP4Box(head[4:8]):
+		return nil
+	case len(head) >= 4 && bytes.Equal(head[:4], []byte{0x1a, 0x45, 0xdf, 0xa3}): // WebM / Matroska
+		return nil
+	case bytes.HasPrefix(head, []byte("FLV")):
+		return nil
+	case len(head) > 188 && head[0] == 0x47 && head[188] == 0x47: // MPEG-TS sync bytes
+		return nil
+	case bytes.HasPrefix(head, []byte("ID3")):
+		return nil
+	}
+
+	return fmt.Errorf("%w: unrecognized stream format", ErrUnplayable)
+}
+
+// checkPlaylist verifies an HLS playlist references at least one segment or variant
+func checkPlaylist(playlist []byte) error {
+	scanner := bufio.NewScanner(bytes.NewReader(playlist))
+	expectURI := false
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "#EXTINF"), strings.HasPrefix(line, "#EXT-X-STREAM-INF"):
+			expectURI = true
+		case strings.HasPrefix(line, "#"):
+			continue
+		case expectURI:
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: playlist has no segments", ErrUnplayable)
+}
+
+func isMP4Box(box []byte) bool {
+	switch string(box) {
+	case "ftyp", "moov", "styp", "moof", "mdat", "free", "skip":
+		return true
+	}
+	return false
+}
+
+// ProbeServers resolves every server and annotates it with its playability
+// status. At most parallel servers are resolved at the same time.
+func (j Jkanime) ProbeServers(servers []Server, parallel int) []Server {
+	probed := make([]Server, len(servers))
+	copy(probed, servers)
+
+	if parallel < 1 {
+		parallel = 1
+	}
+	sem := make(chan struct{}, parallel)
+
+	var wg sync.WaitGroup
+	for i := range probed {
+		wg.Add(1)
+		go func(server *Server) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			server.Status = j.probeServer(*server)
+		}(&probed[i])
+	}
+	wg.Wait()
+
+	return probed
+}
+
+func (j Jkanime) probeServer(server Server) ProbeStatus {
+	streaming, err := j.resolveStreaming(server.Server, server.Remote)
+	if errors.Is(err, ErrUnsupportedServer) {
+		return StatusUnknown
+	}
+	if err != nil || streaming == "" {
+		return StatusDead
+	}
+
+	status, _ := Probe(j.Context(), streaming)
+	return status
+}
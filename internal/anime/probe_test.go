@@ -0,0 +1,110 @@
+package anime
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckStream(t *testing.T) {
+	ts := bytes.Repeat([]byte{0}, 189)
+	ts[0], ts[188] = 0x47, 0x47
+
+	tests := []struct {
+		name     string
+		head     []byte
+		playable bool
+	}{
+		{"HLS media playlist", []byte("#EXTM3U\n#EXT-X-TARGETDURATION:10\n#EXTINF:10.0,\nsegment0.ts\n"), true},
+		{"HLS master playlist", []byte("#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1280000\nlow/index.m3u8\n"), true},
+		{"playlist with BOM and blank lines", []byte("\xef\xbb\xbf\r\n#EXTM3U\r\n#EXTINF:10,\r\n\r\nsegment0.ts\r\n"), true},
+		{"HLS error playlist", []byte("#EXTM3U\n#EXT-X-ENDLIST\n"), false},
+		{"playlist with a dangling EXTINF", []byte("#EXTM3U\n#EXTINF:10,\n#EXT-X-ENDLIST\n"), false},
+		{"DASH manifest", []byte(`<?xml version="1.0"?><MPD xmlns="urn:mpeg:dash:schema:mpd:2011">`), true},
+		{"MP4", append([]byte{0, 0, 0, 0x20}, []byte("ftypisom")...), true},
+		{"fragmented MP4", append([]byte{0, 0, 0, 0x18}, []byte("stypmsdh")...), true},
+		{"WebM", []byte{0x1a, 0x45, 0xdf, 0xa3, 0x9f}, true},
+		{"FLV", []byte("FLV\x01\x05"), true},
+		{"MPEG-TS", ts, true},
+		{"TS sync byte alone", ts[:188], false},
+		{"MP3 with ID3", []byte("ID3\x04\x00"), true},
+		{"HTML served as 200", []byte("<!DOCTYPE html><html><body>File not found</body></html>"), false},
+		{"XML that isn't DASH", []byte(`<?xml version="1.0"?><Error>AccessDenied</Error>`), false},
+		{"JSON error", []byte(`{"error":"expired"}`), false},
+		{"empty", nil, false},
+		{"whitespace", []byte(" \r\n\t"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkStream(tt.head)
+			if tt.playable && err != nil {
+				t.Errorf("checkStream = %v, want playable", err)
+			}
+			if !tt.playable && !errors.Is(err, ErrUnplayable) {
+				t.Errorf("checkStream = %v, want ErrUnplayable", err)
+			}
+		})
+	}
+}
+
+func TestIsMP4Box(t *testing.T) {
+	tests := map[string]bool{
+		"ftyp": true, "moov": true, "styp": true, "moof": true, "mdat": true, "free": true, "skip": true,
+		"FTYP": false, "html": false, "ftyp ": false, "": false,
+	}
+	for box, want := range tests {
+		if got := isMP4Box([]byte(box)); got != want {
+			t.Errorf("isMP4Box(%q) = %v, want %v", box, got, want)
+		}
+	}
+}
+
+func TestProbe(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   ProbeStatus
+	}{
+		{"playlist", http.StatusOK, "#EXTM3U\n#EXTINF:10,\nsegment0.ts\n", StatusAlive},
+		{"partial content", http.StatusPartialContent, "\x00\x00\x00\x20ftypisom", StatusAlive},
+		{"not found", http.StatusNotFound, "#EXTM3U\n#EXTINF:10,\nsegment0.ts\n", StatusDead},
+		{"HTML page", http.StatusOK, "<html><body>Video removed</body></html>", StatusDead},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rangeHeader string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				rangeHeader = r.Header.Get("Range")
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			status, err := Probe(context.Background(), srv.URL+"/stream")
+			if status != tt.want {
+				t.Errorf("Probe = %s (%v), want %s", status, err, tt.want)
+			}
+			if status == StatusDead && !errors.Is(err, ErrUnplayable) {
+				t.Errorf("Probe error %v, want ErrUnplayable", err)
+			}
+			if rangeHeader != "bytes=0-65535" {
+				t.Errorf("Range = %q, want the first %d bytes", rangeHeader, probeBytes)
+			}
+		})
+	}
+}
+
+func TestProbeUnreachable(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+
+	if status, err := Probe(context.Background(), srv.URL); status != StatusUnknown || err == nil {
+		t.Errorf("Probe of a closed server = %s, %v, want unknown", status, err)
+	}
+}
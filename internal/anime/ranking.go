@@ -0,0 +1,184 @@
+package anime
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// AutoServer is the server name that selects a stream server by ranking
+const AutoServer = "auto"
+
+// ServerStats holds the resolve history of a stream server
+type ServerStats struct {
+	Successes int   `json:"successes"`
+	Failures  int   `json:"failures"`
+	LatencyMs int64 `json:"latency_ms"` // accumulated latency of successful resolves
+}
+
+// SuccessRate returns the smoothed success rate, 0.5 for unknown servers
+func (s ServerStats) SuccessRate() float64 {
+	return float64(s.Successes+1) / float64(s.Successes+s.Failures+2)
+}
+
+// AvgLatency returns the average latency of successful resolves
+func (s ServerStats) AvgLatency() time.Duration {
+	if s.Successes == 0 {
+		return 0
+	}
+	return time.Duration(s.LatencyMs/int64(s.Successes)) * time.Millisecond
+}
+
+// Score combines success rate and latency, higher is better
+func (s ServerStats) Score() float64 {
+	return s.SuccessRate() / (1 + s.AvgLatency().Seconds()/10)
+}
+
+// Ranking learns which stream servers resolve reliably and fast
+type Ranking struct {
+	mu    sync.Mutex
+	path  string
+	stats map[string]*ServerStats
+}
+
+// NewRanking creates a ranking persisted at path, loading any previous history.
+// An empty path keeps the ranking in memory only.
+func NewRanking(path string) *Ranking {
+	r := &Ranking{
+		path:  path,
+		stats: make(map[string]*ServerStats),
+	}
+
+	if path == "" {
+		return r
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			logrus.Warnf("Error reading server ranking: %v", err)
+		}
+		return r
+	}
+
+	if err := json.Unmarshal(data, &r.stats); err != nil {
+		logrus.Warnf("Error parsing server ranking: %v", err)
+		r.stats = make(map[string]*ServerStats)
+	}
+
+	return r
+}
+
+// Order returns the servers sorted from best to worst ranked.
+// Servers without history keep their original relative order.
+func (r *Ranking) Order(servers []Server) []Server {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ordered := make([]Server, len(servers))
+	copy(ordered, servers)
+
+	sort.SliceStable(ordered, func(a, b int) bool {
+		return r.statsFor(ordered[a].Server).Score() > r.statsFor(ordered[b].Server).Score()
+	})
+
+	return ordered
+}
+
+// Record stores the outcome of a resolve attempt and persists the ranking
+func (r *Ranking) Record(server string, ok bool, latency time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stats, exists := r.stats[server]
+	if !exists {
+		stats = &ServerStats{}
+		r.stats[server] = stats
+	}
+
+	if ok {
+		stats.Successes++
+		stats.LatencyMs += latency.Milliseconds()
+	} else {
+		stats.Failures++
+	}
+
+	if err := r.save(); err != nil {
+		logrus.Warnf("Error saving server ranking: %v", err)
+	}
+}
+
+// Stats returns a snapshot of the history of every known server
+func (r *Ranking) Stats() map[string]ServerStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	snapshot := make(map[string]ServerStats, len(r.stats))
+	for name, stats := range r.stats {
+		snapshot[name] = *stats
+	}
+	return snapshot
+}
+
+func (r *Ranking) statsFor(server string) ServerStats {
+	if stats, ok := r.stats[server]; ok {
+		return *stats
+	}
+	return ServerStats{}
+}
+
+func (r *Ranking) save() error {
+	if r.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(r.stats, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(r.path), 0o755); err != nil {
+		return err
+	}
+
+	tmp := r.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, r.path)
+}
+
+// GetRankedStreaming tries the servers in ranking order and returns the
+// first stream that resolves, recording every attempt in the ranking.
+func (j Jkanime) GetRankedStreaming(servers []Server, ranking *Ranking) (Server, string, error) {
+	if len(servers) == 0 {
+		return Server{}, "", errors.New("no servers available")
+	}
+
+	var errs []error
+	for _, server := range ranking.Order(servers) {
+		start := time.Now()
+		streaming, err := j.GetStreaming(server.Server, server.Remote)
+		if err == nil && streaming == "" {
+			err = errors.New("empty streaming URL")
+		}
+
+		ranking.Record(server.Server, err == nil, time.Since(start))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", server.Server, err))
+			continue
+		}
+
+		return server, streaming, nil
+	}
+
+	return Server{}, "", errors.Join(errs...)
+}
@@ -0,0 +1,154 @@
+package anime
+
+import (
+	"errors"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"yokai/internal/metrics"
+)
+
+// Provider is the site the scraper gets its catalog from
+const Provider = "jkanime"
+
+// Providers lists every provider that can be turned off
+var Providers = []string{Provider}
+
+// Extractors lists the stream servers GetStreaming can resolve
+var Extractors = []string{"Desu", "Magi", "Streamwish", "Vidhide", "Filemoon", "VOE", "Streamtape"}
+
+// extractorHosts are the domains Extractors resolve streams from, reported
+// in metrics by name
+var extractorHosts = []string{
+	"jkdesu.com", "streamwish.to", "vidhidepro.com", "filemoon.sx", "voe.sx", "streamtape.com",
+}
+
+func init() {
+	metrics.KnownHosts(jkanimeHost)
+	metrics.KnownHosts(extractorHosts...)
+}
+
+// DefaultDisabledServers are offered by jkanime but only host downloads
+var DefaultDisabledServers = []string{"Mega", "Mediafire", "Mixdrop", "Mp4upload", "SaveFiles"}
+
+var (
+	// ErrServerDisabled is returned when resolving a stream of a disabled server
+	ErrServerDisabled = errors.New("server disabled")
+	// ErrProviderDisabled is returned by every scrape while the provider is disabled
+	ErrProviderDisabled = errors.New("provider disabled")
+	// ErrUnknownProvider is returned for names not in Providers
+	ErrUnknownProvider = errors.New("unknown provider")
+)
+
+// nameSet is a set of names compared case insensitively, keeping the
+// spelling they were added with
+type nameSet struct {
+	mu    sync.RWMutex
+	names map[string]string
+}
+
+func newNameSet(names []string) *nameSet {
+	s := &nameSet{}
+	s.set(names)
+	return s
+}
+
+func (s *nameSet) set(names []string) {
+	set := make(map[string]string, len(names))
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name != "" {
+			set[strings.ToLower(name)] = name
+		}
+	}
+
+	s.mu.Lock()
+	s.names = set
+	s.mu.Unlock()
+}
+
+func (s *nameSet) has(name string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.names[strings.ToLower(name)]
+	return ok
+}
+
+func (s *nameSet) list() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	names := make([]string, 0, len(s.names))
+	for _, name := range s.names {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+var (
+	disabledServers   = newNameSet(DefaultDisabledServers)
+	disabledProviders = newNameSet(nil)
+)
+
+// SetDisabledServers replaces the stream servers left out of GetServers
+// and refused by GetStreaming
+func SetDisabledServers(names []string) {
+	disabledServers.set(names)
+}
+
+// DisabledServers returns the disabled stream servers, sorted
+func DisabledServers() []string {
+	return disabledServers.list()
+}
+
+// ServerEnabled reports whether the stream server name may be used
+func ServerEnabled(name string) bool {
+	return !disabledServers.has(name)
+}
+
+// SetDisabledProviders replaces the disabled providers, names not in
+// Providers are rejected
+func SetDisabledProviders(names []string) error {
+	for _, name := range names {
+		if !KnownProvider(name) {
+			return ErrUnknownProvider
+		}
+	}
+
+	disabledProviders.set(names)
+	return nil
+}
+
+// DisabledProviders returns the disabled providers, sorted
+func DisabledProviders() []string {
+	return disabledProviders.list()
+}
+
+// ProviderEnabled reports whether the provider name may be scraped
+func ProviderEnabled(name string) bool {
+	return !disabledProviders.has(name)
+}
+
+// KnownProvider reports whether name is one of Providers
+func KnownProvider(name string) bool {
+	return slices.ContainsFunc(Providers, func(provider string) bool {
+		return strings.EqualFold(provider, name)
+	})
+}
+
+// checkProvider fails every scrape while an admin has the provider disabled
+func checkProvider() error {
+	if !ProviderEnabled(Provider) {
+		return ErrProviderDisabled
+	}
+	return nil
+}
+
+// enabledServers drops the disabled servers
+func enabledServers(servers []Server) []Server {
+	return slices.DeleteFunc(servers, func(server Server) bool {
+		return !ServerEnabled(server.Server)
+	})
+}
@@ -0,0 +1,47 @@
+package anime
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestSetDisabledProviders(t *testing.T) {
+	t.Cleanup(func() { SetDisabledProviders(nil) })
+
+	if err := SetDisabledProviders([]string{"JKAnime"}); err != nil {
+		t.Fatalf("SetDisabledProviders: %v", err)
+	}
+	if ProviderEnabled(Provider) || !errors.Is(checkProvider(), ErrProviderDisabled) {
+		t.Error("the provider is still enabled")
+	}
+
+	if err := SetDisabledProviders([]string{"crunchyroll"}); !errors.Is(err, ErrUnknownProvider) {
+		t.Errorf("SetDisabledProviders of an unknown provider = %v, want ErrUnknownProvider", err)
+	}
+	if ProviderEnabled(Provider) {
+		t.Error("a rejected change enabled the provider again")
+	}
+
+	if err := SetDisabledProviders(nil); err != nil || checkProvider() != nil {
+		t.Errorf("enabling the provider: %v, %v", err, checkProvider())
+	}
+}
+
+func TestSetDisabledServers(t *testing.T) {
+	t.Cleanup(func() { SetDisabledServers(DefaultDisabledServers) })
+
+	SetDisabledServers([]string{"streamwish", " Mega ", ""})
+
+	if got := DisabledServers(); !slices.Equal(got, []string{"Mega", "streamwish"}) {
+		t.Errorf("DisabledServers = %v, want Mega and streamwish", got)
+	}
+	if ServerEnabled("Streamwish") || !ServerEnabled("Desu") {
+		t.Error("servers aren't compared case insensitively")
+	}
+
+	servers := enabledServers([]Server{{Server: "Desu"}, {Server: "STREAMWISH"}, {Server: "Mega"}})
+	if len(servers) != 1 || servers[0].Server != "Desu" {
+		t.Errorf("enabledServers = %v, want Desu only", servers)
+	}
+}
@@ -1,5 +1,7 @@
 package anime
 
+import "strconv"
+
 type Episode struct {
 	TotalPages    int             `json:"total_pages"`
 	TotalEpisodes int             `json:"total_episodes"`
@@ -15,6 +17,12 @@ type LatestEpisode struct {
 	Episode string `json:"episode"`
 }
 
+// Number returns the episode number, 0 when it isn't one
+func (e LatestEpisode) Number() int {
+	n, _ := strconv.Atoi(e.Episode)
+	return n
+}
+
 type Anime struct {
 	Title          string                 `json:"title"`
 	Slug           string                 `json:"slug"`
@@ -24,6 +32,13 @@ type Anime struct {
 }
 
 type Server struct {
-	Server string `json:"server"`
-	Remote string `json:"remote"`
+	Server string      `json:"server"`
+	Remote string      `json:"remote"`
+	Status ProbeStatus `json:"status,omitempty"`
+}
+
+type SearchResult struct {
+	Results []Anime `json:"results"`
+	Page    int     `json:"page"`
+	HasNext bool    `json:"has_next"`
 }
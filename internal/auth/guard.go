@@ -0,0 +1,336 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Class groups routes by how much upstream work they trigger
+type Class string
+
+const (
+	// Cheap routes are served with plain HTTP scraping
+	Cheap Class = "cheap"
+	// Expensive routes start headless browser sessions
+	Expensive Class = "expensive"
+)
+
+// HeaderAPIKey is the header clients send their key in
+const HeaderAPIKey = "X-API-Key"
+
+// idleTimeout is how long an unused client is remembered
+const idleTimeout = time.Hour
+
+// Limit is a token bucket refilled with PerMinute tokens every minute.
+// A PerMinute of 0 disables limiting.
+type Limit struct {
+	PerMinute int
+	Burst     int
+}
+
+// Usage counts the requests of a single client
+type Usage struct {
+	Identity string           `json:"identity"`
+	Requests map[Class]uint64 `json:"requests"`
+	Limited  map[Class]uint64 `json:"limited"`
+	LastSeen time.Time        `json:"last_seen"`
+}
+
+type client struct {
+	limiters map[Class]*rate.Limiter
+	usage    Usage
+}
+
+// Guard authenticates API keys and rate limits every client per route class
+type Guard struct {
+	keys     map[string]string
+	limits   map[Class]Limit
+	sessions SessionResolver
+	admins   map[string]bool
+	proxies  []netip.Prefix
+
+	mu      sync.Mutex
+	clients map[string]*client
+}
+
+// NewGuard creates a guard for the given key to name mapping. With no keys
+// authentication is disabled and clients are limited by IP address.
+func NewGuard(keys map[string]string, limits map[Class]Limit) *Guard {
+	return &Guard{
+		keys:    keys,
+		limits:  limits,
+		clients: make(map[string]*client),
+	}
+}
+
+// Enabled reports whether requests must carry an API key
+func (g *Guard) Enabled() bool {
+	return len(g.keys) > 0
+}
+
+// Identify returns who sent the request, false if a required key is
+// missing or unknown. Users logged in with a session are let through
+// whether keys are required or not.
+func (g *Guard) Identify(r *http.Request) (string, bool) {
+	if token, bearer := SessionToken(r); token != "" && g.sessions != nil {
+		if user, ok := g.sessions(token); ok {
+			return UserIdentity(user), true
+		}
+		// A stale cookie falls back to the other methods, a bad token doesn't
+		if bearer {
+			return "", false
+		}
+	}
+
+	if !g.Enabled() {
+		return g.IPIdentity(r), true
+	}
+
+	key := r.Header.Get(HeaderAPIKey)
+	if key == "" {
+		// Players and feed readers can't send headers
+		key = r.URL.Query().Get("api_key")
+	}
+	if key == "" {
+		return "", false
+	}
+
+	for candidate, name := range g.keys {
+		if subtle.ConstantTimeCompare([]byte(candidate), []byte(key)) == 1 {
+			return name, true
+		}
+	}
+
+	return "", false
+}
+
+// UseAdmins lets the given identities use the admin routes. Only API key
+// names and users can be admins, addresses are easy to share or spoof.
+func (g *Guard) UseAdmins(identities []string) error {
+	names := make(map[string]bool, len(g.keys))
+	for _, name := range g.keys {
+		names[name] = true
+	}
+
+	admins := make(map[string]bool, len(identities))
+	for _, identity := range identities {
+		if user, ok := UserFrom(identity); (!ok || user == "") && !names[identity] {
+			return fmt.Errorf("admin %q is neither an API key name nor user:<name>", identity)
+		}
+		admins[identity] = true
+	}
+
+	g.admins = admins
+	return nil
+}
+
+// Admin reports whether identity may use the admin routes
+func (g *Guard) Admin(identity string) bool {
+	return identity != "" && g.admins[identity]
+}
+
+// UseTrustedProxies lets the listed addresses or CIDR ranges tell the
+// address of the client they forward for in X-Forwarded-For
+func (g *Guard) UseTrustedProxies(proxies []string) error {
+	prefixes := make([]netip.Prefix, 0, len(proxies))
+	for _, proxy := range proxies {
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(proxy)
+			if addrErr != nil {
+				return fmt.Errorf("trusted proxy %q is neither an address nor a CIDR range", proxy)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+
+	g.proxies = prefixes
+	return nil
+}
+
+// FromTrustedProxy reports whether r was sent by one of the trusted
+// proxies, whose X-Forwarded-* headers can then be believed
+func (g *Guard) FromTrustedProxy(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return g.trusted(host)
+}
+
+// IPIdentity identifies an anonymous client by its address. Behind trusted
+// proxies that's the last address of X-Forwarded-For they didn't add.
+func (g *Guard) IPIdentity(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	if !g.trusted(host) {
+		return "ip:" + host
+	}
+
+	// Clients can send the header too, only the entries added by trusted
+	// proxies count, walking from the closest one
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(forwarded[i]))
+		if err != nil {
+			break
+		}
+		host = addr.Unmap().String()
+		if !g.trusted(host) {
+			break
+		}
+	}
+
+	return "ip:" + host
+}
+
+func (g *Guard) trusted(host string) bool {
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+
+	addr = addr.Unmap()
+	for _, prefix := range g.proxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Allow takes a token from the bucket of identity for class, returning how
+// long to wait when the bucket is empty
+func (g *Guard) Allow(identity string, class Class) (bool, time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	c := g.client(identity, now)
+	c.usage.Requests[class]++
+	c.usage.LastSeen = now
+
+	limiter := c.limiter(class, g.limits[class])
+	if limiter == nil {
+		return true, 0
+	}
+
+	reservation := limiter.ReserveN(now, 1)
+	if delay := reservation.DelayFrom(now); delay > 0 {
+		reservation.CancelAt(now)
+		c.usage.Limited[class]++
+		return false, delay
+	}
+
+	return true, 0
+}
+
+// Usage returns the counters of identity
+func (g *Guard) Usage(identity string) Usage {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	c, ok := g.clients[identity]
+	if !ok {
+		return newUsage(identity)
+	}
+
+	usage := newUsage(identity)
+	usage.LastSeen = c.usage.LastSeen
+	for class, count := range c.usage.Requests {
+		usage.Requests[class] = count
+	}
+	for class, count := range c.usage.Limited {
+		usage.Limited[class] = count
+	}
+	return usage
+}
+
+func (g *Guard) client(identity string, now time.Time) *client {
+	c, ok := g.clients[identity]
+	if ok {
+		return c
+	}
+
+	// Forget idle addresses so per IP tracking doesn't grow forever. They're
+	// tracked with keys required too, for the routes open to anyone.
+	for id, idle := range g.clients {
+		if strings.HasPrefix(id, "ip:") && now.Sub(idle.usage.LastSeen) > idleTimeout {
+			delete(g.clients, id)
+		}
+	}
+
+	c = &client{
+		limiters: make(map[Class]*rate.Limiter),
+		usage:    newUsage(identity),
+	}
+	g.clients[identity] = c
+	return c
+}
+
+func (c *client) limiter(class Class, limit Limit) *rate.Limiter {
+	if limit.PerMinute <= 0 {
+		return nil
+	}
+
+	limiter, ok := c.limiters[class]
+	if !ok {
+		burst := limit.Burst
+		if burst <= 0 {
+			burst = limit.PerMinute
+		}
+		limiter = rate.NewLimiter(rate.Limit(float64(limit.PerMinute)/60), burst)
+		c.limiters[class] = limiter
+	}
+	return limiter
+}
+
+func newUsage(identity string) Usage {
+	return Usage{
+		Identity: identity,
+		Requests: make(map[Class]uint64),
+		Limited:  make(map[Class]uint64),
+	}
+}
+
+type identityKey struct{}
+
+// WithIdentity returns a context carrying the identity of the client
+func WithIdentity(ctx context.Context, identity string) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// IdentityFrom returns the identity stored by WithIdentity
+func IdentityFrom(ctx context.Context) string {
+	identity, _ := ctx.Value(identityKey{}).(string)
+	return identity
+}
+
+// ParseKeys parses "name:key" pairs, bare keys are named after their position
+func ParseKeys(pairs []string) map[string]string {
+	keys := make(map[string]string)
+	for i, pair := range pairs {
+		name, key, ok := strings.Cut(pair, ":")
+		if !ok {
+			name, key = "key"+strconv.Itoa(i+1), pair
+		}
+		if key = strings.TrimSpace(key); key != "" {
+			keys[key] = strings.TrimSpace(name)
+		}
+	}
+	return keys
+}
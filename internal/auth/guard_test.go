@@ -0,0 +1,195 @@
+package auth
+
+import (
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseKeys(t *testing.T) {
+	got := ParseKeys([]string{"alice:k1", "k2", " bob : k3 ", ""})
+	want := map[string]string{"k1": "alice", "k2": "key2", "k3": "bob"}
+	if !maps.Equal(got, want) {
+		t.Errorf("ParseKeys = %v, want %v", got, want)
+	}
+}
+
+func TestIdentify(t *testing.T) {
+	guard := NewGuard(map[string]string{"secret": "alice"}, nil)
+	guard.UseSessions(func(token string) (string, bool) {
+		return "bob", token == "session"
+	})
+
+	tests := []struct {
+		name     string
+		header   http.Header
+		target   string
+		identity string
+		ok       bool
+	}{
+		{"key header", http.Header{HeaderAPIKey: {"secret"}}, "/", "alice", true},
+		{"key query", nil, "/?api_key=secret", "alice", true},
+		{"unknown key", http.Header{HeaderAPIKey: {"wrong"}}, "/", "", false},
+		{"no key", nil, "/", "", false},
+		{"bearer session", http.Header{"Authorization": {"Bearer session"}}, "/", "user:bob", true},
+		{"bad bearer token", http.Header{"Authorization": {"Bearer stale"}, HeaderAPIKey: {"secret"}}, "/", "", false},
+		{"stale cookie falls back to the key", http.Header{"Cookie": {CookieSession + "=stale"}, HeaderAPIKey: {"secret"}}, "/", "alice", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			for name, values := range tt.header {
+				for _, value := range values {
+					r.Header.Add(name, value)
+				}
+			}
+
+			identity, ok := guard.Identify(r)
+			if identity != tt.identity || ok != tt.ok {
+				t.Errorf("Identify = %q, %v, want %q, %v", identity, ok, tt.identity, tt.ok)
+			}
+		})
+	}
+}
+
+func TestIdentifyWithoutKeys(t *testing.T) {
+	guard := NewGuard(nil, nil)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "203.0.113.7:51234"
+	r.Header.Set("X-Forwarded-For", "198.51.100.1")
+
+	identity, ok := guard.Identify(r)
+	if identity != "ip:203.0.113.7" || !ok {
+		t.Errorf("Identify = %q, %v, want ip:203.0.113.7, true", identity, ok)
+	}
+}
+
+func TestIPIdentityBehindTrustedProxies(t *testing.T) {
+	guard := NewGuard(nil, nil)
+	if err := guard.UseTrustedProxies([]string{"10.0.0.0/8", "192.0.2.1"}); err != nil {
+		t.Fatalf("UseTrustedProxies: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		want       string
+	}{
+		{"untrusted peer", "203.0.113.7:1234", "198.51.100.1", "ip:203.0.113.7"},
+		{"trusted proxy", "10.1.2.3:1234", "198.51.100.1", "ip:198.51.100.1"},
+		{"spoofed entry before the proxy", "10.1.2.3:1234", "6.6.6.6, 198.51.100.1", "ip:198.51.100.1"},
+		{"chain of proxies", "192.0.2.1:1234", "198.51.100.1, 10.0.0.5", "ip:198.51.100.1"},
+		{"trusted proxy without header", "10.1.2.3:1234", "", "ip:10.1.2.3"},
+		{"garbage header", "10.1.2.3:1234", "not-an-address", "ip:10.1.2.3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.forwarded != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+
+			if got := guard.IPIdentity(r); got != tt.want {
+				t.Errorf("IPIdentity = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	for remoteAddr, want := range map[string]bool{
+		"10.1.2.3:1234":        true,
+		"192.0.2.1:1234":       true,
+		"[::ffff:10.0.0.1]:80": true,
+		"203.0.113.7:1234":     false,
+		"192.0.2.2:1234":       false,
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = remoteAddr
+		if got := guard.FromTrustedProxy(r); got != want {
+			t.Errorf("FromTrustedProxy(%s) = %v, want %v", remoteAddr, got, want)
+		}
+	}
+
+	if err := guard.UseTrustedProxies([]string{"proxy.local"}); err == nil {
+		t.Error("UseTrustedProxies accepted a host name")
+	}
+}
+
+func TestAllow(t *testing.T) {
+	guard := NewGuard(nil, map[Class]Limit{
+		Expensive: {PerMinute: 2},
+	})
+
+	for i := range 2 {
+		if allowed, _ := guard.Allow("ip:203.0.113.7", Expensive); !allowed {
+			t.Fatalf("request %d was limited within the burst", i+1)
+		}
+	}
+
+	allowed, retryAfter := guard.Allow("ip:203.0.113.7", Expensive)
+	if allowed {
+		t.Fatal("request over the limit was allowed")
+	}
+	if retryAfter <= 0 || retryAfter > 30*time.Second {
+		t.Errorf("retry after %v, want up to the 30s a token takes to refill", retryAfter)
+	}
+
+	if allowed, _ := guard.Allow("ip:198.51.100.1", Expensive); !allowed {
+		t.Error("another client was limited")
+	}
+	if allowed, _ := guard.Allow("ip:203.0.113.7", Cheap); !allowed {
+		t.Error("a class without limit was limited")
+	}
+
+	usage := guard.Usage("ip:203.0.113.7")
+	if usage.Requests[Expensive] != 3 || usage.Limited[Expensive] != 1 {
+		t.Errorf("usage = %+v, want 3 expensive requests with 1 limited", usage)
+	}
+}
+
+func TestIdleAddressesForgotten(t *testing.T) {
+	// With keys required, addresses are still tracked for the login route
+	guard := NewGuard(map[string]string{"secret": "ops"}, nil)
+
+	now := time.Now()
+	guard.client("ip:203.0.113.7", now.Add(-2*idleTimeout)).usage.LastSeen = now.Add(-2 * idleTimeout)
+	guard.client("ops", now.Add(-2*idleTimeout)).usage.LastSeen = now.Add(-2 * idleTimeout)
+	guard.client("ip:198.51.100.1", now).usage.LastSeen = now
+	guard.client("ip:192.0.2.1", now)
+
+	if _, ok := guard.clients["ip:203.0.113.7"]; ok {
+		t.Error("an idle address is still tracked")
+	}
+	if _, ok := guard.clients["ip:198.51.100.1"]; !ok {
+		t.Error("a recent address was forgotten")
+	}
+	if _, ok := guard.clients["ops"]; !ok {
+		t.Error("an idle key was forgotten with its usage")
+	}
+}
+
+func TestUseAdmins(t *testing.T) {
+	guard := NewGuard(map[string]string{"secret": "ops"}, nil)
+
+	if err := guard.UseAdmins([]string{"ops", "user:alice"}); err != nil {
+		t.Fatalf("UseAdmins: %v", err)
+	}
+	if !guard.Admin("ops") || !guard.Admin("user:alice") {
+		t.Error("listed identities aren't admins")
+	}
+	if guard.Admin("user:bob") || guard.Admin("") {
+		t.Error("unlisted identities are admins")
+	}
+
+	for _, identity := range []string{"ip:127.0.0.1", "unknown-key", "user:"} {
+		if err := guard.UseAdmins([]string{identity}); err == nil {
+			t.Errorf("UseAdmins accepted %q", identity)
+		}
+	}
+}
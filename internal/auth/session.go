@@ -0,0 +1,46 @@
+package auth
+
+import (
+	"net/http"
+	"strings"
+)
+
+// CookieSession is the cookie the web UI keeps its session token in
+const CookieSession = "okarun_session"
+
+// userPrefix marks the identities of logged in users, apart from API key
+// names and addresses
+const userPrefix = "user:"
+
+// SessionResolver returns the user logged in with a session token
+type SessionResolver func(token string) (string, bool)
+
+// UseSessions lets clients authenticate with the session tokens resolve
+// knows about, sent as a bearer token or in the session cookie
+func (g *Guard) UseSessions(resolve SessionResolver) {
+	g.sessions = resolve
+}
+
+// SessionToken returns the session token of the request and whether it
+// was sent as a bearer token rather than a cookie
+func SessionToken(r *http.Request) (string, bool) {
+	if scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " "); ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token), true
+	}
+
+	if cookie, err := r.Cookie(CookieSession); err == nil {
+		return cookie.Value, false
+	}
+
+	return "", false
+}
+
+// UserIdentity returns the identity of a logged in user
+func UserIdentity(username string) string {
+	return userPrefix + username
+}
+
+// UserFrom returns the user of identity, false if it's not a logged in user
+func UserFrom(identity string) (string, bool) {
+	return strings.CutPrefix(identity, userPrefix)
+}
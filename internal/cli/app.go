@@ -1,6 +1,10 @@
 package cli
 
 import (
+	"path/filepath"
+	"yokai/internal/anime"
+	"yokai/internal/config"
+
 	"github.com/charmbracelet/bubbles/help"
 	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/spinner"
@@ -30,6 +34,8 @@ func NewModel() Model {
 		textInput:     ti,
 		activeView:    "main",
 		mainMenuItems: mainMenuItems,
+		ranking:       anime.NewRanking(filepath.Join(config.UserDataDir(), "ranking.json")),
+		history:       NewHistory(filepath.Join(config.UserDataDir(), "history.json")),
 	}
 }
 
@@ -88,12 +94,16 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				switch m.activeView {
 				case "main":
 					switch m.list.SelectedItem().(MenuItem).title {
+					case "Continue Watching":
+						return m, NavigateToContinue(&m)
 					case "Recent Updates":
 						if !m.loading {
 							return m, NavigateToRecent(&m)
 						}
 					case "Search Anime":
 						return m, NavigateToSearch(&m)
+					case "History":
+						return m, NavigateToHistory(&m)
 					case "Exit":
 						m.quitting = true
 						return m, tea.Quit
@@ -106,6 +116,22 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 							return m, NavigateToServerSelect(&m, &m.animes[idx])
 						}
 					}
+				case "continue":
+					if !m.loading {
+						idx := m.list.Index()
+						if idx < len(m.continueEntries) {
+							next := m.continueEntries[idx].Continue()
+							return m, NavigateToServerSelect(&m, &next)
+						}
+					}
+				case "history":
+					if !m.loading {
+						idx := m.list.Index()
+						if idx < len(m.historyEntries) {
+							episode := m.historyEntries[idx].LatestEpisode()
+							return m, NavigateToServerSelect(&m, &episode)
+						}
+					}
 				case "search":
 					if !m.loading {
 						idx := m.list.Index()
@@ -126,10 +152,14 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				case "servers":
 					if !m.loading && m.selectedEpisode != nil {
 						idx := m.list.Index()
-						if idx < len(m.servers) {
-							server := m.servers[idx]
+						if idx == 0 && len(m.servers) > 0 {
 							m.loading = true
-							return m, PlayEpisode(server)
+							return m, PlayEpisodeAuto(m.servers, m.ranking)
+						}
+						if idx > 0 && idx <= len(m.servers) {
+							server := m.servers[idx-1]
+							m.loading = true
+							return m, PlayEpisode(server, m.ranking)
 						}
 					}
 				}
@@ -154,9 +184,16 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case PlayEpisodeMsg:
 		return m, HandlePlayback(&m, msg)
 
+	case PlayerStartedMsg:
+		return m, HandlePlayerStarted(&m, msg)
+
+	case PlaybackMsg:
+		return m, UpdatePlayback(&m, msg)
+
 	case tea.WindowSizeMsg:
 		h, v := DocStyle.GetFrameSize()
-		m.list.SetSize(msg.Width-h, msg.Height-v)
+		// The last line is kept for the now playing status bar
+		m.list.SetSize(msg.Width-h, msg.Height-v-1)
 
 	case spinner.TickMsg:
 		var cmd tea.Cmd
@@ -2,8 +2,9 @@ package cli
 
 import (
 	"fmt"
-	"os/exec"
+	"time"
 	"yokai/internal/anime"
+	"yokai/internal/mpv"
 
 	"github.com/charmbracelet/bubbles/list"
 	"github.com/charmbracelet/bubbles/textinput"
@@ -109,9 +110,10 @@ func UpdateServerList(m *Model, msg FetchServersMsg) tea.Cmd {
 	}
 
 	m.servers = msg.Servers
-	items := make([]list.Item, len(msg.Servers))
+	items := make([]list.Item, len(msg.Servers)+1)
+	items[0] = NewMenuItem("Auto", "Try the best ranked servers until one works")
 	for i, server := range msg.Servers {
-		items[i] = NewMenuItem(
+		items[i+1] = NewMenuItem(
 			fmt.Sprintf("Server %d", i+1),
 			server.Server,
 		)
@@ -143,7 +145,8 @@ func NavigateBack(m *Model) tea.Cmd {
 	case "episodes":
 		return NavigateBackToSearch(m)
 	case "servers":
-		if m.previousView == "recent" {
+		switch m.previousView {
+		case "recent":
 			m.activeView = "recent"
 			items := make([]list.Item, len(m.animes))
 			for i, anime := range m.animes {
@@ -152,7 +155,11 @@ func NavigateBack(m *Model) tea.Cmd {
 			m.list.SetItems(items)
 			m.list.Title = "🌸 Recent Updates (Press ESC to go back)"
 			return nil
-		} else {
+		case "continue":
+			return RestoreContinueList(m)
+		case "history":
+			return NavigateToHistory(m)
+		default:
 			return RestoreEpisodeList(m)
 		}
 	default:
@@ -179,32 +186,203 @@ func NavigateBackToSearch(m *Model) tea.Cmd {
 // PlayEpisodeMsg represents a message containing the streaming URL
 type PlayEpisodeMsg struct {
 	StreamingURL string
+	Server       string
 	Err          error
 }
 
 // PlayEpisode starts playback of the selected episode
-func PlayEpisode(server anime.Server) tea.Cmd {
+func PlayEpisode(server anime.Server, ranking *anime.Ranking) tea.Cmd {
 	return func() tea.Msg {
 		client := &anime.Jkanime{}
+		start := time.Now()
 		streamingURL, err := client.GetStreaming(server.Server, server.Remote)
-		return PlayEpisodeMsg{StreamingURL: streamingURL, Err: err}
+		ranking.Record(server.Server, err == nil, time.Since(start))
+		return PlayEpisodeMsg{StreamingURL: streamingURL, Server: server.Server, Err: err}
 	}
 }
 
-// HandlePlayback handles the MPV playback of the streaming URL
+// PlayEpisodeAuto starts playback with the first ranked server that resolves
+func PlayEpisodeAuto(servers []anime.Server, ranking *anime.Ranking) tea.Cmd {
+	return func() tea.Msg {
+		client := &anime.Jkanime{}
+		server, streamingURL, err := client.GetRankedStreaming(servers, ranking)
+		return PlayEpisodeMsg{StreamingURL: streamingURL, Server: server.Server, Err: err}
+	}
+}
+
+// progressSaveInterval is how often the position of a playing episode is
+// saved, besides every pause and the end of the playback
+const progressSaveInterval = 15 * time.Second
+
+// HandlePlayback records the episode in the history and starts mpv on the
+// streaming URL, resuming where the episode was left
 func HandlePlayback(m *Model, msg PlayEpisodeMsg) tea.Cmd {
 	if msg.Err != nil {
 		m.err = msg.Err
 		return nil
 	}
 
-	// Run MPV in a separate goroutine to not block the UI
-	go func() {
-		exec.Command("mpv", msg.StreamingURL).Run()
-	}()
+	entry := HistoryEntry{Server: msg.Server}
+	if ep := m.selectedEpisode; ep != nil {
+		entry.Slug, entry.Title, entry.Episode = ep.Slug, ep.Title, ep.Episode
+		entry.LastEpisode = lastEpisode(m, *ep)
+		if last, ok := m.history.Last(ep.Slug, ep.Episode); ok && last.Resumable() {
+			entry.Position, entry.Duration = last.Position, last.Duration
+		}
+		m.history.Record(entry)
+	}
+
+	return StartPlayer(msg.StreamingURL, entry)
+}
+
+// lastEpisode returns the latest episode of the anime of ep from what's
+// already loaded, so Continue Watching can tell when it's finished without
+// scraping every anime again
+func lastEpisode(m *Model, ep anime.LatestEpisode) int {
+	known := m.history.LastEpisode(ep.Slug)
+	switch {
+	case m.previousView == "episodes" && m.currentEpisodes != nil && m.currentAnime != nil && m.currentAnime.Slug == ep.Slug:
+		known = max(known, m.currentEpisodes.LastEpisode)
+	case m.previousView == "recent":
+		// Recent updates are the latest episode of their anime
+		known = max(known, ep.Number())
+	}
+	return known
+}
+
+// PlayerStartedMsg reports that mpv is running
+type PlayerStartedMsg struct {
+	Player  *mpv.Player
+	Episode anime.LatestEpisode
+	Err     error
+}
+
+// StartPlayer runs mpv on the streaming URL of the entry, from its position
+func StartPlayer(streamingURL string, entry HistoryEntry) tea.Cmd {
+	return func() tea.Msg {
+		opts := mpv.Options{Start: entry.Position}
+		if entry.Slug != "" {
+			opts.Title = fmt.Sprintf("%s - Episode %s", entry.Title, entry.Episode)
+		}
+		player, err := mpv.Start(streamingURL, opts)
+		return PlayerStartedMsg{Player: player, Episode: entry.LatestEpisode(), Err: err}
+	}
+}
+
+// HandlePlayerStarted shows the episode in the status bar and starts
+// following its playback
+func HandlePlayerStarted(m *Model, msg PlayerStartedMsg) tea.Cmd {
+	// Stay in the current view, playback doesn't block the UI
+	m.loading = false
+	if msg.Err != nil {
+		m.err = msg.Err
+		return nil
+	}
+
+	m.nowPlaying = &NowPlaying{Episode: msg.Episode, player: msg.Player}
+	return WaitForPlayback(msg.Player, msg.Episode, mpv.Status{}, time.Now())
+}
+
+// PlaybackMsg carries the latest status of a playback, Done is set once
+// mpv exited and Status is then the last one received
+type PlaybackMsg struct {
+	Player  *mpv.Player
+	Episode anime.LatestEpisode
+	Status  mpv.Status
+	Done    bool
+	// SavedAt is when the position was last saved to the history
+	SavedAt time.Time
+}
+
+// WaitForPlayback waits for the next status of a playback
+func WaitForPlayback(player *mpv.Player, episode anime.LatestEpisode, last mpv.Status, savedAt time.Time) tea.Cmd {
+	return func() tea.Msg {
+		status, ok := <-player.Updates()
+		if !ok {
+			return PlaybackMsg{Player: player, Episode: episode, Status: last, Done: true, SavedAt: savedAt}
+		}
+		return PlaybackMsg{Player: player, Episode: episode, Status: status, SavedAt: savedAt}
+	}
+}
+
+// UpdatePlayback saves the position of a playback to the history and
+// refreshes the status bar, until mpv exits
+func UpdatePlayback(m *Model, msg PlaybackMsg) tea.Cmd {
+	status := msg.Status
+	current := m.nowPlaying != nil && m.nowPlaying.player == msg.Player
+
+	if msg.Done {
+		if status.Position > 0 || status.Ended {
+			m.history.SaveProgress(msg.Episode.Slug, msg.Episode.Episode, status.Position, status.Duration, status.Ended)
+		}
+		if current {
+			m.nowPlaying = nil
+		}
+		return nil
+	}
+
+	if current {
+		m.nowPlaying.Status = status
+	}
+
+	savedAt := msg.SavedAt
+	if status.Paused || status.Ended || time.Since(savedAt) >= progressSaveInterval {
+		m.history.SaveProgress(msg.Episode.Slug, msg.Episode.Episode, status.Position, status.Duration, status.Ended)
+		savedAt = time.Now()
+	}
+
+	return WaitForPlayback(msg.Player, msg.Episode, status, savedAt)
+}
 
-	// Just reset the loading state and stay in the current view
+// NavigateToContinue lists the episode to play next of every anime left
+// to continue, resuming the ones left halfway
+func NavigateToContinue(m *Model) tea.Cmd {
+	m.previousView = "main"
 	m.loading = false
+	m.err = nil
+
+	m.continueEntries = m.history.ContinueWatching()
+	return RestoreContinueList(m)
+}
+
+// RestoreContinueList recreates the continue watching list when returning
+// from the servers view, keeping the entries it was opened with
+func RestoreContinueList(m *Model) tea.Cmd {
+	m.activeView = "continue"
+	items := make([]list.Item, len(m.continueEntries))
+	for i, entry := range m.continueEntries {
+		description := fmt.Sprintf("Play episode %s - Watched episode %s on %s",
+			entry.NextEpisode().Episode, entry.Episode, entry.WatchedAt.Format(historyTimeLayout))
+		if entry.Resumable() {
+			description = fmt.Sprintf("Resume episode %s at %s - Watched on %s",
+				entry.Episode, formatSeconds(entry.Position), entry.WatchedAt.Format(historyTimeLayout))
+		}
+		items[i] = NewMenuItem(entry.Title, description)
+	}
+	m.list.SetItems(items)
+	m.list.Title = "🌸 Continue Watching (Press ESC to go back)"
+	m.list.Select(0)
+	return nil
+}
+
+// NavigateToHistory lists every episode played, newest first
+func NavigateToHistory(m *Model) tea.Cmd {
+	m.previousView = "main"
+	m.activeView = "history"
+	m.loading = false
+	m.err = nil
+
+	m.historyEntries = m.history.Entries()
+	items := make([]list.Item, len(m.historyEntries))
+	for i, entry := range m.historyEntries {
+		items[i] = NewMenuItem(
+			fmt.Sprintf("%s - Episode %s", entry.Title, entry.Episode),
+			fmt.Sprintf("Watched on %s with %s", entry.WatchedAt.Format(historyTimeLayout), entry.Server),
+		)
+	}
+	m.list.SetItems(items)
+	m.list.Title = "🌸 History (Press ESC to go back)"
+	m.list.Select(0)
 	return nil
 }
 
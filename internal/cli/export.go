@@ -0,0 +1,73 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"yokai/internal/anime"
+	"yokai/internal/playlist"
+)
+
+// RunExport writes the M3U playlist of an anime to a local file
+func RunExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	output := fs.String("o", "", "output file (defaults to <slug>.m3u8)")
+	server := fs.String("server", "http://localhost:5000", "okarun server that resolves the streams")
+	apiKey := fs.String("api-key", "", "API key of the server, for servers with API_KEYS set")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: okarun export [-o file] [-server url] [-api-key key] <slug>")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("expected exactly one slug")
+	}
+
+	slug := fs.Arg(0)
+	if *output == "" {
+		*output = slug + ".m3u8"
+	}
+
+	entries, err := playlist.Build(anime.Jkanime{}, slug, *server)
+	if err != nil {
+		return err
+	}
+	playlist.WithAPIKey(entries, *apiKey)
+
+	if err := writePlaylist(*output, entries); err != nil {
+		return err
+	}
+
+	fmt.Printf("Exported %d episodes to %s\n", len(entries), *output)
+	return nil
+}
+
+// writePlaylist writes the entries to a temporary file renamed over path
+// once complete, so a failed export never leaves a truncated playlist
+func writePlaylist(path string, entries []playlist.Entry) error {
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if err := playlist.Write(file, entries); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	// CreateTemp makes the file private, a playlist is not
+	if err := os.Chmod(file.Name(), 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), path)
+}
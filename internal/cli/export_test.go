@@ -0,0 +1,46 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"yokai/internal/playlist"
+)
+
+func TestWritePlaylist(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "dandadan.m3u8")
+	if err := os.WriteFile(path, []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := []playlist.Entry{{Title: "Dandadan - 1", URL: "http://localhost:5000/api/v1/anime/dandadan/episodes/1/play"}}
+	playlist.WithAPIKey(entries, "s3cr&t")
+	if err := writePlaylist(path, entries); err != nil {
+		t.Fatalf("writePlaylist: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), "#EXTM3U\n") || !strings.Contains(string(data), "/play?api_key=s3cr%26t\n") {
+		t.Errorf("playlist = %q, want the entries with the key", data)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0o644 {
+		t.Errorf("mode = %v, want 0644", info.Mode().Perm())
+	}
+
+	files, _ := os.ReadDir(dir)
+	if len(files) != 1 {
+		t.Errorf("left %d files behind, want only the playlist", len(files))
+	}
+}
+
+func TestWritePlaylistMissingDirectory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing", "dandadan.m3u8")
+	if err := writePlaylist(path, nil); err == nil {
+		t.Error("writePlaylist succeeded in a missing directory")
+	}
+}
@@ -0,0 +1,249 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+	"yokai/internal/anime"
+	"yokai/internal/progress"
+
+	"github.com/sirupsen/logrus"
+)
+
+// maxHistoryEntries bounds the history file, older playbacks are dropped
+const maxHistoryEntries = 500
+
+// historyTimeLayout formats when an episode was watched in the menus
+const historyTimeLayout = "Jan 2 15:04"
+
+// HistoryEntry is an episode whose playback was started
+type HistoryEntry struct {
+	Slug      string    `json:"slug"`
+	Title     string    `json:"title"`
+	Episode   string    `json:"episode"`
+	Server    string    `json:"server"`
+	WatchedAt time.Time `json:"watched_at"`
+	// LastEpisode is the latest episode of the anime when the playback
+	// started, 0 when unknown
+	LastEpisode int `json:"last_episode,omitempty"`
+	// Position and Duration are in seconds, known when mpv is followed over IPC
+	Position  float64 `json:"position,omitempty"`
+	Duration  float64 `json:"duration,omitempty"`
+	Completed bool    `json:"completed,omitempty"`
+}
+
+// Resumable reports whether the episode was left halfway
+func (e HistoryEntry) Resumable() bool {
+	return e.Position > 0 && !e.Completed
+}
+
+// LatestEpisode returns the episode of the entry, ready to fetch servers for
+func (e HistoryEntry) LatestEpisode() anime.LatestEpisode {
+	return anime.LatestEpisode{Slug: e.Slug, Title: e.Title, Episode: e.Episode}
+}
+
+// Continue returns the episode to play after the entry: itself when it
+// was left halfway, the next one otherwise
+func (e HistoryEntry) Continue() anime.LatestEpisode {
+	if e.Resumable() {
+		return e.LatestEpisode()
+	}
+	return e.NextEpisode()
+}
+
+// Finished reports whether nothing is left to continue after the entry,
+// being the last episode and watched. Without a LastEpisode the anime is
+// never finished.
+func (e HistoryEntry) Finished() bool {
+	return e.LastEpisode > 0 && !e.Resumable() && episodeNumber(e.Episode) >= e.LastEpisode
+}
+
+// NextEpisode returns the episode that follows the entry
+func (e HistoryEntry) NextEpisode() anime.LatestEpisode {
+	next := e.LatestEpisode()
+	if n, err := strconv.Atoi(e.Episode); err == nil {
+		next.Episode = strconv.Itoa(n + 1)
+	}
+	return next
+}
+
+// History remembers what was played, newest first
+type History struct {
+	mu      sync.Mutex
+	path    string
+	entries []HistoryEntry
+}
+
+// NewHistory creates a history persisted at path, loading any previous
+// entries. An empty path keeps the history in memory only.
+func NewHistory(path string) *History {
+	h := &History{path: path}
+
+	if path == "" {
+		return h
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			logrus.Warnf("Error reading watch history: %v", err)
+		}
+		return h
+	}
+
+	if err := json.Unmarshal(data, &h.entries); err != nil {
+		logrus.Warnf("Error parsing watch history: %v", err)
+		h.entries = nil
+	}
+
+	return h
+}
+
+// Record adds the start of a playback and persists the history
+func (h *History) Record(entry HistoryEntry) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if entry.WatchedAt.IsZero() {
+		entry.WatchedAt = time.Now()
+	}
+
+	h.entries = append([]HistoryEntry{entry}, h.entries...)
+	if len(h.entries) > maxHistoryEntries {
+		h.entries = h.entries[:maxHistoryEntries]
+	}
+
+	if err := h.save(); err != nil {
+		logrus.Warnf("Error saving watch history: %v", err)
+	}
+}
+
+// Last returns the latest playback of an episode
+func (h *History) Last(slug, episode string) (HistoryEntry, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, entry := range h.entries {
+		if entry.Slug == slug && entry.Episode == episode {
+			return entry, true
+		}
+	}
+	return HistoryEntry{}, false
+}
+
+// SaveProgress stores the position of the latest playback of an episode,
+// which counts as watched once it played to the end or nearly so
+func (h *History) SaveProgress(slug, episode string, position, duration float64, ended bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i := range h.entries {
+		entry := &h.entries[i]
+		if entry.Slug != slug || entry.Episode != episode {
+			continue
+		}
+
+		entry.Position = position
+		if duration > 0 {
+			entry.Duration = duration
+		}
+		// Seeking back doesn't make an episode unwatched
+		entry.Completed = entry.Completed || ended ||
+			(entry.Duration > 0 && entry.Position >= entry.Duration*progress.CompletedRatio)
+
+		if err := h.save(); err != nil {
+			logrus.Warnf("Error saving watch history: %v", err)
+		}
+		return
+	}
+}
+
+// Entries returns every playback, newest first
+func (h *History) Entries() []HistoryEntry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	entries := make([]HistoryEntry, len(h.entries))
+	copy(entries, h.entries)
+	return entries
+}
+
+// ContinueWatching returns the furthest episode played of every anime,
+// most recently watched anime first, leaving out the Finished ones. Use
+// Continue on the entries to know what to play.
+func (h *History) ContinueWatching() []HistoryEntry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	index := make(map[string]int)
+	var furthest []HistoryEntry
+	for _, entry := range h.entries {
+		i, seen := index[entry.Slug]
+		if !seen {
+			index[entry.Slug] = len(furthest)
+			furthest = append(furthest, entry)
+			continue
+		}
+
+		// Rewatching an earlier episode doesn't move the anime back
+		lastEpisode := max(entry.LastEpisode, furthest[i].LastEpisode)
+		if episodeNumber(entry.Episode) > episodeNumber(furthest[i].Episode) {
+			furthest[i] = entry
+		}
+		furthest[i].LastEpisode = lastEpisode
+	}
+
+	unfinished := furthest[:0]
+	for _, entry := range furthest {
+		if !entry.Finished() {
+			unfinished = append(unfinished, entry)
+		}
+	}
+	return unfinished
+}
+
+// LastEpisode returns the latest episode of the anime known from its
+// playbacks, 0 when unknown
+func (h *History) LastEpisode(slug string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	lastEpisode := 0
+	for _, entry := range h.entries {
+		if entry.Slug == slug {
+			lastEpisode = max(lastEpisode, entry.LastEpisode)
+		}
+	}
+	return lastEpisode
+}
+
+func (h *History) save() error {
+	if h.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(h.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(h.path), 0o755); err != nil {
+		return err
+	}
+
+	tmp := h.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, h.path)
+}
+
+func episodeNumber(episode string) int {
+	n, _ := strconv.Atoi(episode)
+	return n
+}
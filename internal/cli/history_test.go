@@ -0,0 +1,207 @@
+package cli
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+	"yokai/internal/anime"
+)
+
+func TestHistoryRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "okarun", "history.json")
+	watchedAt := time.Date(2024, 5, 1, 20, 0, 0, 0, time.UTC)
+
+	history := NewHistory(path)
+	history.Record(HistoryEntry{Slug: "dandadan", Title: "Dandadan", Episode: "3", Server: "Mega", WatchedAt: watchedAt})
+	history.SaveProgress("dandadan", "3", 600, 1400, false)
+
+	entries := NewHistory(path).Entries()
+	if len(entries) != 1 {
+		t.Fatalf("got %d entries after reloading, want 1", len(entries))
+	}
+	want := HistoryEntry{
+		Slug: "dandadan", Title: "Dandadan", Episode: "3", Server: "Mega",
+		WatchedAt: watchedAt, Position: 600, Duration: 1400,
+	}
+	if got := entries[0]; !got.WatchedAt.Equal(want.WatchedAt) || got.Slug != want.Slug ||
+		got.Title != want.Title || got.Episode != want.Episode || got.Server != want.Server ||
+		got.Position != want.Position || got.Duration != want.Duration || got.Completed {
+		t.Errorf("reloaded entry = %+v, want %+v", got, want)
+	}
+}
+
+func TestHistoryInMemory(t *testing.T) {
+	history := NewHistory("")
+	history.Record(HistoryEntry{Slug: "dandadan", Episode: "1"})
+
+	if entry, ok := history.Last("dandadan", "1"); !ok || entry.WatchedAt.IsZero() {
+		t.Errorf("Last = %+v, %v, want the entry with its watch time", entry, ok)
+	}
+}
+
+func TestSaveProgress(t *testing.T) {
+	tests := []struct {
+		name      string
+		saves     [][2]float64
+		ended     bool
+		completed bool
+		resumable bool
+	}{
+		{name: "halfway", saves: [][2]float64{{600, 1400}}, resumable: true},
+		{name: "nearly to the end", saves: [][2]float64{{1300, 1400}}, completed: true},
+		{name: "ended", saves: [][2]float64{{200, 0}}, ended: true, completed: true},
+		{name: "seeking back", saves: [][2]float64{{1300, 1400}, {100, 1400}}, completed: true},
+		{name: "duration kept", saves: [][2]float64{{600, 1400}, {1300, 0}}, completed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			history := NewHistory("")
+			history.Record(HistoryEntry{Slug: "dandadan", Episode: "1"})
+			for i, save := range tt.saves {
+				history.SaveProgress("dandadan", "1", save[0], save[1], tt.ended && i == len(tt.saves)-1)
+			}
+
+			entry, _ := history.Last("dandadan", "1")
+			if entry.Completed != tt.completed {
+				t.Errorf("Completed = %v, want %v", entry.Completed, tt.completed)
+			}
+			if entry.Resumable() != tt.resumable {
+				t.Errorf("Resumable = %v, want %v", entry.Resumable(), tt.resumable)
+			}
+		})
+	}
+}
+
+func TestSaveProgressLatestPlayback(t *testing.T) {
+	history := NewHistory("")
+	history.Record(HistoryEntry{Slug: "dandadan", Episode: "1", Server: "Mega"})
+	history.Record(HistoryEntry{Slug: "dandadan", Episode: "1", Server: "Streamwish"})
+	history.SaveProgress("dandadan", "1", 600, 1400, false)
+	history.SaveProgress("dandadan", "9", 600, 1400, false)
+
+	entries := history.Entries()
+	if entries[0].Position != 600 || entries[1].Position != 0 {
+		t.Errorf("positions = %v, %v, want only the latest playback saved", entries[0].Position, entries[1].Position)
+	}
+}
+
+func TestContinueWatching(t *testing.T) {
+	tests := []struct {
+		name         string
+		lastEpisodes map[string]int
+		want         []string
+		next         []string
+	}{
+		{
+			name: "counts unknown",
+			want: []string{"dandadan", "sakamoto", "frieren"},
+			next: []string{"3", "4", "29"},
+		},
+		{
+			name:         "finished left out",
+			lastEpisodes: map[string]int{"dandadan": 12, "frieren": 28, "sakamoto": 4},
+			want:         []string{"dandadan", "sakamoto"},
+			next:         []string{"3", "4"},
+		},
+		{
+			name:         "left halfway on the last episode",
+			lastEpisodes: map[string]int{"dandadan": 2, "sakamoto": 4},
+			want:         []string{"sakamoto", "frieren"},
+			next:         []string{"4", "29"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			history := NewHistory("")
+			record := func(slug, episode string, completed bool) {
+				history.Record(HistoryEntry{Slug: slug, Title: slug, Episode: episode, LastEpisode: tt.lastEpisodes[slug]})
+				if completed {
+					history.SaveProgress(slug, episode, 1400, 1400, true)
+				}
+			}
+			record("dandadan", "1", true)
+			record("dandadan", "2", true)
+			record("frieren", "28", true)
+			record("sakamoto", "4", false)
+			history.SaveProgress("sakamoto", "4", 300, 1400, false)
+			// Rewatching an earlier episode doesn't move the anime back
+			record("dandadan", "1", true)
+
+			entries := history.ContinueWatching()
+			if len(entries) != len(tt.want) {
+				t.Fatalf("got %d entries, want %v", len(entries), tt.want)
+			}
+			for i, entry := range entries {
+				if entry.Slug != tt.want[i] {
+					t.Errorf("entry %d = %s, want %s", i, entry.Slug, tt.want[i])
+				}
+				if next := entry.Continue().Episode; next != tt.next[i] {
+					t.Errorf("%s continues with episode %s, want %s", entry.Slug, next, tt.next[i])
+				}
+			}
+		})
+	}
+}
+
+func TestContinueWatchingKeepsLatestCount(t *testing.T) {
+	// The last episode was played from the history, where the count isn't
+	// loaded, after an earlier playback learned it
+	history := NewHistory("")
+	history.Record(HistoryEntry{Slug: "frieren", Episode: "27", LastEpisode: 28})
+	history.Record(HistoryEntry{Slug: "frieren", Episode: "28"})
+	history.SaveProgress("frieren", "28", 1400, 1400, true)
+
+	if entries := history.ContinueWatching(); len(entries) != 0 {
+		t.Errorf("ContinueWatching = %+v, want frieren finished", entries)
+	}
+	if got := history.LastEpisode("frieren"); got != 28 {
+		t.Errorf("LastEpisode = %d, want 28", got)
+	}
+	if got := history.LastEpisode("dandadan"); got != 0 {
+		t.Errorf("LastEpisode of an unplayed anime = %d, want 0", got)
+	}
+}
+
+func TestLastEpisodeAtPlayback(t *testing.T) {
+	history := NewHistory("")
+	history.Record(HistoryEntry{Slug: "frieren", Episode: "1", LastEpisode: 10})
+	ep := anime.LatestEpisode{Slug: "frieren", Episode: "12"}
+
+	tests := []struct {
+		name  string
+		model Model
+		want  int
+	}{
+		{"from the history", Model{previousView: "continue"}, 10},
+		{"from the recent updates", Model{previousView: "recent"}, 12},
+		{
+			name: "from the episodes",
+			model: Model{
+				previousView:    "episodes",
+				currentAnime:    &anime.Anime{Slug: "frieren"},
+				currentEpisodes: &anime.Episode{LastEpisode: 28},
+			},
+			want: 28,
+		},
+		{
+			name: "episodes of another anime",
+			model: Model{
+				previousView:    "episodes",
+				currentAnime:    &anime.Anime{Slug: "dandadan"},
+				currentEpisodes: &anime.Episode{LastEpisode: 28},
+			},
+			want: 10,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.model.history = history
+			if got := lastEpisode(&tt.model, ep); got != tt.want {
+				t.Errorf("lastEpisode = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package cli
 
 import (
 	"yokai/internal/anime"
+	"yokai/internal/mpv"
 
 	"github.com/charmbracelet/bubbles/help"
 	"github.com/charmbracelet/bubbles/list"
@@ -31,6 +32,18 @@ type Model struct {
 	previousView    string
 	mainMenuItems   []list.Item
 	searchMode      bool
+	ranking         *anime.Ranking
+	history         *History
+	continueEntries []HistoryEntry
+	historyEntries  []HistoryEntry
+	nowPlaying      *NowPlaying
+}
+
+// NowPlaying is the episode mpv is playing, shown in the status bar
+type NowPlaying struct {
+	Episode anime.LatestEpisode
+	Status  mpv.Status
+	player  *mpv.Player
 }
 
 // MenuItem represents an item in any menu list
@@ -20,4 +20,9 @@ var (
 	// LoadingStyle defines the style for the loading spinner
 	LoadingStyle = lipgloss.NewStyle().
 			Foreground(lipgloss.Color("205"))
+
+	// StatusStyle defines the style for the now playing status bar
+	StatusStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("#8ECAE6")).
+			MarginLeft(2)
 )
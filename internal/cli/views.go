@@ -24,9 +24,37 @@ func (m Model) View() string {
 		content = m.list.View()
 	}
 
+	if m.nowPlaying != nil {
+		content += "\n" + m.nowPlaying.View()
+	}
+
 	return DocStyle.Render(content)
 }
 
+// View renders the status bar of the playing episode
+func (n NowPlaying) View() string {
+	icon := "▶"
+	if n.Status.Paused {
+		icon = "⏸"
+	}
+
+	line := fmt.Sprintf("%s %s - Episode %s  %s", icon, n.Episode.Title, n.Episode.Episode, formatSeconds(n.Status.Position))
+	if n.Status.Duration > 0 {
+		line += " / " + formatSeconds(n.Status.Duration)
+	}
+
+	return StatusStyle.Render(line)
+}
+
+// formatSeconds formats a playback position as m:ss, or h:mm:ss past an hour
+func formatSeconds(seconds float64) string {
+	total := int(seconds)
+	if total >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", total/3600, total%3600/60, total%60)
+	}
+	return fmt.Sprintf("%d:%02d", total/60, total%60)
+}
+
 // InitializeList creates and configures a new list
 func InitializeList(items []list.Item) list.Model {
 	delegate := list.NewDefaultDelegate()
@@ -45,8 +73,10 @@ func InitializeList(items []list.Item) list.Model {
 // GetMainMenuItems returns the default main menu items
 func GetMainMenuItems() []list.Item {
 	return []list.Item{
+		NewMenuItem("Continue Watching", "Play the next episode of what you were watching"),
 		NewMenuItem("Recent Updates", "See recently updated anime"),
 		NewMenuItem("Search Anime", "Search for anime titles"),
+		NewMenuItem("History", "See the episodes you played"),
 		NewMenuItem("Exit", "Exit the application"),
 	}
 }
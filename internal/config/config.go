@@ -1,17 +1,118 @@
 package config
 
-import "os"
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
 
 type Config struct {
-	Port        string
+	Port string
+	// Environment switches logs to JSON lines when set to "production"
 	Environment string
+	// LogLevel is one of trace, debug, info, warn, error, fatal or panic
+	LogLevel          string
+	DataDir           string
+	CacheDir          string
+	ImageAllowedHosts []string
+	// GraphQLMaxComplexity bounds the upstream work a single GraphQL query may trigger
+	GraphQLMaxComplexity int
+	// PollInterval is how often the latest episodes are polled, 0 disables polling
+	PollInterval     time.Duration
+	EventsBufferSize int
+	// WebhookMaxAttempts and WebhookBackoff control webhook delivery retries
+	WebhookMaxAttempts int
+	WebhookBackoff     time.Duration
+	// APIKeys holds "name:key" pairs, authentication is disabled when empty
+	APIKeys []string
+	// RateLimitCheap and RateLimitExpensive are requests per minute per client,
+	// for plain HTTP scraping routes and headless browser routes respectively
+	RateLimitCheap     int
+	RateLimitExpensive int
+	// TrustedProxies are the addresses or CIDR ranges of the reverse proxies
+	// whose X-Forwarded-For identifies clients when authentication is off
+	TrustedProxies []string
+	// ReadyTimeout bounds every readiness check, ReadyCacheTTL is how long
+	// a readiness report is reused before the checks run again
+	ReadyTimeout  time.Duration
+	ReadyCacheTTL time.Duration
+	// CORSAllowedOrigins enables CORS for these origins, "*" allows any
+	CORSAllowedOrigins []string
+	CORSAllowedMethods []string
+	CORSAllowedHeaders []string
+	RecoverPanics      bool
+	Compression        bool
+	// MaxBodyBytes limits request bodies, RequestTimeout limits the time a
+	// handler may take and stays below the server WriteTimeout so clients
+	// get an error instead of a dropped connection, 0 disables either
+	MaxBodyBytes   int
+	RequestTimeout time.Duration
+	// JobWorkers bounds the jobs running at once, JobQueueSize the jobs
+	// waiting for a worker, finished jobs are kept for JobTTL
+	JobWorkers   int
+	JobQueueSize int
+	JobTTL       time.Duration
+	// SessionTTL is how long a login lasts
+	SessionTTL time.Duration
+	// Admins are the identities allowed to use the admin API: API key
+	// names or "user:<name>"
+	Admins []string
+	// MetricsAddr serves /metrics on its own listener without
+	// authentication, meant for a private address. When empty /metrics is
+	// on the main port and only for admins.
+	MetricsAddr string
 }
 
 func New() *Config {
 	return &Config{
-		Port:        getEnvOrDefault("PORT", "5000"),
-		Environment: getEnvOrDefault("ENV", "development"),
+		Port:              getEnvOrDefault("PORT", "5000"),
+		Environment:       getEnvOrDefault("ENV", "development"),
+		LogLevel:          getEnvOrDefault("LOG_LEVEL", "info"),
+		DataDir:           getEnvOrDefault("DATA_DIR", "data"),
+		CacheDir:          getEnvOrDefault("CACHE_DIR", "cache"),
+		ImageAllowedHosts: getEnvList("IMAGE_ALLOWED_HOSTS", "jkanime.net,jkdesu.com"),
+
+		GraphQLMaxComplexity: getEnvInt("GRAPHQL_MAX_COMPLEXITY", 100),
+		PollInterval:         getEnvDuration("POLL_INTERVAL", 5*time.Minute),
+		EventsBufferSize:     getEnvInt("EVENTS_BUFFER_SIZE", 100),
+		WebhookMaxAttempts:   getEnvInt("WEBHOOK_MAX_ATTEMPTS", 5),
+		WebhookBackoff:       getEnvDuration("WEBHOOK_BACKOFF", 2*time.Second),
+		APIKeys:              getEnvList("API_KEYS", ""),
+		RateLimitCheap:       getEnvInt("RATE_LIMIT_CHEAP", 60),
+		RateLimitExpensive:   getEnvInt("RATE_LIMIT_EXPENSIVE", 10),
+		TrustedProxies:       getEnvList("TRUSTED_PROXIES", ""),
+		ReadyTimeout:         getEnvDuration("READY_TIMEOUT", 10*time.Second),
+		ReadyCacheTTL:        getEnvDuration("READY_CACHE_TTL", 15*time.Second),
+		CORSAllowedOrigins:   getEnvList("CORS_ALLOWED_ORIGINS", ""),
+		CORSAllowedMethods:   getEnvList("CORS_ALLOWED_METHODS", "GET,POST,PUT,DELETE"),
+		CORSAllowedHeaders:   getEnvList("CORS_ALLOWED_HEADERS", "Content-Type,Authorization,X-API-Key,X-Request-ID,Last-Event-ID"),
+		RecoverPanics:        getEnvBool("RECOVER_PANICS", true),
+		Compression:          getEnvBool("COMPRESSION", true),
+		MaxBodyBytes:         getEnvInt("MAX_BODY_BYTES", 1<<20),
+		RequestTimeout:       getEnvDuration("REQUEST_TIMEOUT", 9*time.Second),
+		JobWorkers:           getEnvInt("JOB_WORKERS", 2),
+		JobQueueSize:         getEnvInt("JOB_QUEUE_SIZE", 50),
+		JobTTL:               getEnvDuration("JOB_TTL", 10*time.Minute),
+		SessionTTL:           getEnvDuration("SESSION_TTL", 30*24*time.Hour),
+		Admins:               getEnvList("ADMINS", ""),
+		MetricsAddr:          getEnvOrDefault("METRICS_ADDR", ""),
+	}
+}
+
+// UserDataDir returns the XDG data directory used by the CLI
+func UserDataDir() string {
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		return filepath.Join(dir, "okarun")
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "okarun")
 	}
+
+	return filepath.Join(home, ".local", "share", "okarun")
 }
 
 func getEnvOrDefault(key, defaultValue string) string {
@@ -20,3 +121,37 @@ func getEnvOrDefault(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+func getEnvInt(key string, defaultValue int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	value, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+func getEnvList(key, defaultValue string) []string {
+	var values []string
+	for _, value := range strings.Split(getEnvOrDefault(key, defaultValue), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
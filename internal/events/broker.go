@@ -0,0 +1,184 @@
+package events
+
+import (
+	"context"
+	"sync"
+	"time"
+	"yokai/internal/anime"
+)
+
+// EventNewEpisode is the type of the event published for a new release
+const EventNewEpisode = "episode"
+
+// subscriberBuffer is how many events a slow subscriber may lag behind
+// before it gets disconnected
+const subscriberBuffer = 16
+
+// Event is a newly released episode
+type Event struct {
+	ID      uint64              `json:"id"`
+	Type    string              `json:"type"`
+	Time    time.Time           `json:"time"`
+	Episode anime.LatestEpisode `json:"episode"`
+}
+
+// Broker fans events out to subscribers and keeps the most recent ones in
+// a bounded ring buffer so reconnecting clients can catch up
+type Broker struct {
+	mu     sync.Mutex
+	lastID uint64
+	ring   []Event
+	next   int
+	full   bool
+	subs   map[chan Event]struct{}
+	closed bool
+}
+
+// NewBroker creates a broker that remembers the last size events
+func NewBroker(size int) *Broker {
+	if size < 1 {
+		size = 1
+	}
+	return &Broker{
+		// IDs count up from the boot time in microseconds, so they keep
+		// growing across restarts and an ID of the previous run replays
+		// every event of this one instead of skipping them
+		lastID: uint64(time.Now().UnixMicro()),
+		ring:   make([]Event, size),
+		subs:   make(map[chan Event]struct{}),
+	}
+}
+
+// Publish records a new episode and delivers it to every subscriber
+func (b *Broker) Publish(episode anime.LatestEpisode) Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastID++
+	event := Event{
+		ID:      b.lastID,
+		Type:    EventNewEpisode,
+		Time:    time.Now().UTC(),
+		Episode: episode,
+	}
+
+	b.ring[b.next] = event
+	b.next = (b.next + 1) % len(b.ring)
+	if b.next == 0 {
+		b.full = true
+	}
+
+	for ch := range b.subs {
+		select {
+		case ch <- event:
+		default:
+			// The subscriber can't keep up, it can reconnect with Last-Event-ID
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+
+	return event
+}
+
+// Subscribe returns the buffered events newer than lastID and a channel
+// receiving every event published afterwards. The channel is closed when
+// the broker shuts down or the subscriber falls too far behind. A lastID
+// of 0 skips the replay, an unknown lastID replays the whole buffer.
+func (b *Broker) Subscribe(lastID uint64) ([]Event, <-chan Event, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan Event, subscriberBuffer)
+	if b.closed {
+		close(ch)
+		return nil, ch, func() {}
+	}
+	b.subs[ch] = struct{}{}
+
+	var replay []Event
+	if lastID > 0 {
+		if lastID > b.lastID {
+			lastID = 0
+		}
+		for _, event := range b.buffered() {
+			if event.ID > lastID {
+				replay = append(replay, event)
+			}
+		}
+	}
+
+	cancel := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subs[ch]; ok {
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+
+	return replay, ch, cancel
+}
+
+// Follow calls handle with every event published on the broker until ctx
+// is cancelled. When the broker drops it, it subscribes again and catches
+// up on the events it missed.
+func Follow(ctx context.Context, b *Broker, handle func(Event)) {
+	var lastID uint64
+
+	for ctx.Err() == nil {
+		replay, stream, cancel := b.Subscribe(lastID)
+		for _, event := range replay {
+			handle(event)
+			lastID = event.ID
+		}
+
+		for open := true; open; {
+			select {
+			case <-ctx.Done():
+				cancel()
+				return
+			case event, ok := <-stream:
+				if !ok {
+					open = false
+					break
+				}
+				handle(event)
+				lastID = event.ID
+			}
+		}
+		cancel()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// Recent returns the buffered events, oldest first
+func (b *Broker) Recent() []Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buffered()
+}
+
+// Close disconnects every subscriber
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for ch := range b.subs {
+		delete(b.subs, ch)
+		close(ch)
+	}
+}
+
+func (b *Broker) buffered() []Event {
+	if !b.full {
+		return append([]Event(nil), b.ring[:b.next]...)
+	}
+	return append(append([]Event(nil), b.ring[b.next:]...), b.ring[:b.next]...)
+}
@@ -0,0 +1,141 @@
+package events
+
+import (
+	"strconv"
+	"testing"
+	"time"
+	"yokai/internal/anime"
+)
+
+// publish publishes n episodes and returns their events
+func publish(b *Broker, n int) []Event {
+	events := make([]Event, n)
+	for i := range events {
+		events[i] = b.Publish(anime.LatestEpisode{Slug: "dandadan", Episode: strconv.Itoa(i + 1)})
+	}
+	return events
+}
+
+func ids(events []Event) []uint64 {
+	ids := make([]uint64, len(events))
+	for i, event := range events {
+		ids[i] = event.ID
+	}
+	return ids
+}
+
+func equalIDs(a, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestIDsGrowAcrossRestarts(t *testing.T) {
+	previous := publish(NewBroker(10), 3)
+	time.Sleep(2 * time.Millisecond)
+	next := publish(NewBroker(10), 1)
+
+	if next[0].ID <= previous[2].ID {
+		t.Errorf("first ID after a restart %d, want above %d", next[0].ID, previous[2].ID)
+	}
+	for i := 1; i < len(previous); i++ {
+		if previous[i].ID != previous[i-1].ID+1 {
+			t.Errorf("IDs %v aren't consecutive", ids(previous))
+			break
+		}
+	}
+}
+
+func TestRingWrapsAround(t *testing.T) {
+	b := NewBroker(3)
+
+	published := publish(b, 2)
+	if got, want := ids(b.Recent()), ids(published); !equalIDs(got, want) {
+		t.Errorf("Recent = %v, want %v", got, want)
+	}
+
+	published = append(published, publish(b, 5)...)
+	if got, want := ids(b.Recent()), ids(published[4:]); !equalIDs(got, want) {
+		t.Errorf("Recent after wrapping = %v, want the last 3 %v", got, want)
+	}
+}
+
+func TestSubscribeReplay(t *testing.T) {
+	b := NewBroker(4)
+	published := publish(b, 6)
+	buffered := ids(published[2:])
+
+	tests := []struct {
+		name   string
+		lastID uint64
+		want   []uint64
+	}{
+		{name: "no Last-Event-ID", lastID: 0, want: nil},
+		{name: "missed events", lastID: published[3].ID, want: ids(published[4:])},
+		{name: "up to date", lastID: published[5].ID, want: nil},
+		{name: "older than the buffer", lastID: published[0].ID, want: buffered},
+		{name: "previous run", lastID: 1, want: buffered},
+		{name: "unknown", lastID: published[5].ID + 100, want: buffered},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			replay, _, cancel := b.Subscribe(tt.lastID)
+			defer cancel()
+
+			if got := ids(replay); !equalIDs(got, tt.want) {
+				t.Errorf("replay = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSlowSubscriberDropped(t *testing.T) {
+	b := NewBroker(100)
+	_, slow, cancelSlow := b.Subscribe(0)
+	defer cancelSlow()
+	_, fast, cancelFast := b.Subscribe(0)
+	defer cancelFast()
+
+	for range subscriberBuffer + 1 {
+		event := publish(b, 1)[0]
+		if got := <-fast; got.ID != event.ID {
+			t.Fatalf("fast subscriber got %d, want %d", got.ID, event.ID)
+		}
+	}
+
+	received := 0
+	for range slow {
+		received++
+	}
+	if received != subscriberBuffer {
+		t.Errorf("slow subscriber got %d events before being dropped, want %d", received, subscriberBuffer)
+	}
+
+	event := publish(b, 1)[0]
+	if got, ok := <-fast; !ok || got.ID != event.ID {
+		t.Errorf("fast subscriber got %d, %v after the slow one was dropped", got.ID, ok)
+	}
+}
+
+func TestClose(t *testing.T) {
+	b := NewBroker(10)
+	_, stream, cancel := b.Subscribe(0)
+	defer cancel()
+
+	b.Close()
+	if _, ok := <-stream; ok {
+		t.Error("subscription still open after Close")
+	}
+
+	_, stream, _ = b.Subscribe(0)
+	if _, ok := <-stream; ok {
+		t.Error("subscription opened after Close")
+	}
+}
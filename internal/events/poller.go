@@ -0,0 +1,96 @@
+package events
+
+import (
+	"context"
+	"sync"
+	"time"
+	"yokai/internal/anime"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Poller periodically fetches the latest episodes and publishes the ones
+// that were not part of the previous snapshot
+type Poller struct {
+	scraper  anime.Jkanime
+	interval time.Duration
+	broker   *Broker
+
+	mu       sync.RWMutex
+	snapshot []anime.LatestEpisode
+	seeded   bool
+}
+
+func NewPoller(scraper anime.Jkanime, interval time.Duration, broker *Broker) *Poller {
+	return &Poller{
+		scraper:  scraper,
+		interval: interval,
+		broker:   broker,
+	}
+}
+
+// Run polls until ctx is cancelled. The first poll only seeds the snapshot
+// so a restart doesn't announce the whole front page as new.
+func (p *Poller) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		p.Poll(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll fetches the latest episodes once and publishes the new ones
+func (p *Poller) Poll(ctx context.Context) {
+	latest, err := p.scraper.WithContext(ctx).GetLatestEpisodes()
+	if err != nil {
+		logrus.Errorf("Error polling latest episodes: %v", err)
+		return
+	}
+
+	// An empty front page means a scrape problem, keep the previous snapshot
+	// so the next successful poll doesn't announce everything as new
+	if len(latest) == 0 {
+		logrus.Warn("Polling latest episodes returned no episodes")
+		return
+	}
+
+	p.mu.Lock()
+	previous := make(map[string]bool, len(p.snapshot))
+	for _, episode := range p.snapshot {
+		previous[episodeKey(episode)] = true
+	}
+	seeded := p.seeded
+	p.snapshot = latest
+	p.seeded = true
+	p.mu.Unlock()
+
+	if !seeded {
+		return
+	}
+
+	// The front page lists newest first, publish oldest first
+	for i := len(latest) - 1; i >= 0; i-- {
+		if !previous[episodeKey(latest[i])] {
+			event := p.broker.Publish(latest[i])
+			logrus.Infof("New episode released: %s episode %s (event %d)", latest[i].Slug, latest[i].Episode, event.ID)
+		}
+	}
+}
+
+// Snapshot returns the episodes seen by the last successful poll
+func (p *Poller) Snapshot() []anime.LatestEpisode {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return append([]anime.LatestEpisode(nil), p.snapshot...)
+}
+
+func episodeKey(episode anime.LatestEpisode) string {
+	return episode.Slug + "/" + episode.Episode
+}
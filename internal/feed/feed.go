@@ -0,0 +1,314 @@
+package feed
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Feed is a format independent description of a feed
+type Feed struct {
+	Title       string
+	Link        string
+	SelfURL     string
+	Description string
+	ImageURL    string
+	Items       []Item
+}
+
+// Item is a single feed entry
+type Item struct {
+	GUID      string
+	Title     string
+	Link      string
+	Summary   string
+	ImageURL  string
+	Published time.Time
+}
+
+// Updated returns the publication time of the newest item
+func (f Feed) Updated() time.Time {
+	var updated time.Time
+	for _, item := range f.Items {
+		if item.Published.After(updated) {
+			updated = item.Published
+		}
+	}
+	return updated
+}
+
+type rss struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	AtomNS  string     `xml:"xmlns:atom,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	AtomLink      atomLink  `xml:"atom:link"`
+	Image         *rssImage `xml:"image,omitempty"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssImage struct {
+	URL   string `xml:"url"`
+	Title string `xml:"title"`
+	Link  string `xml:"link"`
+}
+
+type rssItem struct {
+	Title       string        `xml:"title"`
+	Link        string        `xml:"link"`
+	Description string        `xml:"description,omitempty"`
+	GUID        rssGUID       `xml:"guid"`
+	PubDate     string        `xml:"pubDate"`
+	Enclosure   *rssEnclosure `xml:"enclosure,omitempty"`
+}
+
+type rssGUID struct {
+	IsPermaLink string `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int    `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+// RSS renders the feed as RSS 2.0
+func (f Feed) RSS() ([]byte, error) {
+	channel := rssChannel{
+		Title:       f.Title,
+		Link:        f.Link,
+		Description: f.Description,
+		AtomLink:    atomLink{Href: f.SelfURL, Rel: "self", Type: "application/rss+xml"},
+	}
+	if updated := f.Updated(); !updated.IsZero() {
+		channel.LastBuildDate = updated.Format(time.RFC1123Z)
+	}
+	if f.ImageURL != "" {
+		channel.Image = &rssImage{URL: f.ImageURL, Title: f.Title, Link: f.Link}
+	}
+
+	for _, item := range f.Items {
+		entry := rssItem{
+			Title:       item.Title,
+			Link:        item.Link,
+			Description: item.Summary,
+			GUID:        rssGUID{IsPermaLink: "false", Value: item.GUID},
+			PubDate:     item.Published.Format(time.RFC1123Z),
+		}
+		if item.ImageURL != "" {
+			entry.Enclosure = &rssEnclosure{URL: item.ImageURL, Type: imageType(item.ImageURL)}
+		}
+		channel.Items = append(channel.Items, entry)
+	}
+
+	return marshal(rss{
+		Version: "2.0",
+		AtomNS:  "http://www.w3.org/2005/Atom",
+		Channel: channel,
+	})
+}
+
+type atom struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Logo    string      `xml:"logo,omitempty"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID      string     `xml:"id"`
+	Title   string     `xml:"title"`
+	Updated string     `xml:"updated"`
+	Links   []atomLink `xml:"link"`
+	Summary string     `xml:"summary,omitempty"`
+}
+
+// Atom renders the feed as Atom 1.0
+func (f Feed) Atom() ([]byte, error) {
+	updated := f.Updated()
+	if updated.IsZero() {
+		updated = time.Now()
+	}
+
+	doc := atom{
+		ID:      f.SelfURL,
+		Title:   f.Title,
+		Updated: updated.UTC().Format(time.RFC3339),
+		Links: []atomLink{
+			{Href: f.Link, Rel: "alternate"},
+			{Href: f.SelfURL, Rel: "self", Type: "application/atom+xml"},
+		},
+		Logo: f.ImageURL,
+	}
+
+	for _, item := range f.Items {
+		entry := atomEntry{
+			ID:      "urn:" + item.GUID,
+			Title:   item.Title,
+			Updated: item.Published.UTC().Format(time.RFC3339),
+			Links:   []atomLink{{Href: item.Link, Rel: "alternate"}},
+			Summary: item.Summary,
+		}
+		if item.ImageURL != "" {
+			entry.Links = append(entry.Links, atomLink{Href: item.ImageURL, Rel: "enclosure", Type: imageType(item.ImageURL)})
+		}
+		doc.Entries = append(doc.Entries, entry)
+	}
+
+	return marshal(doc)
+}
+
+func marshal(v any) ([]byte, error) {
+	body, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
+
+func imageType(url string) string {
+	switch {
+	case strings.HasSuffix(url, ".png"):
+		return "image/png"
+	case strings.HasSuffix(url, ".webp"):
+		return "image/webp"
+	case strings.HasSuffix(url, ".gif"):
+		return "image/gif"
+	}
+	return "image/jpeg"
+}
+
+// maxTracked bounds how many items a Tracker remembers
+const maxTracked = 5000
+
+// Tracker remembers when each item was first seen. Upstream pages carry
+// no release dates, so this is what feeds use as publication time.
+type Tracker struct {
+	mu    sync.Mutex
+	path  string
+	seen  map[string]time.Time
+	dirty bool
+}
+
+// NewTracker creates a tracker persisted at path, loading the items seen
+// before so publication times survive restarts. An empty path keeps them
+// in memory only.
+func NewTracker(path string) *Tracker {
+	t := &Tracker{
+		path: path,
+		seen: make(map[string]time.Time),
+	}
+
+	if path == "" {
+		return t
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			logrus.Warnf("Error reading feed tracker: %v", err)
+		}
+		return t
+	}
+
+	if err := json.Unmarshal(data, &t.seen); err != nil {
+		logrus.Warnf("Error parsing feed tracker: %v", err)
+		t.seen = make(map[string]time.Time)
+	}
+
+	return t
+}
+
+// Seen returns when guid was first seen, recording now if it is new
+func (t *Tracker) Seen(guid string) time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if seen, ok := t.seen[guid]; ok {
+		return seen
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	t.seen[guid] = now
+	t.dirty = true
+	if len(t.seen) > maxTracked {
+		t.prune()
+	}
+	return now
+}
+
+// Save persists the items seen since the last save, call it once a feed
+// is built rather than for every item
+func (t *Tracker) Save() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.path == "" || !t.dirty {
+		return nil
+	}
+
+	data, err := json.Marshal(t.seen)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(t.path), 0o755); err != nil {
+		return err
+	}
+
+	tmp := t.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, t.path); err != nil {
+		return err
+	}
+
+	t.dirty = false
+	return nil
+}
+
+// prune forgets the oldest items until only half of the limit remains
+func (t *Tracker) prune() {
+	type entry struct {
+		guid string
+		seen time.Time
+	}
+
+	entries := make([]entry, 0, len(t.seen))
+	for guid, seen := range t.seen {
+		entries = append(entries, entry{guid, seen})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].seen.Before(entries[j].seen)
+	})
+
+	for _, e := range entries[:len(entries)-maxTracked/2] {
+		delete(t.seen, e.guid)
+	}
+}
@@ -0,0 +1,117 @@
+package graph
+
+import (
+	"fmt"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+)
+
+// fieldCost is the weight of resolving a field once. Multiplier estimates
+// how many items a list field returns, so nested selections under it are
+// counted once per item.
+type fieldCost struct {
+	Cost       int
+	Multiplier int
+}
+
+// costs lists the fields that hit upstream. Colly backed fields cost 1,
+// fields that start a headless browser cost 5.
+var costs = map[string]fieldCost{
+	"Query.latest":          {Cost: 1, Multiplier: 30},
+	"Query.search":          {Cost: 1, Multiplier: 1},
+	"Query.anime":           {Cost: 1, Multiplier: 1},
+	"SearchResult.results":  {Cost: 0, Multiplier: 20},
+	"Anime.episodes":        {Cost: 5, Multiplier: 1},
+	"EpisodePage.episodes":  {Cost: 0, Multiplier: 12},
+	"LatestEpisode.anime":   {Cost: 1, Multiplier: 1},
+	"LatestEpisode.servers": {Cost: 5, Multiplier: 8},
+	"Server.stream":         {Cost: 5, Multiplier: 1},
+}
+
+// Complexity estimates the upstream work a query would trigger
+func Complexity(schema graphql.Schema, query string) (int, error) {
+	doc, err := parser.Parse(parser.ParseParams{Source: query})
+	if err != nil {
+		return 0, err
+	}
+
+	fragments := make(map[string]*ast.FragmentDefinition)
+	for _, definition := range doc.Definitions {
+		if fragment, ok := definition.(*ast.FragmentDefinition); ok {
+			fragments[fragment.Name.Value] = fragment
+		}
+	}
+
+	total := 0
+	for _, definition := range doc.Definitions {
+		operation, ok := definition.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+
+		root := schema.QueryType()
+		if operation.Operation != ast.OperationTypeQuery {
+			return 0, fmt.Errorf("unsupported operation %q", operation.Operation)
+		}
+
+		total += selectionCost(root, operation.SelectionSet, fragments, map[string]bool{})
+	}
+
+	return total, nil
+}
+
+func selectionCost(parent *graphql.Object, set *ast.SelectionSet, fragments map[string]*ast.FragmentDefinition, visiting map[string]bool) int {
+	if set == nil || parent == nil {
+		return 0
+	}
+
+	total := 0
+	for _, selection := range set.Selections {
+		switch node := selection.(type) {
+		case *ast.Field:
+			field, ok := parent.Fields()[node.Name.Value]
+			if !ok {
+				continue
+			}
+
+			cost := costs[parent.Name()+"."+node.Name.Value]
+			if cost.Multiplier == 0 {
+				cost.Multiplier = 1
+			}
+
+			child := selectionCost(objectType(field.Type), node.SelectionSet, fragments, visiting)
+			total += cost.Cost + cost.Multiplier*child
+		case *ast.InlineFragment:
+			total += selectionCost(parent, node.SelectionSet, fragments, visiting)
+		case *ast.FragmentSpread:
+			name := node.Name.Value
+			fragment, ok := fragments[name]
+			if !ok || visiting[name] {
+				continue
+			}
+			visiting[name] = true
+			total += selectionCost(parent, fragment.SelectionSet, fragments, visiting)
+			delete(visiting, name)
+		}
+	}
+
+	return total
+}
+
+// objectType unwraps lists and non-nulls down to the object type, if any
+func objectType(t graphql.Output) *graphql.Object {
+	for {
+		switch wrapped := t.(type) {
+		case *graphql.NonNull:
+			t = wrapped.OfType
+		case *graphql.List:
+			t = wrapped.OfType
+		case *graphql.Object:
+			return wrapped
+		default:
+			return nil
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package graph
+
+import (
+	"testing"
+	"yokai/internal/anime"
+)
+
+func TestComplexity(t *testing.T) {
+	schema, err := NewSchema(anime.Jkanime{})
+	if err != nil {
+		t.Fatalf("NewSchema: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  int
+	}{
+		{
+			name:  "scalar fields are free",
+			query: `{ latest { title episode } }`,
+			want:  1,
+		},
+		{
+			name:  "list multiplies nested fields",
+			query: `{ latest { servers { server } } }`,
+			want:  1 + 30*5,
+		},
+		{
+			name:  "nested lists multiply",
+			query: `{ latest { servers { stream } } }`,
+			want:  1 + 30*(5+8*5),
+		},
+		{
+			name:  "lists without cost",
+			query: `{ search(name: "dandadan") { results { episodes { episodes { servers { server } } } } } }`,
+			want:  1 + 20*(5+12*5),
+		},
+		{
+			name:  "single episode",
+			query: `{ anime(slug: "dandadan") { title episode(number: 1) { servers { stream } } } }`,
+			want:  1 + 5 + 8*5,
+		},
+		{
+			name:  "fragments",
+			query: `{ latest { ...details } } fragment details on LatestEpisode { anime { title } }`,
+			want:  1 + 30*1,
+		},
+		{
+			name:  "recursive fragments counted once",
+			query: `{ latest { ...details } } fragment details on LatestEpisode { anime { title } ...details }`,
+			want:  1 + 30*1,
+		},
+		{
+			name:  "inline fragments",
+			query: `{ latest { ... on LatestEpisode { servers { server } } } }`,
+			want:  1 + 30*5,
+		},
+		{
+			name:  "unknown fields are ignored",
+			query: `{ latest { unknown { servers { server } } } }`,
+			want:  1,
+		},
+		{
+			name:  "operations add up",
+			query: `query a { latest { title } } query b { anime(slug: "dandadan") { title } }`,
+			want:  2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Complexity(schema, tt.query)
+			if err != nil {
+				t.Fatalf("Complexity: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Complexity = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestComplexityErrors(t *testing.T) {
+	schema, err := NewSchema(anime.Jkanime{})
+	if err != nil {
+		t.Fatalf("NewSchema: %v", err)
+	}
+
+	for _, query := range []string{
+		`{ latest { title }`,
+		`mutation { latest { title } }`,
+		`subscription { latest { title } }`,
+	} {
+		if _, err := Complexity(schema, query); err == nil {
+			t.Errorf("Complexity(%q) succeeded, want an error", query)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package graph
+
+import (
+	"strconv"
+	"yokai/internal/anime"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// jsonScalar passes free-form values such as Anime.AdditionalInfo through untouched
+var jsonScalar = graphql.NewScalar(graphql.ScalarConfig{
+	Name:        "JSON",
+	Description: "Arbitrary JSON value",
+	Serialize:   func(value interface{}) interface{} { return value },
+	ParseValue:  func(value interface{}) interface{} { return value },
+	ParseLiteral: func(valueAST ast.Value) interface{} {
+		return valueAST.GetValue()
+	},
+})
+
+// NewSchema builds the GraphQL schema over the anime data model. Nested
+// fields are resolved lazily, so a browser session is only started when a
+// query actually selects a field that needs one.
+func NewSchema(scraper anime.Jkanime) (graphql.Schema, error) {
+	serverType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Server",
+		Fields: graphql.Fields{
+			"server": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"remote": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"stream": &graphql.Field{
+				Type:        graphql.String,
+				Description: "Resolved stream URL, starts a headless browser",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					server := p.Source.(anime.Server)
+					return scraper.WithContext(p.Context).GetStreaming(server.Server, server.Remote)
+				},
+			},
+		},
+	})
+
+	animeType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Anime",
+		Fields: graphql.Fields{
+			"slug":     &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"title":    &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"img":      &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"synopsis": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"additionalInfo": &graphql.Field{
+				Type: jsonScalar,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(*anime.Anime).AdditionalInfo, nil
+				},
+			},
+		},
+	})
+
+	latestEpisodeType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "LatestEpisode",
+		Fields: graphql.Fields{
+			"slug":    &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"img":     &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"title":   &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"episode": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"anime": &graphql.Field{
+				Type: animeType,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return getAnime(scraper.WithContext(p.Context), p.Source.(anime.LatestEpisode).Slug)
+				},
+			},
+			"servers": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(serverType))),
+				Description: "Stream servers, starts a headless browser",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					episode := p.Source.(anime.LatestEpisode)
+					servers, err := scraper.WithContext(p.Context).GetServers(episode.Slug, episode.Episode)
+					if err != nil {
+						return nil, err
+					}
+					// The list is non-null, an episode without servers is empty
+					if servers == nil {
+						servers = []anime.Server{}
+					}
+					return servers, nil
+				},
+			},
+		},
+	})
+
+	episodePageType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "EpisodePage",
+		Fields: graphql.Fields{
+			"page": &graphql.Field{
+				Type:    graphql.NewNonNull(graphql.Int),
+				Resolve: episodeField(func(e *anime.Episode) interface{} { return e.Page }),
+			},
+			"totalPages": &graphql.Field{
+				Type:    graphql.NewNonNull(graphql.Int),
+				Resolve: episodeField(func(e *anime.Episode) interface{} { return e.TotalPages }),
+			},
+			"totalEpisodes": &graphql.Field{
+				Type:    graphql.NewNonNull(graphql.Int),
+				Resolve: episodeField(func(e *anime.Episode) interface{} { return e.TotalEpisodes }),
+			},
+			"lastEpisode": &graphql.Field{
+				Type:    graphql.NewNonNull(graphql.Int),
+				Resolve: episodeField(func(e *anime.Episode) interface{} { return e.LastEpisode }),
+			},
+			"hasNext": &graphql.Field{
+				Type:    graphql.NewNonNull(graphql.Boolean),
+				Resolve: episodeField(func(e *anime.Episode) interface{} { return e.Page < e.TotalPages }),
+			},
+			"episodes": &graphql.Field{
+				Type:    graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(latestEpisodeType))),
+				Resolve: episodeField(func(e *anime.Episode) interface{} { return e.Episodes }),
+			},
+		},
+	})
+
+	// Fields referencing types declared after Anime
+	animeType.AddFieldConfig("episodes", &graphql.Field{
+		Type:        graphql.NewNonNull(episodePageType),
+		Description: "One page of episodes, starts a headless browser",
+		Args: graphql.FieldConfigArgument{
+			"page": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 1},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return scraper.WithContext(p.Context).GetEpisodes(p.Source.(*anime.Anime).Slug, p.Args["page"].(int))
+		},
+	})
+	animeType.AddFieldConfig("episode", &graphql.Field{
+		Type:        graphql.NewNonNull(latestEpisodeType),
+		Description: "A single episode, without fetching the episode list",
+		Args: graphql.FieldConfigArgument{
+			"number": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			details := p.Source.(*anime.Anime)
+			return anime.LatestEpisode{
+				Slug:    details.Slug,
+				Img:     details.Img,
+				Title:   details.Title,
+				Episode: strconv.Itoa(p.Args["number"].(int)),
+			}, nil
+		},
+	})
+
+	searchResultType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "SearchResult",
+		Fields: graphql.Fields{
+			"page": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"hasNext": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.Boolean),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(*anime.SearchResult).HasNext, nil
+				},
+			},
+			"results": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(animeType))),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					results := p.Source.(*anime.SearchResult).Results
+					animes := make([]*anime.Anime, len(results))
+					for i := range results {
+						animes[i] = &results[i]
+					}
+					return animes, nil
+				},
+			},
+		},
+	})
+
+	queryType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"latest": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(latestEpisodeType))),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return scraper.WithContext(p.Context).GetLatestEpisodes()
+				},
+			},
+			"search": &graphql.Field{
+				Type: graphql.NewNonNull(searchResultType),
+				Args: graphql.FieldConfigArgument{
+					"name": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+					"page": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 1},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return scraper.WithContext(p.Context).GetSearchResults(p.Args["name"].(string), p.Args["page"].(int))
+				},
+			},
+			"anime": &graphql.Field{
+				Type: animeType,
+				Args: graphql.FieldConfigArgument{
+					"slug": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return getAnime(scraper.WithContext(p.Context), p.Args["slug"].(string))
+				},
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: queryType})
+}
+
+// getAnime fetches anime details, filling in the slug the scraper leaves empty
+func getAnime(scraper anime.Jkanime, slug string) (*anime.Anime, error) {
+	details, err := scraper.GetAnime(slug)
+	if err != nil {
+		return nil, err
+	}
+	details.Slug = slug
+	return details, nil
+}
+
+func episodeField(get func(*anime.Episode) interface{}) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		return get(p.Source.(*anime.Episode)), nil
+	}
+}
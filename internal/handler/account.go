@@ -0,0 +1,207 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"yokai/internal/auth"
+	"yokai/internal/users"
+)
+
+type AccountHandler struct {
+	users      *users.Store
+	sessionTTL time.Duration
+}
+
+func NewAccountHandler(users *users.Store, sessionTTL time.Duration) *AccountHandler {
+	return &AccountHandler{
+		users:      users,
+		sessionTTL: sessionTTL,
+	}
+}
+
+type loginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// createUserRequest is the account an admin adds
+type createUserRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// loginResponse carries the bearer token of a new session
+type loginResponse struct {
+	Token     string     `json:"token"`
+	TokenType string     `json:"token_type"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	User      users.User `json:"user"`
+}
+
+// me describes the calling client
+type me struct {
+	Identity string      `json:"identity"`
+	User     *users.User `json:"user,omitempty"`
+}
+
+// Login exchanges a username and password for a bearer token
+func (h *AccountHandler) Login(w http.ResponseWriter, r *http.Request) {
+	var req loginRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidParameter, "Body must be a JSON object")
+		return
+	}
+
+	user, session, err := h.login(r, req.Username, req.Password)
+	if errors.Is(err, users.ErrInvalidCredentials) {
+		writeError(w, http.StatusUnauthorized, CodeUnauthorized, "Invalid username or password")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error logging in")
+		return
+	}
+
+	setNoStore(w)
+	writeJSON(w, r, loginResponse{
+		Token:     session.Token,
+		TokenType: "Bearer",
+		ExpiresAt: session.ExpiresAt,
+		User:      user,
+	}, nil)
+}
+
+// Logout ends the session the request was sent with
+func (h *AccountHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	token, _ := auth.SessionToken(r)
+	if _, ok := auth.UserFrom(auth.IdentityFrom(r.Context())); !ok || token == "" {
+		writeError(w, http.StatusBadRequest, CodeInvalidParameter, "Not logged in with a session")
+		return
+	}
+
+	if err := h.users.DeleteSession(token); err != nil {
+		logger(r).Errorf("Error deleting session: %v", err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error logging out")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetMe returns who the client is authenticated as
+func (h *AccountHandler) GetMe(w http.ResponseWriter, r *http.Request) {
+	identity := auth.IdentityFrom(r.Context())
+	result := me{Identity: identity}
+
+	if username, ok := auth.UserFrom(identity); ok {
+		user, err := h.users.Get(username)
+		if err != nil {
+			logger(r).Errorf("Error getting user %s: %v", username, err.Error())
+			writeError(w, http.StatusInternalServerError, CodeInternal, "Error getting user")
+			return
+		}
+		result.User = &user
+	}
+
+	setNoStore(w)
+	writeJSON(w, r, result, nil)
+}
+
+// CreateUser adds an account while the server runs, the useradd command
+// needs it stopped
+func (h *AccountHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
+	var req createUserRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidParameter, "Body must be a JSON object")
+		return
+	}
+
+	user, err := h.users.Create(strings.TrimSpace(req.Username), req.Password)
+	switch {
+	case errors.Is(err, users.ErrInvalidUsername):
+		writeError(w, http.StatusBadRequest, CodeInvalidParameter, "Username must be 1 to 32 lowercase letters, digits, dots, dashes or underscores")
+		return
+	case errors.Is(err, users.ErrWeakPassword):
+		writeError(w, http.StatusBadRequest, CodeInvalidParameter, fmt.Sprintf("Password must be at least %d characters", users.MinPasswordLength))
+		return
+	case errors.Is(err, users.ErrExists):
+		writeError(w, http.StatusConflict, CodeConflict, "User already exists")
+		return
+	case err != nil:
+		logger(r).Errorf("Error creating user: %v", err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error creating user")
+		return
+	}
+
+	logger(r).Infof("User %s created by %s", user.Username, auth.IdentityFrom(r.Context()))
+	writeStatus(w, r, http.StatusCreated, user, nil)
+}
+
+// WebLogin renders the login form of the web UI
+func (h *AccountHandler) WebLogin(w http.ResponseWriter, r *http.Request) {
+	render(w, r, "login", 0, webPage{Title: "Log in"})
+}
+
+// WebLoginSubmit logs in from the form of the web UI, keeping the token in
+// a cookie
+func (h *AccountHandler) WebLoginSubmit(w http.ResponseWriter, r *http.Request) {
+	_, session, err := h.login(r, r.PostFormValue("username"), r.PostFormValue("password"))
+	if errors.Is(err, users.ErrInvalidCredentials) {
+		renderStatus(w, r, http.StatusUnauthorized, "login", 0, webPage{Title: "Log in", Data: "Invalid username or password."})
+		return
+	}
+	if err != nil {
+		renderError(w, r, http.StatusInternalServerError, "Something went wrong while logging in, try again later.")
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     auth.CookieSession,
+		Value:    session.Token,
+		Path:     "/",
+		Expires:  session.ExpiresAt,
+		Secure:   strings.HasPrefix(baseURL(r), "https://"),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// WebLogout ends the session of the web UI
+func (h *AccountHandler) WebLogout(w http.ResponseWriter, r *http.Request) {
+	if token, bearer := auth.SessionToken(r); token != "" && !bearer {
+		if err := h.users.DeleteSession(token); err != nil {
+			logger(r).Errorf("Error deleting session: %v", err.Error())
+		}
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     auth.CookieSession,
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// login checks the credentials and starts a session
+func (h *AccountHandler) login(r *http.Request, username, password string) (users.User, users.Session, error) {
+	user, err := h.users.Authenticate(strings.TrimSpace(username), password)
+	if err != nil {
+		return users.User{}, users.Session{}, err
+	}
+
+	session, err := h.users.CreateSession(user.Username, h.sessionTTL)
+	if err != nil {
+		logger(r).Errorf("Error creating session: %v", err.Error())
+		return users.User{}, users.Session{}, err
+	}
+
+	logger(r).Infof("User %s logged in", user.Username)
+	return user, session, nil
+}
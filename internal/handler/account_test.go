@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"yokai/internal/storage/storagetest"
+	"yokai/internal/users"
+)
+
+func TestCreateUser(t *testing.T) {
+	accounts := storagetest.NewStore(t, users.NewStore)
+	h := NewAccountHandler(accounts, time.Hour)
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"created", `{"username":"alice","password":"correct horse"}`, http.StatusCreated},
+		{"exists", `{"username":"alice","password":"battery staple"}`, http.StatusConflict},
+		{"invalid username", `{"username":"Alice!","password":"correct horse"}`, http.StatusBadRequest},
+		{"weak password", `{"username":"bob","password":"short"}`, http.StatusBadRequest},
+		{"not JSON", `alice`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.CreateUser(w, httptest.NewRequest(http.MethodPost, "/api/admin/users", strings.NewReader(tt.body)))
+			if w.Code != tt.want {
+				t.Errorf("status %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+
+	if _, err := accounts.Authenticate("alice", "correct horse"); err != nil {
+		t.Errorf("can't log in as the created user: %v", err)
+	}
+}
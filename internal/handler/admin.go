@@ -0,0 +1,284 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"yokai/internal/anime"
+	"yokai/internal/auth"
+	"yokai/internal/imageproxy"
+	"yokai/internal/settings"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+type AdminHandler struct {
+	settings *settings.Store
+	ranking  *anime.Ranking
+	images   *imageproxy.Proxy
+}
+
+func NewAdminHandler(settings *settings.Store, ranking *anime.Ranking, images *imageproxy.Proxy) *AdminHandler {
+	return &AdminHandler{
+		settings: settings,
+		ranking:  ranking,
+		images:   images,
+	}
+}
+
+// serverSwitch tells whether a stream server is offered and whether the
+// scraper knows how to resolve it
+type serverSwitch struct {
+	Name      string `json:"name"`
+	Enabled   bool   `json:"enabled"`
+	Extractor bool   `json:"extractor"`
+}
+
+type providerSwitch struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+}
+
+type toggleRequest struct {
+	Enabled *bool `json:"enabled"`
+}
+
+type logLevel struct {
+	Level string `json:"level"`
+}
+
+type purgeRequest struct {
+	Prefix string `json:"prefix"`
+}
+
+type purgeResult struct {
+	Purged int `json:"purged"`
+}
+
+var invalidLevelMessage = "Level must be one of " + strings.Join(levelNames(), ", ")
+
+// ListServers returns every stream server seen so far and whether it's enabled
+func (h *AdminHandler) ListServers(w http.ResponseWriter, r *http.Request) {
+	names := h.serverNames()
+	servers := make([]serverSwitch, len(names))
+	for i, name := range names {
+		servers[i] = newServerSwitch(name)
+	}
+
+	setNoStore(w)
+	writeJSON(w, r, servers, nil)
+}
+
+// PutServer enables or disables a stream server the scraper knows about
+func (h *AdminHandler) PutServer(w http.ResponseWriter, r *http.Request) {
+	names := h.serverNames()
+	i := slices.IndexFunc(names, func(known string) bool {
+		return strings.EqualFold(known, mux.Vars(r)["name"])
+	})
+	if i < 0 {
+		writeError(w, http.StatusNotFound, CodeNotFound, "Server not found")
+		return
+	}
+	name := names[i]
+
+	enabled, ok := decodeToggle(w, r)
+	if !ok {
+		return
+	}
+
+	_, err := h.settings.Change(func(s *settings.Settings) error {
+		s.DisabledServers = toggleName(s.DisabledServers, name, enabled)
+		return nil
+	})
+	if err != nil {
+		logger(r).Errorf("Error saving settings: %v", err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error saving settings")
+		return
+	}
+
+	adminLogger(r).WithFields(logrus.Fields{"server": name, "enabled": enabled}).Info("Server toggled")
+	setNoStore(w)
+	writeJSON(w, r, newServerSwitch(name), nil)
+}
+
+// ListProviders returns the providers and whether they're enabled
+func (h *AdminHandler) ListProviders(w http.ResponseWriter, r *http.Request) {
+	providers := make([]providerSwitch, len(anime.Providers))
+	for i, name := range anime.Providers {
+		providers[i] = providerSwitch{Name: name, Enabled: anime.ProviderEnabled(name)}
+	}
+
+	setNoStore(w)
+	writeJSON(w, r, providers, nil)
+}
+
+// PutProvider enables or disables a provider, every scrape fails while
+// it's disabled
+func (h *AdminHandler) PutProvider(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	if !anime.KnownProvider(name) {
+		writeError(w, http.StatusNotFound, CodeNotFound, "Provider not found")
+		return
+	}
+
+	enabled, ok := decodeToggle(w, r)
+	if !ok {
+		return
+	}
+
+	name = strings.ToLower(name)
+	_, err := h.settings.Change(func(s *settings.Settings) error {
+		s.DisabledProviders = toggleName(s.DisabledProviders, name, enabled)
+		return nil
+	})
+	if err != nil {
+		logger(r).Errorf("Error saving settings: %v", err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error saving settings")
+		return
+	}
+
+	adminLogger(r).WithFields(logrus.Fields{"provider": name, "enabled": enabled}).Info("Provider toggled")
+	setNoStore(w)
+	writeJSON(w, r, providerSwitch{Name: name, Enabled: anime.ProviderEnabled(name)}, nil)
+}
+
+// GetBrowsers returns the headless browsers running right now
+func (h *AdminHandler) GetBrowsers(w http.ResponseWriter, r *http.Request) {
+	setNoStore(w)
+	writeJSON(w, r, anime.Browsers(), nil)
+}
+
+func (h *AdminHandler) GetLogLevel(w http.ResponseWriter, r *http.Request) {
+	setNoStore(w)
+	writeJSON(w, r, logLevel{Level: logrus.GetLevel().String()}, nil)
+}
+
+// PutLogLevel changes the log level, it overrides LOG_LEVEL from then on
+func (h *AdminHandler) PutLogLevel(w http.ResponseWriter, r *http.Request) {
+	var req logLevel
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidParameter, "Body must be a JSON object")
+		return
+	}
+
+	level, err := logrus.ParseLevel(req.Level)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidParameter, invalidLevelMessage)
+		return
+	}
+
+	_, err = h.settings.Change(func(s *settings.Settings) error {
+		s.LogLevel = level.String()
+		return nil
+	})
+	if err != nil {
+		logger(r).Errorf("Error saving settings: %v", err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error saving settings")
+		return
+	}
+
+	adminLogger(r).WithField("level", level.String()).Info("Log level changed")
+	setNoStore(w)
+	writeJSON(w, r, logLevel{Level: logrus.GetLevel().String()}, nil)
+}
+
+// PurgeCache removes the cached images whose source URL starts with the
+// prefix, or every image for an empty prefix
+func (h *AdminHandler) PurgeCache(w http.ResponseWriter, r *http.Request) {
+	var req purgeRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidParameter, "Body must be a JSON object")
+		return
+	}
+
+	purged, err := h.images.Purge(req.Prefix)
+	if err != nil {
+		logger(r).Errorf("Error purging image cache: %v", err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error purging image cache")
+		return
+	}
+
+	adminLogger(r).WithFields(logrus.Fields{"prefix": req.Prefix, "purged": purged}).Info("Image cache purged")
+	setNoStore(w)
+	writeJSON(w, r, purgeResult{Purged: purged}, nil)
+}
+
+// serverNames returns every stream server the scraper can resolve, was
+// disabled or has been ranked, sorted
+func (h *AdminHandler) serverNames() []string {
+	seen := make(map[string]string)
+	add := func(names ...string) {
+		for _, name := range names {
+			if _, ok := seen[strings.ToLower(name)]; !ok {
+				seen[strings.ToLower(name)] = name
+			}
+		}
+	}
+
+	add(anime.Extractors...)
+	add(anime.DefaultDisabledServers...)
+	add(anime.DisabledServers()...)
+	for name := range h.ranking.Stats() {
+		add(name)
+	}
+
+	names := make([]string, 0, len(seen))
+	for _, name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func newServerSwitch(name string) serverSwitch {
+	return serverSwitch{
+		Name:    name,
+		Enabled: anime.ServerEnabled(name),
+		Extractor: slices.ContainsFunc(anime.Extractors, func(extractor string) bool {
+			return strings.EqualFold(extractor, name)
+		}),
+	}
+}
+
+// decodeToggle reads the enabled flag of the body, answering 400 when it's
+// missing
+func decodeToggle(w http.ResponseWriter, r *http.Request) (bool, bool) {
+	var req toggleRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidParameter, "Body must be a JSON object")
+		return false, false
+	}
+	if req.Enabled == nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidParameter, "Enabled is required")
+		return false, false
+	}
+	return *req.Enabled, true
+}
+
+// toggleName removes name from the disabled names when enabled, or adds it
+func toggleName(disabled []string, name string, enabled bool) []string {
+	disabled = slices.DeleteFunc(slices.Clone(disabled), func(candidate string) bool {
+		return strings.EqualFold(candidate, name)
+	})
+	if !enabled {
+		disabled = append(disabled, name)
+	}
+	sort.Strings(disabled)
+	return disabled
+}
+
+// adminLogger tags the log lines of admin changes with who made them
+func adminLogger(r *http.Request) *logrus.Entry {
+	return logger(r).WithField("admin", auth.IdentityFrom(r.Context()))
+}
+
+func levelNames() []string {
+	names := make([]string, len(logrus.AllLevels))
+	for i, level := range logrus.AllLevels {
+		names[i] = level.String()
+	}
+	return names
+}
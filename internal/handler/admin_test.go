@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"yokai/internal/anime"
+	"yokai/internal/settings"
+	"yokai/internal/storage/storagetest"
+
+	"github.com/gorilla/mux"
+)
+
+func TestToggleName(t *testing.T) {
+	tests := []struct {
+		disabled []string
+		name     string
+		enabled  bool
+		want     []string
+	}{
+		{[]string{"Mega"}, "Streamwish", false, []string{"Mega", "Streamwish"}},
+		{[]string{"Mega", "Streamwish"}, "streamwish", true, []string{"Mega"}},
+		{[]string{"Mega"}, "mega", false, []string{"mega"}},
+		{[]string{"Mega"}, "Desu", true, []string{"Mega"}},
+		{nil, "Mega", true, []string{}},
+	}
+
+	for _, tt := range tests {
+		disabled := slices.Clone(tt.disabled)
+		got := toggleName(disabled, tt.name, tt.enabled)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("toggleName(%v, %s, %v) = %v, want %v", tt.disabled, tt.name, tt.enabled, got, tt.want)
+		}
+		if !slices.Equal(disabled, tt.disabled) {
+			t.Errorf("toggleName changed its argument to %v", disabled)
+		}
+	}
+}
+
+func TestPutServer(t *testing.T) {
+	t.Cleanup(func() { settings.Defaults().Apply() })
+	store := storagetest.NewStore(t, settings.NewStore)
+	h := NewAdminHandler(store, anime.NewRanking(""), nil)
+
+	put := func(name, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPut, "/api/admin/servers/"+name, strings.NewReader(body))
+		r = mux.SetURLVars(r, map[string]string{"name": name})
+		w := httptest.NewRecorder()
+		h.PutServer(w, r)
+		return w
+	}
+
+	tests := []struct {
+		name   string
+		server string
+		body   string
+		want   int
+	}{
+		{"unknown server", "Nope", `{"enabled":false}`, http.StatusNotFound},
+		{"missing flag", "Streamwish", `{}`, http.StatusBadRequest},
+		{"disabled", "streamwish", `{"enabled":false}`, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := put(tt.server, tt.body); w.Code != tt.want {
+				t.Errorf("status %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+
+	if anime.ServerEnabled("Streamwish") {
+		t.Error("Streamwish is still enabled")
+	}
+	saved, _ := store.Load()
+	if !slices.Contains(saved.DisabledServers, "Streamwish") || slices.Contains(saved.DisabledServers, "Nope") {
+		t.Errorf("saved disabled servers %v, want Streamwish with its spelling and no unknown server", saved.DisabledServers)
+	}
+}
+
+func TestPutProviderUnknown(t *testing.T) {
+	h := NewAdminHandler(storagetest.NewStore(t, settings.NewStore), anime.NewRanking(""), nil)
+
+	r := httptest.NewRequest(http.MethodPut, "/api/admin/providers/crunchyroll", strings.NewReader(`{"enabled":false}`))
+	r = mux.SetURLVars(r, map[string]string{"name": "crunchyroll"})
+	w := httptest.NewRecorder()
+	h.PutProvider(w, r)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status %d, want 404", w.Code)
+	}
+}
@@ -1,118 +1,159 @@
 package handler
 
 import (
-	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"sync/atomic"
+	"yokai/internal/anime"
+	"yokai/internal/playlist"
 
-	"github.com/sirupsen/logrus"
+	"github.com/gorilla/mux"
 )
 
+// probeParallelism bounds the headless browsers started by a single probe request
+const probeParallelism = 3
+
 func (h *Handler) GetLatestEpisodes(w http.ResponseWriter, r *http.Request) {
-	latestEpisodes, err := h.scrapper.GetLatestEpisodes()
+	latestEpisodes, err := h.scraper(r).GetLatestEpisodes()
 	if err != nil {
-		logrus.Errorf("Error getting latest episodes: %v", err.Error())
-		http.Error(w, "Error getting latest episodes", http.StatusInternalServerError)
+		logger(r).Errorf("Error getting latest episodes: %v", err.Error())
+		writeScrapeError(w, err, "Error getting latest episodes")
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(latestEpisodes)
+	h.rewriteLatestEpisodes(r, latestEpisodes)
+
+	setCacheControl(w, cacheLatest)
+	writeJSON(w, r, latestEpisodes, &Pagination{Page: 1, TotalPages: 1})
 }
 
 func (h *Handler) GetAnime(w http.ResponseWriter, r *http.Request) {
-	slug := r.URL.Query().Get("slug")
+	slug := pathOrQuery(r, "slug")
 	if slug == "" {
-		http.Error(w, "Slug is required", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, CodeInvalidParameter, "Slug is required")
 		return
 	}
 
-	animeDetails, err := h.scrapper.GetAnime(slug)
+	animeDetails, err := h.scraper(r).GetAnime(slug)
 	if err != nil {
-		logrus.Errorf("Error getting anime details: %v", err.Error())
-		http.Error(w, "Error getting anime details", http.StatusInternalServerError)
+		logger(r).Errorf("Error getting anime details: %v", err.Error())
+		writeScrapeError(w, err, "Error getting anime details")
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(animeDetails)
+	if proxyImages(r) {
+		animeDetails.Img = h.imageURL(r, animeDetails.Img)
+	}
+
+	setCacheControl(w, cacheAnime)
+	writeJSON(w, r, animeDetails, nil)
 }
 
 func (h *Handler) GetEpisodes(w http.ResponseWriter, r *http.Request) {
-	slug := r.URL.Query().Get("slug")
+	slug := pathOrQuery(r, "slug")
 	if slug == "" {
-		http.Error(w, "Slug is required", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, CodeInvalidParameter, "Slug is required")
 		return
 	}
 
 	page := r.URL.Query().Get("page")
-	if page == "" {
-		http.Error(w, "Page is required", http.StatusBadRequest)
-		return
-	}
-	pageNum, err := strconv.Atoi(page)
+	pageNum := 1
 
-	if err != nil {
-		http.Error(w, "Page must be a number", http.StatusBadRequest)
-		return
+	if page != "" {
+		var err error
+		pageNum, err = strconv.Atoi(page)
+
+		if err != nil {
+			writeError(w, http.StatusBadRequest, CodeInvalidParameter, "Page must be a number")
+			return
+		}
 	}
 
-	episodes, err := h.scrapper.GetEpisodes(slug, pageNum)
+	episodes, err := h.scraper(r).GetEpisodes(slug, pageNum)
 	if err != nil {
-		logrus.Errorf("Error getting episodes: %v", err.Error())
-		http.Error(w, "Error getting episodes", http.StatusInternalServerError)
+		logger(r).Errorf("Error getting episodes: %v", err.Error())
+		writeScrapeError(w, err, "Error getting episodes")
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(episodes)
+	h.rewriteLatestEpisodes(r, episodes.Episodes)
+
+	setCacheControl(w, cacheEpisodes)
+	writeJSON(w, r, episodes, &Pagination{
+		Page:       episodes.Page,
+		HasNext:    episodes.Page < episodes.TotalPages,
+		TotalPages: episodes.TotalPages,
+	})
 }
 
 func (h *Handler) GetServers(w http.ResponseWriter, r *http.Request) {
-	slug := r.URL.Query().Get("slug")
+	slug := pathOrQuery(r, "slug")
 	if slug == "" {
-		http.Error(w, "Slug is required", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, CodeInvalidParameter, "Slug is required")
 		return
 	}
 
-	episode := r.URL.Query().Get("episode")
+	episode := pathOrQuery(r, "episode")
 	if episode == "" {
-		http.Error(w, "Episode is required", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, CodeInvalidParameter, "Episode is required")
 		return
 	}
 
 	if _, err := strconv.Atoi(episode); err != nil {
-		http.Error(w, "Episode must be a number", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, CodeInvalidParameter, "Episode must be a number")
 		return
 	}
 
-	servers, err := h.scrapper.GetServers(slug, episode)
+	probe := false
+	if value := r.URL.Query().Get("probe"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, CodeInvalidParameter, "Probe must be a boolean")
+			return
+		}
+		probe = parsed
+	}
+
+	servers, err := h.scraper(r).GetServers(slug, episode)
 	if err != nil {
-		logrus.Errorf("Error getting servers: %v", err.Error())
-		http.Error(w, "Error getting servers", http.StatusInternalServerError)
+		logger(r).Errorf("Error getting servers: %v", err.Error())
+		writeScrapeError(w, err, "Error getting servers")
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(servers)
+	if probe {
+		servers = h.scraper(r).ProbeServers(servers, probeParallelism)
+	}
+
+	setCacheControl(w, cacheServers)
+	writeJSON(w, r, servers, nil)
 }
 
+// PlayStreaming resolves the remote of a server, as listed by GetServers,
+// and redirects to its stream
 func (h *Handler) PlayStreaming(w http.ResponseWriter, r *http.Request) {
-	slug := r.URL.Query().Get("slug")
-	if slug == "" {
-		http.Error(w, "Slug is required", http.StatusBadRequest)
+	remote := r.URL.Query().Get("remote")
+	if remote == "" {
+		// The deprecated route calls the remote slug
+		remote = r.URL.Query().Get("slug")
+	}
+	if remote == "" {
+		writeError(w, http.StatusBadRequest, CodeInvalidParameter, "Remote is required")
 		return
 	}
 
 	server := r.URL.Query().Get("server")
 	if server == "" {
-		http.Error(w, "Server is required", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, CodeInvalidParameter, "Server is required")
 		return
 	}
 
-	streamingURL, err := h.scrapper.GetStreaming(server, slug)
+	streamingURL, err := h.scraper(r).GetStreaming(server, remote)
 	if err != nil {
-		logrus.Errorf("Error getting streaming URL: %v", err.Error())
-		http.Error(w, "Error getting streaming URL", http.StatusInternalServerError)
+		logger(r).Errorf("Error getting streaming URL: %v", err.Error())
+		writeScrapeError(w, err, "Error getting streaming URL")
 		return
 	}
 	http.Redirect(w, r, streamingURL, http.StatusFound)
@@ -121,7 +162,7 @@ func (h *Handler) PlayStreaming(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) GetSearch(w http.ResponseWriter, r *http.Request) {
 	name := r.URL.Query().Get("name")
 	if name == "" {
-		http.Error(w, "Name is required", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, CodeInvalidParameter, "Name is required")
 		return
 	}
 
@@ -133,18 +174,168 @@ func (h *Handler) GetSearch(w http.ResponseWriter, r *http.Request) {
 		pageNum, err = strconv.Atoi(page)
 
 		if err != nil {
-			http.Error(w, "Page must be a number", http.StatusBadRequest)
+			writeError(w, http.StatusBadRequest, CodeInvalidParameter, "Page must be a number")
 			return
 		}
 	}
 
-	searchResults, err := h.scrapper.GetSearch(name, pageNum)
+	searchResults, err := h.scraper(r).GetSearchResults(name, pageNum)
+	if err != nil {
+		logger(r).Errorf("Error getting search results: %v", err.Error())
+		writeScrapeError(w, err, "Error getting search results")
+		return
+	}
+
+	h.rewriteAnimes(r, searchResults.Results)
+
+	setCacheControl(w, cacheSearch)
+	writeJSON(w, r, searchResults.Results, &Pagination{
+		Page:    searchResults.Page,
+		HasNext: searchResults.HasNext,
+	})
+}
+
+func (h *Handler) GetPlaylist(w http.ResponseWriter, r *http.Request) {
+	slug := pathOrQuery(r, "slug")
+	if slug == "" {
+		writeError(w, http.StatusBadRequest, CodeInvalidParameter, "Slug is required")
+		return
+	}
+
+	entries, err := playlist.Build(h.scraper(r), slug, baseURL(r))
 	if err != nil {
-		logrus.Errorf("Error getting search results: %v", err.Error())
-		http.Error(w, "Error getting search results", http.StatusInternalServerError)
+		logger(r).Errorf("Error building playlist: %v", err.Error())
+		writeScrapeError(w, err, "Error building playlist")
+		return
+	}
+
+	// Entries carry the key the playlist was requested with
+	playlist.WithAPIKey(entries, r.URL.Query().Get("api_key"))
+
+	w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", slug+".m3u8"))
+	playlist.Write(w, entries)
+}
+
+func (h *Handler) StreamEpisode(w http.ResponseWriter, r *http.Request) {
+	slug := pathOrQuery(r, "slug")
+	if slug == "" {
+		writeError(w, http.StatusBadRequest, CodeInvalidParameter, "Slug is required")
+		return
+	}
+
+	episode := pathOrQuery(r, "episode")
+	if episode == "" {
+		writeError(w, http.StatusBadRequest, CodeInvalidParameter, "Episode is required")
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(searchResults)
+	if _, err := strconv.Atoi(episode); err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidParameter, "Episode must be a number")
+		return
+	}
+
+	servers, err := h.scraper(r).GetServers(slug, episode)
+	if err != nil {
+		logger(r).Errorf("Error getting servers: %v", err.Error())
+		writeScrapeError(w, err, "Error getting servers")
+		return
+	}
+
+	name := r.URL.Query().Get("server")
+	server, streamingURL, err := resolveStream(h.scraper(r), h.ranking, servers, name)
+	if errors.Is(err, errServerNotAvailable) {
+		writeError(w, http.StatusNotFound, CodeNotFound, "Server not available for this episode")
+		return
+	}
+	if err != nil {
+		logger(r).Errorf("Error getting streaming URL: %v", err.Error())
+		if isAutoServer(name) {
+			writeError(w, http.StatusBadGateway, CodeUpstreamFailed, "No server could resolve the episode")
+		} else {
+			writeScrapeError(w, err, "Error getting streaming URL")
+		}
+		return
+	}
+
+	w.Header().Set("X-Okarun-Server", server.Server)
+	http.Redirect(w, r, streamingURL, http.StatusFound)
+}
+
+// errServerNotAvailable is returned when an episode isn't offered by the requested server
+var errServerNotAvailable = errors.New("server not available for this episode")
+
+// isAutoServer reports whether name asks for the best ranked server
+func isAutoServer(name string) bool {
+	return name == "" || strings.EqualFold(name, anime.AutoServer)
+}
+
+// resolveStream resolves the stream of the named server among servers, or
+// of the best ranked one that works for auto or an empty name
+func resolveStream(scraper anime.Jkanime, ranking *anime.Ranking, servers []anime.Server, name string) (anime.Server, string, error) {
+	if isAutoServer(name) {
+		return scraper.GetRankedStreaming(servers, ranking)
+	}
+
+	for _, server := range servers {
+		if strings.EqualFold(server.Server, name) {
+			streamingURL, err := scraper.GetStreaming(server.Server, server.Remote)
+			return server, streamingURL, err
+		}
+	}
+
+	return anime.Server{}, "", errServerNotAvailable
+}
+
+// writeScrapeError answers a failed scrape, telling apart what an admin
+// has disabled
+func writeScrapeError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, anime.ErrProviderDisabled):
+		writeError(w, http.StatusServiceUnavailable, CodeDisabled, "The provider is disabled")
+		return
+	case errors.Is(err, anime.ErrServerDisabled):
+		writeError(w, http.StatusNotFound, CodeDisabled, "The server is disabled")
+		return
+	}
+	writeError(w, http.StatusInternalServerError, CodeScrapeFailed, message)
+}
+
+// pathOrQuery returns a route variable, falling back to the query string
+// used by the deprecated routes
+func pathOrQuery(r *http.Request, name string) string {
+	if value, ok := mux.Vars(r)[name]; ok {
+		return value
+	}
+	return r.URL.Query().Get(name)
+}
+
+// forwardedTrust reports whether a request came through a trusted proxy
+var forwardedTrust atomic.Pointer[func(*http.Request) bool]
+
+// TrustForwardedHeaders honours X-Forwarded-Proto and X-Forwarded-Host on
+// the requests trusted accepts. They end up in cached playlists, feeds and
+// links, so they're ignored on requests from anyone else.
+func TrustForwardedHeaders(trusted func(*http.Request) bool) {
+	forwardedTrust.Store(&trusted)
+}
+
+// baseURL returns the scheme and host the request was addressed to
+func baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	host := r.Host
+
+	if trusted := forwardedTrust.Load(); trusted != nil && (*trusted)(r) {
+		if proto := r.Header.Get("X-Forwarded-Proto"); proto == "http" || proto == "https" {
+			scheme = proto
+		}
+		if forwarded := r.Header.Get("X-Forwarded-Host"); forwarded != "" {
+			host = forwarded
+		}
+	}
+
+	return scheme + "://" + host
 }
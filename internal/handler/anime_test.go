@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBaseURL(t *testing.T) {
+	TrustForwardedHeaders(func(r *http.Request) bool {
+		return r.RemoteAddr == "10.0.0.1:1234"
+	})
+	t.Cleanup(func() { forwardedTrust.Store(nil) })
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		tls        bool
+		proto      string
+		host       string
+		want       string
+	}{
+		{"plain", "203.0.113.7:1234", false, "", "", "http://okarun.local"},
+		{"tls", "203.0.113.7:1234", true, "", "", "https://okarun.local"},
+		{"forged headers", "203.0.113.7:1234", false, "https", "evil.example", "http://okarun.local"},
+		{"trusted proxy", "10.0.0.1:1234", false, "https", "anime.example", "https://anime.example"},
+		{"trusted proxy without headers", "10.0.0.1:1234", true, "", "", "https://okarun.local"},
+		{"trusted proxy with a bogus scheme", "10.0.0.1:1234", false, "javascript", "", "http://okarun.local"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "http://okarun.local/api/v1/latest", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.tls {
+				r.TLS = &tls.ConnectionState{}
+			}
+			if tt.proto != "" {
+				r.Header.Set("X-Forwarded-Proto", tt.proto)
+			}
+			if tt.host != "" {
+				r.Header.Set("X-Forwarded-Host", tt.host)
+			}
+
+			if got := baseURL(r); got != tt.want {
+				t.Errorf("baseURL = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"yokai/internal/auth"
+)
+
+type AuthHandler struct {
+	guard *auth.Guard
+}
+
+func NewAuthHandler(guard *auth.Guard) *AuthHandler {
+	return &AuthHandler{
+		guard: guard,
+	}
+}
+
+// Require authenticates the request and takes a token from the client's
+// bucket for class, answering 401 or 429 when it can't
+func (h *AuthHandler) Require(class auth.Class) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			identity, ok := h.guard.Identify(r)
+			if !ok {
+				w.Header().Set("WWW-Authenticate", `APIKey header="`+auth.HeaderAPIKey+`"`)
+				writeError(w, http.StatusUnauthorized, CodeUnauthorized, "A valid API key or session is required")
+				return
+			}
+
+			allowed, retryAfter := h.guard.Allow(identity, class)
+			if !allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+				writeError(w, http.StatusTooManyRequests, CodeRateLimited, "Rate limit exceeded")
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(auth.WithIdentity(r.Context(), identity)))
+		})
+	}
+}
+
+// Limit rate limits routes open to anonymous clients, like logging in,
+// identifying them by address when they don't authenticate
+func (h *AuthHandler) Limit(class auth.Class) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			identity, ok := h.guard.Identify(r)
+			if !ok {
+				identity = h.guard.IPIdentity(r)
+			}
+
+			allowed, retryAfter := h.guard.Allow(identity, class)
+			if !allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+				writeError(w, http.StatusTooManyRequests, CodeRateLimited, "Rate limit exceeded")
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(auth.WithIdentity(r.Context(), identity)))
+		})
+	}
+}
+
+// RequireAdmin answers 403 unless the client authenticated by Require is
+// an admin
+func (h *AuthHandler) RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !h.guard.Admin(auth.IdentityFrom(r.Context())) {
+			writeError(w, http.StatusForbidden, CodeForbidden, "Admin access is required")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireUser answers 401 unless the client authenticated by Require is
+// logged in as a user, for routes keeping per user data
+func (h *AuthHandler) RequireUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := auth.UserFrom(auth.IdentityFrom(r.Context())); !ok {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, CodeUnauthorized, "Logging in is required")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// GetUsage returns the request counters of the calling client
+func (h *AuthHandler) GetUsage(w http.ResponseWriter, r *http.Request) {
+	setNoStore(w)
+	writeJSON(w, r, h.guard.Usage(auth.IdentityFrom(r.Context())), nil)
+}
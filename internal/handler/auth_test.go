@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"yokai/internal/auth"
+)
+
+func TestRequireRateLimits(t *testing.T) {
+	guard := auth.NewGuard(nil, map[auth.Class]auth.Limit{
+		auth.Expensive: {PerMinute: 1},
+	})
+	h := NewAuthHandler(guard).Require(auth.Expensive)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("first request: status %d, want 204", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("second request: status %d, want 429", w.Code)
+	}
+	retryAfter, err := strconv.Atoi(w.Header().Get("Retry-After"))
+	if err != nil || retryAfter < 1 || retryAfter > 60 {
+		t.Errorf("Retry-After = %q, want 1 to 60 seconds", w.Header().Get("Retry-After"))
+	}
+}
+
+func TestRequireUser(t *testing.T) {
+	h := NewAuthHandler(auth.NewGuard(nil, nil)).RequireUser(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		identity string
+		want     int
+	}{
+		{auth.UserIdentity("alice"), http.StatusNoContent},
+		{"ip:203.0.113.7", http.StatusUnauthorized},
+		{"ops", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/api/me/progress", nil)
+		r = r.WithContext(auth.WithIdentity(r.Context(), tt.identity))
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.want {
+			t.Errorf("identity %q: status %d, want %d", tt.identity, w.Code, tt.want)
+		}
+	}
+}
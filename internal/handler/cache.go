@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// How long clients and CDNs may reuse responses, by how often the data changes
+const (
+	cacheLatest   = time.Minute
+	cacheSearch   = 5 * time.Minute
+	cacheServers  = 5 * time.Minute
+	cacheEpisodes = 10 * time.Minute
+	cacheFeed     = 5 * time.Minute
+	cacheAnime    = time.Hour
+	cacheDocs     = time.Hour
+	cacheImage    = 7 * 24 * time.Hour
+)
+
+// privateCache keeps responses out of shared caches, which would serve
+// them to clients without a valid key
+var privateCache atomic.Bool
+
+// UsePrivateCache only lets browsers reuse responses, for servers that
+// require authentication
+func UsePrivateCache(private bool) {
+	privateCache.Store(private)
+}
+
+// setCacheControl lets caches reuse the response for maxAge, shared ones
+// too unless authentication is required
+func setCacheControl(w http.ResponseWriter, maxAge time.Duration) {
+	scope := "public"
+	if privateCache.Load() {
+		scope = "private"
+	}
+	w.Header().Set("Cache-Control", scope+", max-age="+strconv.Itoa(int(maxAge.Seconds())))
+}
+
+// setNoStore keeps the response out of every cache, for per client data
+func setNoStore(w http.ResponseWriter) {
+	w.Header().Set("Cache-Control", "no-store")
+}
+
+// contentETag returns a strong ETag derived from the response body
+func contentETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// etagMatches reports whether an If-None-Match header matches etag. The
+// comparison is weak, compressed responses carry a weakened ETag.
+func etagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+
+	return false
+}
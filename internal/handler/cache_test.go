@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestEtagMatches(t *testing.T) {
+	tests := []struct {
+		ifNoneMatch string
+		etag        string
+		want        bool
+	}{
+		{`"abc"`, `"abc"`, true},
+		{`W/"abc"`, `"abc"`, true},
+		{`"abc"`, `W/"abc"`, true},
+		{`W/"abc"`, `W/"abc"`, true},
+		{`"xyz", "abc"`, `"abc"`, true},
+		{`"xyz",W/"abc"`, `"abc"`, true},
+		{`*`, `"abc"`, true},
+		{`"abd"`, `"abc"`, false},
+		{`abc`, `"abc"`, false},
+		{`"ab`, `"abc"`, false},
+		{``, `"abc"`, false},
+		{` `, `"abc"`, false},
+	}
+
+	for _, tt := range tests {
+		if got := etagMatches(tt.ifNoneMatch, tt.etag); got != tt.want {
+			t.Errorf("etagMatches(%q, %q) = %v, want %v", tt.ifNoneMatch, tt.etag, got, tt.want)
+		}
+	}
+}
+
+func TestContentETag(t *testing.T) {
+	a, b := contentETag([]byte(`{"data":1}`)), contentETag([]byte(`{"data":2}`))
+	if a == b || a != contentETag([]byte(`{"data":1}`)) {
+		t.Errorf("ETags %s and %s, want them to follow the body", a, b)
+	}
+	if len(a) != 18 || a[0] != '"' || a[17] != '"' {
+		t.Errorf("ETag %s, want 16 quoted hex digits", a)
+	}
+}
+
+func TestSetCacheControl(t *testing.T) {
+	t.Cleanup(func() { UsePrivateCache(false) })
+
+	tests := []struct {
+		private bool
+		maxAge  time.Duration
+		want    string
+	}{
+		{false, cacheLatest, "public, max-age=60"},
+		{false, cacheImage, "public, max-age=604800"},
+		{true, cacheAnime, "private, max-age=3600"},
+	}
+
+	for _, tt := range tests {
+		UsePrivateCache(tt.private)
+		w := httptest.NewRecorder()
+		setCacheControl(w, tt.maxAge)
+		if got := w.Header().Get("Cache-Control"); got != tt.want {
+			t.Errorf("Cache-Control = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestWriteJSONNotModified(t *testing.T) {
+	write := func(method, ifNoneMatch string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/api/v1/latest", nil)
+		if ifNoneMatch != "" {
+			r.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		writeJSON(w, r, []string{"dandadan"}, nil)
+		return w
+	}
+
+	first := write(http.MethodGet, "")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" || etag != contentETag(first.Body.Bytes()) {
+		t.Fatalf("status %d with ETag %q, want 200 with the ETag of the body", first.Code, etag)
+	}
+
+	tests := []struct {
+		name        string
+		method      string
+		ifNoneMatch string
+		want        int
+	}{
+		{"same ETag", http.MethodGet, etag, http.StatusNotModified},
+		{"weakened by compression", http.MethodGet, "W/" + etag, http.StatusNotModified},
+		{"HEAD", http.MethodHead, etag, http.StatusNotModified},
+		{"stale ETag", http.MethodGet, `"stale"`, http.StatusOK},
+		{"not a GET", http.MethodPut, etag, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := write(tt.method, tt.ifNoneMatch)
+			if w.Code != tt.want {
+				t.Fatalf("status %d, want %d", w.Code, tt.want)
+			}
+			if tt.want == http.StatusNotModified && w.Body.Len() != 0 {
+				t.Errorf("304 with a %d byte body", w.Body.Len())
+			}
+		})
+	}
+}
+
+func TestWriteCreatedWithoutETag(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("If-None-Match", "*")
+	w := httptest.NewRecorder()
+	writeCreated(w, r, "/api/v1/webhooks/1", map[string]string{"id": "1"})
+
+	if w.Code != http.StatusCreated || w.Header().Get("ETag") != "" || w.Header().Get("Location") != "/api/v1/webhooks/1" {
+		t.Errorf("status %d, ETag %q, Location %q, want a 201 without ETag", w.Code, w.Header().Get("ETag"), w.Header().Get("Location"))
+	}
+}
@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"bytes"
+	"embed"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+//go:embed docs
+var docs embed.FS
+
+// docsAssets are the Swagger UI files the docs page loads, by name with
+// their content type
+var docsAssets = map[string]string{
+	"swagger-ui.css":       "text/css; charset=utf-8",
+	"swagger-ui-bundle.js": "text/javascript; charset=utf-8",
+}
+
+// OpenAPISpec returns the embedded OpenAPI document
+func OpenAPISpec() []byte {
+	spec, _ := docs.ReadFile("docs/openapi.json")
+	return spec
+}
+
+func (h *Handler) GetOpenAPI(w http.ResponseWriter, r *http.Request) {
+	serveDoc(w, r, "application/json", OpenAPISpec())
+}
+
+func (h *Handler) GetDocs(w http.ResponseWriter, r *http.Request) {
+	page, _ := docs.ReadFile("docs/index.html")
+	serveDoc(w, r, "text/html; charset=utf-8", page)
+}
+
+// GetDocsAsset serves the Swagger UI files embedded next to the OpenAPI
+// document, the docs page doesn't depend on a CDN
+func (h *Handler) GetDocsAsset(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["file"]
+	contentType, ok := docsAssets[name]
+	if !ok {
+		writeError(w, http.StatusNotFound, CodeNotFound, "Asset not found")
+		return
+	}
+
+	body, err := docs.ReadFile("docs/swagger-ui/" + name)
+	if err != nil {
+		logger(r).Errorf("Error reading docs asset %s: %v", name, err.Error())
+		writeError(w, http.StatusNotFound, CodeNotFound, "Asset not found")
+		return
+	}
+
+	serveDoc(w, r, contentType, body)
+}
+
+// serveDoc serves an embedded document, which only changes between releases
+func serveDoc(w http.ResponseWriter, r *http.Request, contentType string, body []byte) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("ETag", contentETag(body))
+	setCacheControl(w, cacheDocs)
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(body))
+}
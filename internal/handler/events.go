@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+	"yokai/internal/events"
+
+	"github.com/sirupsen/logrus"
+)
+
+// heartbeatInterval keeps idle connections open through proxies
+const heartbeatInterval = 30 * time.Second
+
+type EventsHandler struct {
+	broker *events.Broker
+}
+
+func NewEventsHandler(broker *events.Broker) *EventsHandler {
+	return &EventsHandler{
+		broker: broker,
+	}
+}
+
+// ServeHTTP streams new episode events as Server-Sent Events, replaying
+// the buffered events newer than Last-Event-ID first
+func (h *EventsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("last_event_id")
+	}
+
+	var lastID uint64
+	if lastEventID != "" {
+		parsed, err := strconv.ParseUint(lastEventID, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, CodeInvalidParameter, "Last-Event-ID must be a number")
+			return
+		}
+		lastID = parsed
+	}
+
+	rc := http.NewResponseController(w)
+	// Event streams outlive the server write timeout
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		logger(r).Warnf("Error clearing write deadline for event stream: %v", err)
+	}
+
+	replay, stream, cancel := h.broker.Subscribe(lastID)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 5000\n\n")
+
+	for _, event := range replay {
+		writeEvent(w, event)
+	}
+	rc.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-stream:
+			if !ok {
+				return
+			}
+			writeEvent(w, event)
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		}
+
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event events.Event) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		logrus.Errorf("Error encoding event %d: %v", event.ID, err)
+		return
+	}
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+}
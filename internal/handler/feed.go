@@ -0,0 +1,138 @@
+package handler
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"yokai/internal/anime"
+	"yokai/internal/feed"
+
+	"github.com/gorilla/mux"
+)
+
+// feedEpisodes is how many of the newest episodes an anime feed lists
+const feedEpisodes = 20
+
+type FeedHandler struct {
+	scrapper anime.Jkanime
+	tracker  *feed.Tracker
+}
+
+func NewFeedHandler(scrapper anime.Jkanime, tracker *feed.Tracker) *FeedHandler {
+	return &FeedHandler{
+		scrapper: scrapper,
+		tracker:  tracker,
+	}
+}
+
+func (h *FeedHandler) GetLatestFeed(w http.ResponseWriter, r *http.Request) {
+	latestEpisodes, err := h.scrapper.WithContext(r.Context()).GetLatestEpisodes()
+	if err != nil {
+		logger(r).Errorf("Error getting latest episodes: %v", err.Error())
+		writeScrapeError(w, err, "Error getting latest episodes")
+		return
+	}
+
+	base := baseURL(r)
+	f := feed.Feed{
+		Title:       "Okarun - Latest episodes",
+		Link:        base + "/api/v1/latest",
+		SelfURL:     base + r.URL.RequestURI(),
+		Description: "Latest anime episodes released on jkanime",
+	}
+
+	for _, episode := range latestEpisodes {
+		f.Items = append(f.Items, h.episodeItem(base, episode.Slug, episode.Title, episode.Episode, episode.Img))
+	}
+
+	h.writeFeed(w, r, f)
+}
+
+func (h *FeedHandler) GetAnimeFeed(w http.ResponseWriter, r *http.Request) {
+	slug := mux.Vars(r)["slug"]
+	scraper := h.scrapper.WithContext(r.Context())
+
+	details, err := scraper.GetAnime(slug)
+	if err != nil {
+		logger(r).Errorf("Error getting anime details: %v", err.Error())
+		writeScrapeError(w, err, "Error getting anime details")
+		return
+	}
+
+	episodes, err := scraper.GetEpisodes(slug, 1)
+	if err != nil {
+		logger(r).Errorf("Error getting episodes: %v", err.Error())
+		writeScrapeError(w, err, "Error getting episodes")
+		return
+	}
+
+	last := episodes.LastEpisode
+	if last == 0 {
+		last = len(episodes.Episodes)
+	}
+
+	base := baseURL(r)
+	f := feed.Feed{
+		Title:       fmt.Sprintf("Okarun - %s", details.Title),
+		Link:        base + "/api/v1/anime/" + url.PathEscape(slug),
+		SelfURL:     base + r.URL.RequestURI(),
+		Description: details.Synopsis,
+		ImageURL:    details.Img,
+	}
+
+	for number := last; number > 0 && number > last-feedEpisodes; number-- {
+		f.Items = append(f.Items, h.episodeItem(base, slug, details.Title, strconv.Itoa(number), details.Img))
+	}
+
+	h.writeFeed(w, r, f)
+}
+
+func (h *FeedHandler) episodeItem(base, slug, title, episode, img string) feed.Item {
+	guid := fmt.Sprintf("okarun:episode:%s:%s", slug, episode)
+	return feed.Item{
+		GUID:      guid,
+		Title:     fmt.Sprintf("%s - Episode %s", title, episode),
+		Link:      fmt.Sprintf("%s/api/v1/anime/%s/episodes/%s/play", base, url.PathEscape(slug), url.PathEscape(episode)),
+		ImageURL:  img,
+		Published: h.tracker.Seen(guid),
+	}
+}
+
+// writeFeed renders the feed as RSS, or Atom with format=atom, and answers
+// conditional requests through ETag and Last-Modified
+func (h *FeedHandler) writeFeed(w http.ResponseWriter, r *http.Request, f feed.Feed) {
+	if err := h.tracker.Save(); err != nil {
+		logger(r).Warnf("Error saving feed tracker: %v", err)
+	}
+
+	var (
+		body        []byte
+		err         error
+		contentType string
+	)
+
+	switch r.URL.Query().Get("format") {
+	case "", "rss":
+		body, err = f.RSS()
+		contentType = "application/rss+xml; charset=utf-8"
+	case "atom":
+		body, err = f.Atom()
+		contentType = "application/atom+xml; charset=utf-8"
+	default:
+		writeError(w, http.StatusBadRequest, CodeInvalidParameter, "Format must be rss or atom")
+		return
+	}
+
+	if err != nil {
+		logger(r).Errorf("Error rendering feed: %v", err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error rendering feed")
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("ETag", contentETag(body))
+	setCacheControl(w, cacheFeed)
+	http.ServeContent(w, r, "", f.Updated(), bytes.NewReader(body))
+}
@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"yokai/internal/graph"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+)
+
+// maxGraphQLBody bounds the size of a GraphQL request document
+const maxGraphQLBody = 64 << 10
+
+type GraphQLHandler struct {
+	schema        graphql.Schema
+	maxComplexity int
+}
+
+type graphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+func NewGraphQLHandler(schema graphql.Schema, maxComplexity int) *GraphQLHandler {
+	return &GraphQLHandler{
+		schema:        schema,
+		maxComplexity: maxComplexity,
+	}
+}
+
+func (h *GraphQLHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req graphQLRequest
+
+	switch r.Method {
+	case http.MethodGet:
+		req.Query = r.URL.Query().Get("query")
+		req.OperationName = r.URL.Query().Get("operationName")
+		if variables := r.URL.Query().Get("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &req.Variables); err != nil {
+				writeGraphQLError(w, http.StatusBadRequest, "Variables must be a JSON object")
+				return
+			}
+		}
+	default:
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxGraphQLBody)).Decode(&req); err != nil {
+			writeGraphQLError(w, http.StatusBadRequest, "Body must be a GraphQL JSON request")
+			return
+		}
+	}
+
+	if req.Query == "" {
+		writeGraphQLError(w, http.StatusBadRequest, "Query is required")
+		return
+	}
+
+	complexity, err := graph.Complexity(h.schema, req.Query)
+	if err != nil {
+		writeGraphQLError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if complexity > h.maxComplexity {
+		writeGraphQLError(w, http.StatusBadRequest,
+			fmt.Sprintf("Query complexity %d exceeds the limit of %d", complexity, h.maxComplexity))
+		return
+	}
+
+	result := graphql.Do(graphql.Params{
+		Schema:         h.schema,
+		RequestString:  req.Query,
+		VariableValues: req.Variables,
+		OperationName:  req.OperationName,
+		Context:        r.Context(),
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+func writeGraphQLError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(graphql.Result{
+		Errors: []gqlerrors.FormattedError{{Message: message}},
+	})
+}
@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"yokai/internal/anime"
+	"yokai/internal/graph"
+)
+
+func TestGraphQLRejectsComplexQueries(t *testing.T) {
+	schema, err := graph.NewSchema(anime.Jkanime{})
+	if err != nil {
+		t.Fatalf("NewSchema: %v", err)
+	}
+	h := NewGraphQLHandler(schema, 100)
+
+	tests := []struct {
+		name    string
+		request *http.Request
+		message string
+	}{
+		{
+			name:    "POST above the limit",
+			request: httptest.NewRequest(http.MethodPost, "/api/graphql", strings.NewReader(`{"query":"{ latest { servers { server } } }"}`)),
+			message: "Query complexity 151 exceeds the limit of 100",
+		},
+		{
+			name:    "GET above the limit",
+			request: httptest.NewRequest(http.MethodGet, "/api/graphql?query="+url.QueryEscape(`{ latest { servers { stream } } }`), nil),
+			message: "Query complexity 1351 exceeds the limit of 100",
+		},
+		{
+			name:    "mutation",
+			request: httptest.NewRequest(http.MethodPost, "/api/graphql", strings.NewReader(`{"query":"mutation { latest { title } }"}`)),
+			message: `unsupported operation "mutation"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, tt.request)
+
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status %d, want 400", w.Code)
+			}
+			var body struct {
+				Errors []struct {
+					Message string `json:"message"`
+				} `json:"errors"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("decoding %s: %v", w.Body.String(), err)
+			}
+			if len(body.Errors) != 1 || body.Errors[0].Message != tt.message {
+				t.Errorf("errors = %+v, want %q", body.Errors, tt.message)
+			}
+		})
+	}
+}
@@ -1,13 +1,35 @@
 package handler
 
-import "yokai/internal/anime"
+import (
+	"net/http"
+	"yokai/internal/anime"
+	"yokai/internal/imageproxy"
+	"yokai/internal/logging"
+
+	"github.com/sirupsen/logrus"
+)
 
 type Handler struct {
 	scrapper anime.Jkanime
+	ranking  *anime.Ranking
+	images   *imageproxy.Proxy
 }
 
-func NewHandler(scrapper anime.Jkanime) *Handler {
+func NewHandler(scrapper anime.Jkanime, ranking *anime.Ranking, images *imageproxy.Proxy) *Handler {
 	return &Handler{
 		scrapper: scrapper,
+		ranking:  ranking,
+		images:   images,
 	}
 }
+
+// scraper returns the scraper bound to the request, so it stops when the
+// client goes away and its logs carry the request ID
+func (h *Handler) scraper(r *http.Request) anime.Jkanime {
+	return h.scrapper.WithContext(r.Context())
+}
+
+// logger returns a logger tagged with the request ID
+func logger(r *http.Request) *logrus.Entry {
+	return logging.FromContext(r.Context())
+}
@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"yokai/internal/anime"
+	"yokai/internal/imageproxy"
+)
+
+func (h *Handler) GetImage(w http.ResponseWriter, r *http.Request) {
+	src := r.URL.Query().Get("src")
+	if src == "" {
+		writeError(w, http.StatusBadRequest, CodeInvalidParameter, "Src is required")
+		return
+	}
+
+	var width int
+	if value := r.URL.Query().Get("w"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			writeError(w, http.StatusBadRequest, CodeInvalidParameter, "W must be a positive number")
+			return
+		}
+		width = parsed
+	}
+
+	img, err := h.images.Get(src, width)
+	if errors.Is(err, imageproxy.ErrInvalidSource) {
+		writeError(w, http.StatusBadRequest, CodeInvalidParameter, "Src must be an absolute http(s) URL")
+		return
+	}
+	if errors.Is(err, imageproxy.ErrHostNotAllowed) {
+		writeError(w, http.StatusForbidden, CodeForbidden, err.Error())
+		return
+	}
+	if err != nil {
+		logger(r).Errorf("Error getting image: %v", err.Error())
+		writeError(w, http.StatusBadGateway, CodeUpstreamFailed, "Error getting image")
+		return
+	}
+
+	w.Header().Set("Content-Type", img.ContentType)
+	w.Header().Set("ETag", img.ETag)
+	// A resized image never changes once cached
+	setCacheControl(w, cacheImage)
+	w.Header().Set("Cache-Control", w.Header().Get("Cache-Control")+", immutable")
+	http.ServeContent(w, r, "", img.ModTime, bytes.NewReader(img.Data))
+}
+
+// proxyImages reports whether the client asked for image URLs rewritten to the proxy
+func proxyImages(r *http.Request) bool {
+	enabled, _ := strconv.ParseBool(r.URL.Query().Get("proxy_images"))
+	return enabled
+}
+
+// imageURL rewrites an upstream image URL to go through the image proxy
+func (h *Handler) imageURL(r *http.Request, src string) string {
+	if src == "" || h.images.Allowed(src) != nil {
+		return src
+	}
+
+	query := url.Values{}
+	query.Set("src", src)
+	if width := r.URL.Query().Get("image_width"); width != "" {
+		query.Set("w", width)
+	}
+
+	return baseURL(r) + "/api/v1/image?" + query.Encode()
+}
+
+func (h *Handler) rewriteLatestEpisodes(r *http.Request, episodes []anime.LatestEpisode) {
+	if !proxyImages(r) {
+		return
+	}
+	for i := range episodes {
+		episodes[i].Img = h.imageURL(r, episodes[i].Img)
+	}
+}
+
+func (h *Handler) rewriteAnimes(r *http.Request, animes []anime.Anime) {
+	if !proxyImages(r) {
+		return
+	}
+	for i := range animes {
+		animes[i].Img = h.imageURL(r, animes[i].Img)
+	}
+}
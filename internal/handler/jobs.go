@@ -0,0 +1,241 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+	"yokai/internal/anime"
+	"yokai/internal/auth"
+	"yokai/internal/jobs"
+
+	"github.com/gorilla/mux"
+)
+
+// Operations a job can run
+const (
+	JobEpisodes = "episodes"
+	JobServers  = "servers"
+	JobStream   = "stream"
+)
+
+// jobRetryAfter is suggested to clients when the job queue is full
+const jobRetryAfter = 5 * time.Second
+
+type JobsHandler struct {
+	manager  *jobs.Manager
+	scrapper anime.Jkanime
+	ranking  *anime.Ranking
+}
+
+func NewJobsHandler(manager *jobs.Manager, scrapper anime.Jkanime, ranking *anime.Ranking) *JobsHandler {
+	return &JobsHandler{
+		manager:  manager,
+		scrapper: scrapper,
+		ranking:  ranking,
+	}
+}
+
+type createJobRequest struct {
+	Operation string `json:"operation"`
+	Slug      string `json:"slug"`
+	Episode   int    `json:"episode"`
+	Page      int    `json:"page"`
+	Server    string `json:"server"`
+	Probe     bool   `json:"probe"`
+}
+
+// streamResult is the result of a stream job
+type streamResult struct {
+	Server string `json:"server"`
+	URL    string `json:"url"`
+}
+
+// CreateJob queues a slow browser-driven operation and answers 202 with
+// the job to poll
+func (h *JobsHandler) CreateJob(w http.ResponseWriter, r *http.Request) {
+	var req createJobRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidParameter, "Body must be a JSON object")
+		return
+	}
+
+	if req.Slug == "" {
+		writeError(w, http.StatusBadRequest, CodeInvalidParameter, "Slug is required")
+		return
+	}
+
+	params := map[string]string{"slug": req.Slug}
+	var fn jobs.Func
+
+	switch req.Operation {
+	case JobEpisodes:
+		if req.Page < 1 {
+			req.Page = 1
+		}
+		params["page"] = strconv.Itoa(req.Page)
+		fn = h.episodes(req.Slug, req.Page)
+	case JobServers, JobStream:
+		if req.Episode < 1 {
+			writeError(w, http.StatusBadRequest, CodeInvalidParameter, "Episode must be a positive number")
+			return
+		}
+		params["episode"] = strconv.Itoa(req.Episode)
+
+		if req.Operation == JobServers {
+			params["probe"] = strconv.FormatBool(req.Probe)
+			fn = h.servers(req.Slug, strconv.Itoa(req.Episode), req.Probe)
+		} else {
+			if req.Server == "" {
+				req.Server = anime.AutoServer
+			}
+			params["server"] = req.Server
+			fn = h.stream(req.Slug, strconv.Itoa(req.Episode), req.Server)
+		}
+	default:
+		writeError(w, http.StatusBadRequest, CodeInvalidParameter, "Operation must be episodes, servers or stream")
+		return
+	}
+
+	job, err := h.manager.Submit(r.Context(), auth.IdentityFrom(r.Context()), req.Operation, params, fn)
+	if errors.Is(err, jobs.ErrQueueFull) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(jobRetryAfter.Seconds())))
+		writeError(w, http.StatusServiceUnavailable, CodeQueueFull, "Too many jobs are waiting, try again later")
+		return
+	}
+
+	setNoStore(w)
+	w.Header().Set("Location", "/api/jobs/"+job.ID)
+	writeStatus(w, r, http.StatusAccepted, job, nil)
+}
+
+func (h *JobsHandler) GetJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := h.job(w, r)
+	if !ok {
+		return
+	}
+
+	setNoStore(w)
+	writeJSON(w, r, job, nil)
+}
+
+// CancelJob stops a queued or running job
+func (h *JobsHandler) CancelJob(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.job(w, r); !ok {
+		return
+	}
+
+	job, err := h.manager.Cancel(mux.Vars(r)["id"])
+	if errors.Is(err, jobs.ErrFinished) {
+		writeError(w, http.StatusConflict, CodeConflict, "Job already finished")
+		return
+	}
+	if errors.Is(err, jobs.ErrNotFound) {
+		writeError(w, http.StatusNotFound, CodeNotFound, "Job not found")
+		return
+	}
+
+	setNoStore(w)
+	writeJSON(w, r, job, nil)
+}
+
+// GetJobEvents streams the job as Server-Sent Events every time its
+// status changes, and ends once it finished
+func (h *JobsHandler) GetJobEvents(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.job(w, r); !ok {
+		return
+	}
+	id := mux.Vars(r)["id"]
+
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		logger(r).Warnf("Error clearing write deadline for job events: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		job, changed, err := h.manager.Watch(id)
+		if err != nil {
+			return
+		}
+
+		data, err := json.Marshal(job)
+		if err != nil {
+			logger(r).Errorf("Error encoding job %s: %v", job.ID, err)
+			return
+		}
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", job.Status, data)
+		if err := rc.Flush(); err != nil || job.Finished() {
+			return
+		}
+
+	wait:
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-changed:
+				break wait
+			case <-heartbeat.C:
+				fmt.Fprint(w, ": heartbeat\n\n")
+				if err := rc.Flush(); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+// job looks up the job of the route, answering 404 for jobs of other clients
+func (h *JobsHandler) job(w http.ResponseWriter, r *http.Request) (jobs.Job, bool) {
+	job, err := h.manager.Get(mux.Vars(r)["id"])
+	if err != nil || job.Owner != auth.IdentityFrom(r.Context()) {
+		writeError(w, http.StatusNotFound, CodeNotFound, "Job not found")
+		return jobs.Job{}, false
+	}
+	return job, true
+}
+
+func (h *JobsHandler) episodes(slug string, page int) jobs.Func {
+	return func(ctx context.Context) (any, error) {
+		return h.scrapper.WithContext(ctx).GetEpisodes(slug, page)
+	}
+}
+
+func (h *JobsHandler) servers(slug, episode string, probe bool) jobs.Func {
+	return func(ctx context.Context) (any, error) {
+		scraper := h.scrapper.WithContext(ctx)
+		servers, err := scraper.GetServers(slug, episode)
+		if err != nil || !probe {
+			return servers, err
+		}
+		return scraper.ProbeServers(servers, probeParallelism), nil
+	}
+}
+
+func (h *JobsHandler) stream(slug, episode, name string) jobs.Func {
+	return func(ctx context.Context) (any, error) {
+		scraper := h.scrapper.WithContext(ctx)
+		servers, err := scraper.GetServers(slug, episode)
+		if err != nil {
+			return nil, err
+		}
+
+		server, streamingURL, err := resolveStream(scraper, h.ranking, servers, name)
+		if err != nil {
+			return nil, err
+		}
+		return streamResult{Server: server.Server, URL: streamingURL}, nil
+	}
+}
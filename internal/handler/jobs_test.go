@@ -0,0 +1,29 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"yokai/internal/anime"
+	"yokai/internal/jobs"
+)
+
+func TestCreateJobQueueFull(t *testing.T) {
+	// Without workers nor room in the queue, every job is turned down
+	h := NewJobsHandler(jobs.NewManager(1, 0, time.Minute), anime.Jkanime{}, nil)
+
+	w := httptest.NewRecorder()
+	h.CreateJob(w, httptest.NewRequest(http.MethodPost, "/api/jobs", strings.NewReader(`{"operation":"episodes","slug":"dandadan"}`)))
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status %d, want 503", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "5" {
+		t.Errorf("Retry-After = %q, want 5", got)
+	}
+	if !strings.Contains(w.Body.String(), CodeQueueFull) {
+		t.Errorf("body %s, want the %s code", w.Body.String(), CodeQueueFull)
+	}
+}
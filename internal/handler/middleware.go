@@ -0,0 +1,310 @@
+package handler
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"runtime/debug"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andybalholm/brotli"
+)
+
+// Names of the middlewares, routes opt out of them by name
+const (
+	MiddlewareCORS     = "cors"
+	MiddlewareRecover  = "recover"
+	MiddlewareCompress = "compress"
+	MiddlewareMaxBytes = "max_bytes"
+	MiddlewareTimeout  = "timeout"
+)
+
+// corsExposedHeaders are the response headers browsers let scripts read
+var corsExposedHeaders = []string{"X-Request-ID", "Link", "Location", "Retry-After", "Deprecation", "X-Okarun-Server"}
+
+// corsMaxAge is how long browsers may cache a preflight response
+const corsMaxAge = 10 * time.Minute
+
+// compressMinBytes is the smallest body worth compressing
+const compressMinBytes = 1024
+
+// Middleware is a named step of a Chain
+type Middleware struct {
+	Name string
+	Wrap func(http.Handler) http.Handler
+}
+
+// Chain is an ordered list of middlewares, the first one runs first
+type Chain []Middleware
+
+// NewChain creates a chain running middlewares in order
+func NewChain(middlewares ...Middleware) Chain {
+	return Chain(middlewares)
+}
+
+// With returns a copy of the chain with middlewares appended, for routes
+// that opt in to more than the default chain
+func (c Chain) With(middlewares ...Middleware) Chain {
+	return append(slices.Clip(c), middlewares...)
+}
+
+// Without returns a copy of the chain without the named middlewares, for
+// routes that opt out of some of them
+func (c Chain) Without(names ...string) Chain {
+	var chain Chain
+	for _, m := range c {
+		if !slices.Contains(names, m.Name) {
+			chain = append(chain, m)
+		}
+	}
+	return chain
+}
+
+// Then wraps h in the chain
+func (c Chain) Then(h http.Handler) http.Handler {
+	for i := len(c) - 1; i >= 0; i-- {
+		h = c[i].Wrap(h)
+	}
+	return h
+}
+
+// ThenFunc wraps f in the chain
+func (c Chain) ThenFunc(f http.HandlerFunc) http.Handler {
+	return c.Then(f)
+}
+
+// CORS answers preflight requests and adds the CORS headers to the
+// responses of allowed origins, "*" allows any origin
+func CORS(origins, methods, headers []string) Middleware {
+	anyOrigin := slices.Contains(origins, "*")
+	allowMethods := strings.Join(methods, ", ")
+	allowHeaders := strings.Join(headers, ", ")
+	exposeHeaders := strings.Join(corsExposedHeaders, ", ")
+	maxAge := strconv.Itoa(int(corsMaxAge.Seconds()))
+
+	return Middleware{Name: MiddlewareCORS, Wrap: func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Origin")
+
+			origin := r.Header.Get("Origin")
+			if origin == "" || !(anyOrigin || slices.Contains(origins, origin)) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Expose-Headers", exposeHeaders)
+
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				w.Header().Set("Access-Control-Allow-Methods", allowMethods)
+				w.Header().Set("Access-Control-Allow-Headers", allowHeaders)
+				w.Header().Set("Access-Control-Max-Age", maxAge)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}}
+}
+
+// Recover turns a panicking handler into a 500 in the response envelope
+func Recover() Middleware {
+	return Middleware{Name: MiddlewareRecover, Wrap: func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				err := recover()
+				if err == nil {
+					return
+				}
+				// The server aborts these on purpose, let it
+				if err == http.ErrAbortHandler {
+					panic(err)
+				}
+
+				logger(r).WithField("stack", string(debug.Stack())).Errorf("Panic serving %s: %v", r.URL.Path, err)
+				writeError(w, http.StatusInternalServerError, CodeInternal, "Internal server error")
+			}()
+
+			next.ServeHTTP(w, r)
+		})
+	}}
+}
+
+// MaxBytes rejects request bodies larger than limit with a 413
+func MaxBytes(limit int64) Middleware {
+	return Middleware{Name: MiddlewareMaxBytes, Wrap: func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > limit {
+				writeError(w, http.StatusRequestEntityTooLarge, CodePayloadTooLarge, "Request body is too large")
+				return
+			}
+
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+			next.ServeHTTP(w, r)
+		})
+	}}
+}
+
+// Timeout cancels the request context after d and answers 503 in the
+// response envelope. The response is buffered, so streaming routes must
+// opt out of it.
+func Timeout(d time.Duration) Middleware {
+	body, _ := json.Marshal(Response{
+		Error: &Error{Code: CodeTimeout, Message: "Request timed out"},
+	})
+
+	return Middleware{Name: MiddlewareTimeout, Wrap: func(next http.Handler) http.Handler {
+		timeout := http.TimeoutHandler(next, d, string(body))
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			timeout.ServeHTTP(&timeoutWriter{ResponseWriter: w}, r)
+		})
+	}}
+}
+
+// timeoutWriter labels the body http.TimeoutHandler writes on timeout as
+// JSON. Handler responses always carry their own Content-Type by then.
+type timeoutWriter struct {
+	http.ResponseWriter
+}
+
+func (w *timeoutWriter) WriteHeader(status int) {
+	if status == http.StatusServiceUnavailable && w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *timeoutWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Compress encodes text responses with brotli or gzip, whichever the
+// client prefers
+func Compress() Middleware {
+	return Middleware{Name: MiddlewareCompress, Wrap: func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+
+			encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+			if encoding == "" || r.Method == http.MethodHead || r.Header.Get("Range") != "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressWriter{ResponseWriter: w, encoding: encoding}
+			defer cw.Close()
+			next.ServeHTTP(cw, r)
+		})
+	}}
+}
+
+// negotiateEncoding picks br or gzip from an Accept-Encoding header
+func negotiateEncoding(header string) string {
+	accepted := map[string]bool{}
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if value, err := strconv.ParseFloat(q, 64); err == nil && value == 0 {
+				continue
+			}
+		}
+		accepted[strings.ToLower(name)] = true
+	}
+
+	switch {
+	case accepted["br"]:
+		return "br"
+	case accepted["gzip"], accepted["*"]:
+		return "gzip"
+	}
+	return ""
+}
+
+// compressible reports whether a content type benefits from compression,
+// images and video are compressed already
+func compressible(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.TrimSpace(mediaType)
+
+	return strings.HasPrefix(mediaType, "text/") ||
+		strings.HasSuffix(mediaType, "json") ||
+		strings.HasSuffix(mediaType, "xml") ||
+		strings.HasSuffix(mediaType, "javascript") ||
+		mediaType == "application/vnd.apple.mpegurl"
+}
+
+// compressWriter decides on the first write whether the response gets
+// compressed, based on its status, type and length
+type compressWriter struct {
+	http.ResponseWriter
+	encoding    string
+	encoder     io.WriteCloser
+	wroteHeader bool
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	w.wroteHeader = true
+
+	h := w.Header()
+	length, err := strconv.Atoi(h.Get("Content-Length"))
+	tooSmall := err == nil && length < compressMinBytes
+
+	if status == http.StatusOK && h.Get("Content-Encoding") == "" && !tooSmall && compressible(h.Get("Content-Type")) {
+		h.Set("Content-Encoding", w.encoding)
+		h.Del("Content-Length")
+		// The compressed body is a different representation
+		if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			h.Set("ETag", "W/"+etag)
+		}
+
+		if w.encoding == "br" {
+			w.encoder = brotli.NewWriterLevel(w.ResponseWriter, brotli.DefaultCompression)
+		} else {
+			w.encoder = gzip.NewWriter(w.ResponseWriter)
+		}
+	}
+
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if w.encoder != nil {
+		return w.encoder.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush pushes the compressed bytes written so far to the client
+func (w *compressWriter) Flush() {
+	if flusher, ok := w.encoder.(interface{ Flush() error }); ok {
+		flusher.Flush()
+	}
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *compressWriter) Close() error {
+	if w.encoder == nil {
+		return nil
+	}
+	return w.encoder.Close()
+}
+
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
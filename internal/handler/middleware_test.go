@@ -0,0 +1,280 @@
+package handler
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// tag is a middleware adding its name to the X-Chain header
+func tag(name string) Middleware {
+	return Middleware{Name: name, Wrap: func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("X-Chain", name)
+			next.ServeHTTP(w, r)
+		})
+	}}
+}
+
+var noContent = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNoContent)
+})
+
+func chainOf(c Chain) string {
+	w := httptest.NewRecorder()
+	c.Then(noContent).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	return strings.Join(w.Header().Values("X-Chain"), ",")
+}
+
+func TestChain(t *testing.T) {
+	base := NewChain(tag("a"), tag("b"))
+	with := base.With(tag("c"))
+	other := base.With(tag("d"))
+	without := with.Without("a", "c")
+
+	tests := []struct {
+		name  string
+		chain Chain
+		want  string
+	}{
+		{"base", base, "a,b"},
+		{"with", with, "a,b,c"},
+		{"other with of the same base", other, "a,b,d"},
+		{"without", without, "b"},
+		{"without unknown names", base.Without("z"), "a,b"},
+		{"empty", NewChain(), ""},
+	}
+
+	for _, tt := range tests {
+		if got := chainOf(tt.chain); got != tt.want {
+			t.Errorf("%s runs %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestStreamingChain(t *testing.T) {
+	// Built like the chain of the event streams, which must flush every event
+	// as it's written instead of buffering the response
+	routes := NewChain(Compress(), MaxBytes(1<<20), Timeout(10*time.Millisecond))
+	streaming := routes.Without(MiddlewareTimeout, MiddlewareCompress)
+
+	h := streaming.ThenFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(strings.Repeat("data: {}\n\n", 200)))
+		time.Sleep(30 * time.Millisecond)
+		w.Write([]byte("data: late\n\n"))
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/api/events", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK || !strings.HasSuffix(w.Body.String(), "data: late\n\n") {
+		t.Errorf("status %d, the stream was cut by the timeout", w.Code)
+	}
+	if got := w.Header().Get("Content-Encoding"); got != "" {
+		t.Errorf("Content-Encoding = %q, want the stream uncompressed", got)
+	}
+}
+
+func TestCORS(t *testing.T) {
+	tests := []struct {
+		name      string
+		origins   []string
+		method    string
+		origin    string
+		preflight bool
+		want      int
+		allowed   bool
+	}{
+		{"preflight", []string{"https://app.example"}, http.MethodOptions, "https://app.example", true, http.StatusNoContent, true},
+		{"preflight from any origin", []string{"*"}, http.MethodOptions, "https://other.example", true, http.StatusNoContent, true},
+		{"preflight from another origin", []string{"https://app.example"}, http.MethodOptions, "https://evil.example", true, http.StatusMethodNotAllowed, false},
+		{"OPTIONS without a requested method", []string{"https://app.example"}, http.MethodOptions, "https://app.example", false, http.StatusMethodNotAllowed, true},
+		{"request", []string{"https://app.example"}, http.MethodGet, "https://app.example", false, http.StatusOK, true},
+		{"request from another origin", []string{"https://app.example"}, http.MethodGet, "https://evil.example", false, http.StatusOK, false},
+		{"same origin request", []string{"*"}, http.MethodGet, "", false, http.StatusOK, false},
+	}
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewChain(CORS(tt.origins, []string{"GET", "POST"}, []string{"Content-Type", "X-API-Key"})).Then(next)
+
+			r := httptest.NewRequest(tt.method, "/api/v1/latest", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if tt.preflight {
+				r.Header.Set("Access-Control-Request-Method", "POST")
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != tt.want {
+				t.Errorf("status %d, want %d", w.Code, tt.want)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); (got == tt.origin && got != "") != tt.allowed {
+				t.Errorf("Access-Control-Allow-Origin = %q, allowed %v", got, tt.allowed)
+			}
+			if got := w.Header().Get("Vary"); got != "Origin" {
+				t.Errorf("Vary = %q, want Origin", got)
+			}
+
+			preflightAnswered := tt.preflight && tt.allowed
+			if got := w.Header().Get("Access-Control-Allow-Methods"); (got == "GET, POST") != preflightAnswered {
+				t.Errorf("Access-Control-Allow-Methods = %q", got)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Headers"); (got == "Content-Type, X-API-Key") != preflightAnswered {
+				t.Errorf("Access-Control-Allow-Headers = %q", got)
+			}
+			if got := w.Header().Get("Access-Control-Max-Age"); (got == "600") != preflightAnswered {
+				t.Errorf("Access-Control-Max-Age = %q", got)
+			}
+		})
+	}
+}
+
+func TestRecover(t *testing.T) {
+	h := NewChain(Recover()).ThenFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/latest", nil))
+
+	if w.Code != http.StatusInternalServerError || w.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("status %d, Content-Type %q, want a JSON 500", w.Code, w.Header().Get("Content-Type"))
+	}
+	var response Response
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil || response.Error == nil || response.Error.Code != CodeInternal {
+		t.Errorf("body %s (%v), want the %s error envelope", w.Body.String(), err, CodeInternal)
+	}
+	if strings.Contains(w.Body.String(), "boom") {
+		t.Error("the panic value leaked into the response")
+	}
+}
+
+func TestRecoverLetsAbortsThrough(t *testing.T) {
+	h := NewChain(Recover()).ThenFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	})
+
+	defer func() {
+		if err := recover(); err != http.ErrAbortHandler {
+			t.Errorf("recovered %v, want http.ErrAbortHandler", err)
+		}
+	}()
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+}
+
+func TestTimeout(t *testing.T) {
+	h := NewChain(Timeout(10 * time.Millisecond)).ThenFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Content-Type") != "application/json" ||
+		!strings.Contains(w.Body.String(), CodeTimeout) {
+		t.Errorf("status %d, Content-Type %q, body %s, want the JSON timeout error", w.Code, w.Header().Get("Content-Type"), w.Body.String())
+	}
+}
+
+func TestMaxBytes(t *testing.T) {
+	h := NewChain(MaxBytes(8)).ThenFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			writeError(w, http.StatusRequestEntityTooLarge, CodePayloadTooLarge, "Request body is too large")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		body string
+		want int
+	}{
+		{"small", http.StatusNoContent},
+		{"far too large", http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body)))
+		if w.Code != tt.want {
+			t.Errorf("body %q: status %d, want %d", tt.body, w.Code, tt.want)
+		}
+	}
+}
+
+func TestCompress(t *testing.T) {
+	large := `{"data":"` + strings.Repeat("a", 2*compressMinBytes) + `"}`
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		contentType    string
+		body           string
+		etag           string
+		encoding       string
+		wantETag       string
+	}{
+		{"gzip", "gzip, deflate", "application/json", large, `"abc"`, "gzip", `W/"abc"`},
+		{"brotli preferred", "gzip, br", "application/json", large, "", "br", ""},
+		{"refused encodings", "br;q=0, gzip;q=0", "application/json", large, "", "", ""},
+		{"too small", "gzip", "application/json", `{"data":1}`, `"abc"`, "", `"abc"`},
+		{"image", "gzip", "image/jpeg", large, "", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewChain(Compress()).ThenFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				w.Header().Set("Content-Length", strconv.Itoa(len(tt.body)))
+				if tt.etag != "" {
+					w.Header().Set("ETag", tt.etag)
+				}
+				w.Write([]byte(tt.body))
+			})
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if got := w.Header().Get("Content-Encoding"); got != tt.encoding {
+				t.Fatalf("Content-Encoding = %q, want %q", got, tt.encoding)
+			}
+			if got := w.Header().Get("ETag"); got != tt.wantETag {
+				t.Errorf("ETag = %q, want %q", got, tt.wantETag)
+			}
+
+			body := w.Body.String()
+			if tt.encoding == "gzip" {
+				reader, err := gzip.NewReader(w.Body)
+				if err != nil {
+					t.Fatalf("reading gzip: %v", err)
+				}
+				decoded, _ := io.ReadAll(reader)
+				body = string(decoded)
+			}
+			if tt.encoding != "br" && body != tt.body {
+				t.Errorf("body changed to %q", body)
+			}
+		})
+	}
+}
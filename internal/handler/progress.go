@@ -0,0 +1,174 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"yokai/internal/auth"
+	"yokai/internal/events"
+	"yokai/internal/progress"
+	"yokai/internal/watchlist"
+
+	"github.com/gorilla/mux"
+)
+
+// historyPageSize is how many episodes a page of history holds
+const historyPageSize = 50
+
+type ProgressHandler struct {
+	store      *progress.Store
+	watchlists *watchlist.Store
+	poller     *events.Poller
+}
+
+func NewProgressHandler(store *progress.Store, watchlists *watchlist.Store, poller *events.Poller) *ProgressHandler {
+	return &ProgressHandler{
+		store:      store,
+		watchlists: watchlists,
+		poller:     poller,
+	}
+}
+
+type saveProgressRequest struct {
+	Title     string  `json:"title"`
+	Position  float64 `json:"position"`
+	Duration  float64 `json:"duration"`
+	Completed bool    `json:"completed"`
+}
+
+// ListProgress returns the last episode watched of every anime, or the
+// episode to play next of the unfinished ones with ?continue=true
+func (h *ProgressHandler) ListProgress(w http.ResponseWriter, r *http.Request) {
+	continueWatching := false
+	if value := r.URL.Query().Get("continue"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, CodeInvalidParameter, "Continue must be a boolean")
+			return
+		}
+		continueWatching = parsed
+	}
+
+	user := auth.IdentityFrom(r.Context())
+	var entries []progress.Entry
+	var err error
+	if continueWatching {
+		lastEpisodes := make(map[string]int)
+		for slug, episode := range latestEpisodes(r, h.watchlists, h.poller) {
+			lastEpisodes[slug] = episode.Number()
+		}
+		entries, err = h.store.ContinueWatching(user, lastEpisodes)
+	} else {
+		entries, err = h.store.Latest(user)
+	}
+	if err != nil {
+		logger(r).Errorf("Error listing progress: %v", err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error listing progress")
+		return
+	}
+
+	setNoStore(w)
+	writeJSON(w, r, entries, nil)
+}
+
+// GetProgress returns every watched episode of an anime
+func (h *ProgressHandler) GetProgress(w http.ResponseWriter, r *http.Request) {
+	entries, err := h.store.Anime(auth.IdentityFrom(r.Context()), mux.Vars(r)["slug"])
+	if errors.Is(err, progress.ErrNotFound) {
+		writeError(w, http.StatusNotFound, CodeNotFound, "No progress for this anime")
+		return
+	}
+	if err != nil {
+		logger(r).Errorf("Error getting progress: %v", err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error getting progress")
+		return
+	}
+
+	setNoStore(w)
+	writeJSON(w, r, entries, nil)
+}
+
+// SaveProgress records the playback position of an episode, players send
+// it periodically while playing
+func (h *ProgressHandler) SaveProgress(w http.ResponseWriter, r *http.Request) {
+	episode, err := strconv.Atoi(mux.Vars(r)["episode"])
+	if err != nil || episode < 1 {
+		writeError(w, http.StatusBadRequest, CodeInvalidParameter, "Episode must be a positive number")
+		return
+	}
+
+	var req saveProgressRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidParameter, "Body must be a JSON object")
+		return
+	}
+
+	if req.Position < 0 || req.Duration < 0 {
+		writeError(w, http.StatusBadRequest, CodeInvalidParameter, "Position and duration can't be negative")
+		return
+	}
+
+	entry, err := h.store.Save(auth.IdentityFrom(r.Context()), mux.Vars(r)["slug"], episode, progress.Update{
+		Title:     strings.TrimSpace(req.Title),
+		Position:  req.Position,
+		Duration:  req.Duration,
+		Completed: req.Completed,
+	})
+	if err != nil {
+		logger(r).Errorf("Error saving progress: %v", err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error saving progress")
+		return
+	}
+
+	setNoStore(w)
+	writeJSON(w, r, entry, nil)
+}
+
+// DeleteProgress forgets an anime, removing it from the history
+func (h *ProgressHandler) DeleteProgress(w http.ResponseWriter, r *http.Request) {
+	err := h.store.Forget(auth.IdentityFrom(r.Context()), mux.Vars(r)["slug"])
+	if errors.Is(err, progress.ErrNotFound) {
+		writeError(w, http.StatusNotFound, CodeNotFound, "No progress for this anime")
+		return
+	}
+	if err != nil {
+		logger(r).Errorf("Error deleting progress: %v", err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error deleting progress")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetHistory returns every watched episode, most recent first
+func (h *ProgressHandler) GetHistory(w http.ResponseWriter, r *http.Request) {
+	page := 1
+	if value := r.URL.Query().Get("page"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			writeError(w, http.StatusBadRequest, CodeInvalidParameter, "Page must be a positive number")
+			return
+		}
+		page = parsed
+	}
+
+	entries, err := h.store.History(auth.IdentityFrom(r.Context()))
+	if err != nil {
+		logger(r).Errorf("Error getting history: %v", err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error getting history")
+		return
+	}
+
+	totalPages := max(1, (len(entries)+historyPageSize-1)/historyPageSize)
+	start := min((page-1)*historyPageSize, len(entries))
+	end := min(start+historyPageSize, len(entries))
+
+	setNoStore(w)
+	writeJSON(w, r, entries[start:end], &Pagination{
+		Page:       page,
+		HasNext:    page < totalPages,
+		TotalPages: totalPages,
+	})
+}
@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Error codes returned in the error envelope
+const (
+	CodeInvalidParameter = "invalid_parameter"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeNotFound         = "not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeConflict         = "conflict"
+	CodePayloadTooLarge  = "payload_too_large"
+	CodeRateLimited      = "rate_limited"
+	CodeScrapeFailed     = "scrape_failed"
+	CodeUpstreamFailed   = "upstream_failed"
+	CodeInternal         = "internal_error"
+	CodeTimeout          = "timeout"
+	CodeQueueFull        = "queue_full"
+	CodeDisabled         = "disabled"
+)
+
+// Response is the envelope every JSON endpoint answers with
+type Response struct {
+	Data       any         `json:"data"`
+	Pagination *Pagination `json:"pagination"`
+	Error      *Error      `json:"error"`
+}
+
+// Pagination describes where a page sits within a paginated collection
+type Pagination struct {
+	Page       int  `json:"page"`
+	HasNext    bool `json:"has_next"`
+	TotalPages int  `json:"total_pages,omitempty"`
+}
+
+// Error describes why a request failed
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// writeJSON writes data in the response envelope, adding Link headers for
+// the neighbouring pages when the data is paginated
+func writeJSON(w http.ResponseWriter, r *http.Request, data any, pagination *Pagination) {
+	writeStatus(w, r, http.StatusOK, data, pagination)
+}
+
+// writeCreated writes a newly created resource found at location
+func writeCreated(w http.ResponseWriter, r *http.Request, location string, data any) {
+	w.Header().Set("Location", location)
+	writeStatus(w, r, http.StatusCreated, data, nil)
+}
+
+// writeStatus writes data in the response envelope. Successful GET
+// responses carry an ETag of their body and answer If-None-Match with 304.
+func writeStatus(w http.ResponseWriter, r *http.Request, status int, data any, pagination *Pagination) {
+	if pagination != nil {
+		setPageLinks(w, r, pagination)
+	}
+
+	body, err := json.Marshal(Response{
+		Data:       data,
+		Pagination: pagination,
+	})
+	if err != nil {
+		logger(r).Errorf("Error encoding response: %v", err)
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error encoding response")
+		return
+	}
+	body = append(body, '\n')
+
+	if status == http.StatusOK && (r.Method == http.MethodGet || r.Method == http.MethodHead) {
+		etag := contentETag(body)
+		w.Header().Set("ETag", etag)
+
+		if etagMatches(r.Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// writeError writes an error in the response envelope
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(Response{
+		Error: &Error{Code: code, Message: message},
+	})
+}
+
+func setPageLinks(w http.ResponseWriter, r *http.Request, pagination *Pagination) {
+	var links []string
+	if pagination.HasNext {
+		links = append(links, fmt.Sprintf("<%s>; rel=\"next\"", pageURL(r, pagination.Page+1)))
+	}
+	if pagination.Page > 1 {
+		links = append(links, fmt.Sprintf("<%s>; rel=\"prev\"", pageURL(r, pagination.Page-1)))
+	}
+	if pagination.TotalPages > 0 {
+		links = append(links, fmt.Sprintf("<%s>; rel=\"first\"", pageURL(r, 1)))
+		links = append(links, fmt.Sprintf("<%s>; rel=\"last\"", pageURL(r, pagination.TotalPages)))
+	}
+
+	if len(links) > 0 {
+		w.Header().Add("Link", strings.Join(links, ", "))
+	}
+}
+
+// pageURL returns the request URL pointing at another page
+func pageURL(r *http.Request, page int) string {
+	query := r.URL.Query()
+	query.Set("page", strconv.Itoa(page))
+	return baseURL(r) + r.URL.Path + "?" + query.Encode()
+}
+
+func (h *Handler) NotFound(w http.ResponseWriter, r *http.Request) {
+	writeError(w, http.StatusNotFound, CodeNotFound, "Route not found")
+}
+
+func (h *Handler) MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	writeError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+}
@@ -0,0 +1,199 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"yokai/internal/anime"
+	"yokai/internal/auth"
+	"yokai/internal/events"
+	"yokai/internal/watchlist"
+
+	"github.com/gorilla/mux"
+)
+
+type WatchlistHandler struct {
+	store    *watchlist.Store
+	scrapper anime.Jkanime
+	poller   *events.Poller
+}
+
+func NewWatchlistHandler(store *watchlist.Store, scrapper anime.Jkanime, poller *events.Poller) *WatchlistHandler {
+	return &WatchlistHandler{
+		store:    store,
+		scrapper: scrapper,
+		poller:   poller,
+	}
+}
+
+type putWatchlistRequest struct {
+	Status string `json:"status"`
+}
+
+// watchlistEntry is a watchlist item with the latest episode known of it
+type watchlistEntry struct {
+	watchlist.Item
+	LatestEpisode *anime.LatestEpisode `json:"latest_episode,omitempty"`
+}
+
+var invalidStatusMessage = "Status must be one of " + strings.Join(watchlist.Statuses, ", ")
+
+func (h *WatchlistHandler) ListWatchlist(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status != "" && !watchlist.ValidStatus(status) {
+		writeError(w, http.StatusBadRequest, CodeInvalidParameter, invalidStatusMessage)
+		return
+	}
+
+	items, err := h.store.List(auth.IdentityFrom(r.Context()), status)
+	if err != nil {
+		logger(r).Errorf("Error listing watchlist: %v", err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error listing watchlist")
+		return
+	}
+
+	latest := latestEpisodes(r, h.store, h.poller)
+	entries := make([]watchlistEntry, len(items))
+	for i, item := range items {
+		entries[i] = enrich(item, latest)
+	}
+
+	setNoStore(w)
+	writeJSON(w, r, entries, nil)
+}
+
+func (h *WatchlistHandler) GetWatchlistItem(w http.ResponseWriter, r *http.Request) {
+	item, err := h.store.Get(auth.IdentityFrom(r.Context()), mux.Vars(r)["slug"])
+	if errors.Is(err, watchlist.ErrNotFound) {
+		writeError(w, http.StatusNotFound, CodeNotFound, "Anime not in watchlist")
+		return
+	}
+	if err != nil {
+		logger(r).Errorf("Error getting watchlist item: %v", err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error getting watchlist item")
+		return
+	}
+
+	setNoStore(w)
+	writeJSON(w, r, enrich(item, latestEpisodes(r, h.store, h.poller)), nil)
+}
+
+// PutWatchlistItem adds an anime to the watchlist, or changes its status
+// when it's there already. New anime are looked up so the list can show
+// them without scraping every time.
+func (h *WatchlistHandler) PutWatchlistItem(w http.ResponseWriter, r *http.Request) {
+	var req putWatchlistRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidParameter, "Body must be a JSON object")
+		return
+	}
+	if !watchlist.ValidStatus(req.Status) {
+		writeError(w, http.StatusBadRequest, CodeInvalidParameter, invalidStatusMessage)
+		return
+	}
+
+	user := auth.IdentityFrom(r.Context())
+	slug := mux.Vars(r)["slug"]
+
+	var details anime.Anime
+	if item, err := h.store.Get(user, slug); err == nil {
+		details = item.Anime
+	} else {
+		scraped, err := h.scrapper.WithContext(r.Context()).GetAnime(slug)
+		if err != nil {
+			logger(r).Errorf("Error getting anime details: %v", err.Error())
+			writeScrapeError(w, err, "Error getting anime details")
+			return
+		}
+		if scraped.Title == "" {
+			writeError(w, http.StatusNotFound, CodeNotFound, "Anime not found")
+			return
+		}
+		details = *scraped
+		details.Slug = slug
+		h.trackLatest(r, details)
+	}
+
+	item, created, err := h.store.Put(user, details, req.Status)
+	if err != nil {
+		logger(r).Errorf("Error saving watchlist item: %v", err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error saving watchlist item")
+		return
+	}
+
+	entry := enrich(item, latestEpisodes(r, h.store, h.poller))
+	setNoStore(w)
+	if created {
+		writeCreated(w, r, "/api/me/watchlist/"+url.PathEscape(slug), entry)
+		return
+	}
+	writeJSON(w, r, entry, nil)
+}
+
+func (h *WatchlistHandler) DeleteWatchlistItem(w http.ResponseWriter, r *http.Request) {
+	err := h.store.Remove(auth.IdentityFrom(r.Context()), mux.Vars(r)["slug"])
+	if errors.Is(err, watchlist.ErrNotFound) {
+		writeError(w, http.StatusNotFound, CodeNotFound, "Anime not in watchlist")
+		return
+	}
+	if err != nil {
+		logger(r).Errorf("Error deleting watchlist item: %v", err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error deleting watchlist item")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// latestEpisodes indexes the newest episode known of every anime by slug:
+// the ones stored from releases and new items, or on the front page when
+// the last poll saw a later one
+func latestEpisodes(r *http.Request, store *watchlist.Store, poller *events.Poller) map[string]anime.LatestEpisode {
+	latest, err := store.Latest()
+	if err != nil {
+		logger(r).Warnf("Error getting latest episodes: %v", err)
+		latest = make(map[string]anime.LatestEpisode)
+	}
+
+	for _, episode := range poller.Snapshot() {
+		if known, ok := latest[episode.Slug]; !ok || episode.Number() > known.Number() {
+			latest[episode.Slug] = episode
+		}
+	}
+	return latest
+}
+
+// trackLatest stores the last episode of an anime added to a watchlist,
+// releases only announce the episodes that come after it. The item is
+// still added when the episodes can't be scraped.
+func (h *WatchlistHandler) trackLatest(r *http.Request, details anime.Anime) {
+	episodes, err := h.scrapper.WithContext(r.Context()).GetEpisodes(details.Slug, 1)
+	if err != nil {
+		logger(r).Warnf("Error getting episodes of %s: %v", details.Slug, err)
+		return
+	}
+	if episodes.LastEpisode < 1 {
+		return
+	}
+
+	err = h.store.SetLatest(anime.LatestEpisode{
+		Slug:    details.Slug,
+		Img:     details.Img,
+		Title:   details.Title,
+		Episode: strconv.Itoa(episodes.LastEpisode),
+	})
+	if err != nil {
+		logger(r).Warnf("Error saving latest episode of %s: %v", details.Slug, err)
+	}
+}
+
+func enrich(item watchlist.Item, latest map[string]anime.LatestEpisode) watchlistEntry {
+	entry := watchlistEntry{Item: item}
+	if episode, ok := latest[item.Slug]; ok {
+		entry.LatestEpisode = &episode
+	}
+	return entry
+}
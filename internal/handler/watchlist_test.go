@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"yokai/internal/anime"
+	"yokai/internal/auth"
+	"yokai/internal/events"
+	"yokai/internal/storage/storagetest"
+	"yokai/internal/watchlist"
+
+	"github.com/gorilla/mux"
+)
+
+func TestWatchlistIsPrivate(t *testing.T) {
+	store := storagetest.NewStore(t, watchlist.NewStore)
+	if _, _, err := store.Put(auth.UserIdentity("alice"), anime.Anime{Slug: "one-piece"}, watchlist.StatusWatching); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	h := NewWatchlistHandler(store, anime.Jkanime{}, events.NewPoller(anime.Jkanime{}, 0, events.NewBroker(1)))
+	request := func(user, slug string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/api/me/watchlist/"+slug, nil)
+		if slug != "" {
+			r = mux.SetURLVars(r, map[string]string{"slug": slug})
+		}
+		return r.WithContext(auth.WithIdentity(r.Context(), auth.UserIdentity(user)))
+	}
+
+	w := httptest.NewRecorder()
+	h.GetWatchlistItem(w, request("alice", "one-piece"))
+	if w.Code != http.StatusOK {
+		t.Errorf("alice getting her item: status %d, want 200", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	h.GetWatchlistItem(w, request("bob", "one-piece"))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("bob getting alice's item: status %d, want 404", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	h.ListWatchlist(w, request("bob", ""))
+	var body struct {
+		Data []watchlistEntry `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decoding list: %v", err)
+	}
+	if w.Code != http.StatusOK || len(body.Data) != 0 {
+		t.Errorf("bob listing: status %d with %d items, want 200 with none", w.Code, len(body.Data))
+	}
+
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodDelete, "/api/me/watchlist/one-piece", nil)
+	r = mux.SetURLVars(r, map[string]string{"slug": "one-piece"})
+	h.DeleteWatchlistItem(w, r.WithContext(auth.WithIdentity(r.Context(), auth.UserIdentity("bob"))))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("bob deleting alice's item: status %d, want 404", w.Code)
+	}
+	if _, err := store.Get(auth.UserIdentity("alice"), "one-piece"); err != nil {
+		t.Errorf("alice's item is gone: %v", err)
+	}
+}
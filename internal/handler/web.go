@@ -0,0 +1,268 @@
+package handler
+
+import (
+	"bytes"
+	"embed"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"yokai/internal/anime"
+	"yokai/internal/auth"
+
+	"github.com/gorilla/mux"
+)
+
+//go:embed web/templates/*.html web/static
+var web embed.FS
+
+// pages holds every page template, each parsed along with the layout
+var pages = parsePages("latest", "search", "anime", "watch", "login", "error")
+
+// pageFuncs are the helpers available to the page templates
+var pageFuncs = template.FuncMap{
+	"add":         func(a, b int) int { return a + b },
+	"pathEscape":  url.PathEscape,
+	"queryEscape": url.QueryEscape,
+}
+
+func parsePages(names ...string) map[string]*template.Template {
+	parsed := make(map[string]*template.Template, len(names))
+	for _, name := range names {
+		parsed[name] = template.Must(template.New(name).Funcs(pageFuncs).ParseFS(web, "web/templates/layout.html", "web/templates/"+name+".html"))
+	}
+	return parsed
+}
+
+// webPage is the data every page template is rendered with
+type webPage struct {
+	Title string
+	// Query fills the search box
+	Query string
+	Data  any
+	// APIKey is carried along in links, browsers can't send the header
+	APIKey string
+	// User is the logged in user, if any
+	User string
+}
+
+// Link returns path, with the API key of the page when it has one. Links
+// to other sites never get the key.
+func (p webPage) Link(path string) string {
+	if p.APIKey == "" || !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") {
+		return path
+	}
+
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+	return path + separator + "api_key=" + url.QueryEscape(p.APIKey)
+}
+
+type animePage struct {
+	Anime    *anime.Anime
+	Episodes *anime.Episode
+}
+
+type watchPage struct {
+	Anime   *anime.Anime
+	Episode int
+	Servers []anime.Server
+	Server  string
+	PlayURL string
+}
+
+// staticFiles serves the stylesheet and scripts of the web UI
+var staticFiles = func() http.Handler {
+	static, _ := fs.Sub(web, "web/static")
+	return http.StripPrefix("/static/", http.FileServerFS(static))
+}()
+
+func (h *Handler) GetStatic(w http.ResponseWriter, r *http.Request) {
+	setCacheControl(w, cacheDocs)
+	staticFiles.ServeHTTP(w, r)
+}
+
+// WebLatest renders the home page with the latest episodes
+func (h *Handler) WebLatest(w http.ResponseWriter, r *http.Request) {
+	latestEpisodes, err := h.scraper(r).GetLatestEpisodes()
+	if err != nil {
+		logger(r).Errorf("Error getting latest episodes: %v", err.Error())
+		renderError(w, r, http.StatusBadGateway, "The latest episodes couldn't be loaded, try again later.")
+		return
+	}
+
+	for i := range latestEpisodes {
+		latestEpisodes[i].Img = h.webImageURL(latestEpisodes[i].Img)
+	}
+
+	render(w, r, "latest", cacheLatest, webPage{Title: "Latest episodes", Data: latestEpisodes})
+}
+
+// WebSearch renders the search results for the q query parameter
+func (h *Handler) WebSearch(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+
+	results := &anime.SearchResult{Page: page}
+	if query != "" {
+		var err error
+		results, err = h.scraper(r).GetSearchResults(query, page)
+		if err != nil {
+			logger(r).Errorf("Error getting search results: %v", err.Error())
+			renderError(w, r, http.StatusBadGateway, "The search couldn't be completed, try again later.")
+			return
+		}
+	}
+
+	for i := range results.Results {
+		results.Results[i].Img = h.webImageURL(results.Results[i].Img)
+	}
+
+	render(w, r, "search", cacheSearch, webPage{Title: "Search", Query: query, Data: results})
+}
+
+// WebAnime renders the details of an anime with a page of its episodes
+func (h *Handler) WebAnime(w http.ResponseWriter, r *http.Request) {
+	slug := mux.Vars(r)["slug"]
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+
+	animeDetails, err := h.scraper(r).GetAnime(slug)
+	if err != nil {
+		logger(r).Errorf("Error getting anime details: %v", err.Error())
+		renderError(w, r, http.StatusBadGateway, "The anime couldn't be loaded, try again later.")
+		return
+	}
+	if animeDetails.Title == "" {
+		renderError(w, r, http.StatusNotFound, "This anime doesn't exist.")
+		return
+	}
+	animeDetails.Slug = slug
+	animeDetails.Img = h.webImageURL(animeDetails.Img)
+
+	episodes, err := h.scraper(r).GetEpisodes(slug, page)
+	if err != nil {
+		logger(r).Errorf("Error getting episodes: %v", err.Error())
+		renderError(w, r, http.StatusBadGateway, "The episodes couldn't be loaded, try again later.")
+		return
+	}
+
+	render(w, r, "anime", cacheEpisodes, webPage{
+		Title: animeDetails.Title,
+		Data:  animePage{Anime: animeDetails, Episodes: episodes},
+	})
+}
+
+// WebWatch renders the player of an episode. The player loads the stream
+// from the play route, so the page shows up before the stream resolves.
+// The next episode is always linked, scraping the episode count would make
+// the page wait on a third browser; past the last one the link shows the
+// error page.
+func (h *Handler) WebWatch(w http.ResponseWriter, r *http.Request) {
+	slug := mux.Vars(r)["slug"]
+	episode, err := strconv.Atoi(mux.Vars(r)["episode"])
+	if err != nil || episode < 1 {
+		renderError(w, r, http.StatusNotFound, "This episode doesn't exist.")
+		return
+	}
+
+	animeDetails, err := h.scraper(r).GetAnime(slug)
+	if err != nil {
+		logger(r).Errorf("Error getting anime details: %v", err.Error())
+		renderError(w, r, http.StatusBadGateway, "The anime couldn't be loaded, try again later.")
+		return
+	}
+	animeDetails.Slug = slug
+
+	servers, err := h.scraper(r).GetServers(slug, strconv.Itoa(episode))
+	if err != nil {
+		logger(r).Errorf("Error getting servers: %v", err.Error())
+		renderError(w, r, http.StatusBadGateway, "The servers of this episode couldn't be loaded, try again later.")
+		return
+	}
+	if len(servers) == 0 {
+		renderError(w, r, http.StatusNotFound, "No server offers this episode.")
+		return
+	}
+
+	server := r.URL.Query().Get("server")
+	if server == "" {
+		server = anime.AutoServer
+	}
+
+	playURL := "/api/v1/anime/" + url.PathEscape(slug) + "/episodes/" + strconv.Itoa(episode) + "/play?server=" + url.QueryEscape(server)
+
+	render(w, r, "watch", cacheServers, webPage{
+		Title: animeDetails.Title + " - Episode " + strconv.Itoa(episode),
+		Data: watchPage{
+			Anime:   animeDetails,
+			Episode: episode,
+			Servers: servers,
+			Server:  server,
+			PlayURL: playURL,
+		},
+	})
+}
+
+// webImageURL sends cover images through the image proxy, upstream hosts
+// don't serve them to other sites
+func (h *Handler) webImageURL(src string) string {
+	if src == "" || h.images.Allowed(src) != nil {
+		return src
+	}
+	return "/api/v1/image?" + url.Values{"src": {src}, "w": {"320"}}.Encode()
+}
+
+// render writes the named page. Successful pages carry an ETag of their
+// body and may be cached for maxAge, unless they are personal.
+func render(w http.ResponseWriter, r *http.Request, name string, maxAge time.Duration, page webPage) {
+	renderStatus(w, r, http.StatusOK, name, maxAge, page)
+}
+
+// renderError writes the error page, the web counterpart of writeError
+func renderError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	renderStatus(w, r, status, "error", 0, webPage{Title: http.StatusText(status), Data: message})
+}
+
+func renderStatus(w http.ResponseWriter, r *http.Request, status int, name string, maxAge time.Duration, page webPage) {
+	page.APIKey = r.URL.Query().Get("api_key")
+	page.User, _ = auth.UserFrom(auth.IdentityFrom(r.Context()))
+
+	var body bytes.Buffer
+	if err := pages[name].ExecuteTemplate(&body, "layout", page); err != nil {
+		logger(r).Errorf("Error rendering page %s: %v", name, err)
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("Internal server error"))
+		return
+	}
+
+	if status != http.StatusOK || maxAge == 0 || page.APIKey != "" || page.User != "" {
+		setNoStore(w)
+	} else {
+		// Logging in changes the page header
+		w.Header().Add("Vary", "Cookie")
+		setCacheControl(w, maxAge)
+
+		etag := contentETag(body.Bytes())
+		w.Header().Set("ETag", etag)
+		if etagMatches(r.Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(body.Bytes())
+}
@@ -0,0 +1,87 @@
+// Plays the stream the play route redirects to. Browsers other than Safari
+// can't play HLS natively, so failed loads are retried with hls.js.
+(() => {
+  const video = document.getElementById("player");
+  const failed = document.getElementById("player-error");
+  const src = video.dataset.src;
+  let retried = false;
+
+  video.addEventListener("error", () => {
+    if (retried || !window.Hls || !Hls.isSupported()) {
+      failed.hidden = false;
+      return;
+    }
+    retried = true;
+
+    const hls = new Hls();
+    hls.on(Hls.Events.ERROR, (_, data) => {
+      if (data.fatal) {
+        hls.destroy();
+        failed.hidden = false;
+      }
+    });
+    hls.loadSource(src);
+    hls.attachMedia(video);
+  });
+
+  video.src = src;
+})();
+
+// Resumes the episode where it was left and reports the position to the
+// server while playing, so other clients can continue from there. Progress
+// is kept per user, there's nothing to do until logged in.
+(() => {
+  const video = document.getElementById("player");
+  if (!video.dataset.progress) {
+    return;
+  }
+  const episode = Number(video.dataset.episode);
+  const saveInterval = 15000;
+  let lastSaved = 0;
+
+  fetch(video.dataset.animeProgress)
+    .then((response) => (response.ok ? response.json() : null))
+    .then((body) => {
+      const entry = body && body.data.find((e) => e.episode === episode);
+      if (!entry || entry.completed || entry.position <= 0) {
+        return;
+      }
+      const resume = () => {
+        video.currentTime = entry.position;
+      };
+      if (video.readyState >= HTMLMediaElement.HAVE_METADATA) {
+        resume();
+      } else {
+        video.addEventListener("loadedmetadata", resume, { once: true });
+      }
+    })
+    .catch(() => {});
+
+  const save = (completed) => {
+    lastSaved = Date.now();
+    fetch(video.dataset.progress, {
+      method: "PUT",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify({
+        title: video.dataset.title,
+        position: video.currentTime,
+        duration: Number.isFinite(video.duration) ? video.duration : 0,
+        completed: completed,
+      }),
+      keepalive: true,
+    }).catch(() => {});
+  };
+
+  video.addEventListener("timeupdate", () => {
+    if (!video.paused && Date.now() - lastSaved >= saveInterval) {
+      save(false);
+    }
+  });
+  video.addEventListener("pause", () => save(false));
+  video.addEventListener("ended", () => save(true));
+  window.addEventListener("pagehide", () => {
+    if (video.currentTime > 0) {
+      save(false);
+    }
+  });
+})();
@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"yokai/internal/auth"
+)
+
+func TestWebPageLink(t *testing.T) {
+	tests := []struct {
+		apiKey string
+		path   string
+		want   string
+	}{
+		{"", "/anime/dandadan", "/anime/dandadan"},
+		{"s3cret", "/anime/dandadan", "/anime/dandadan?api_key=s3cret"},
+		{"s3cret", "/search?q=frieren", "/search?q=frieren&api_key=s3cret"},
+		{"a&b=c", "/", "/?api_key=a%26b%3Dc"},
+		{"s3cret", "//evil.example/x", "//evil.example/x"},
+		{"s3cret", "https://evil.example/x", "https://evil.example/x"},
+		{"s3cret", "anime/dandadan", "anime/dandadan"},
+	}
+
+	for _, tt := range tests {
+		if got := (webPage{APIKey: tt.apiKey}).Link(tt.path); got != tt.want {
+			t.Errorf("Link(%q) with key %q = %q, want %q", tt.path, tt.apiKey, got, tt.want)
+		}
+	}
+}
+
+func TestRenderStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		target   string
+		identity string
+		status   int
+		maxAge   time.Duration
+		cached   bool
+	}{
+		{name: "shared page", target: "/", status: http.StatusOK, maxAge: time.Minute, cached: true},
+		{name: "without max age", target: "/", status: http.StatusOK},
+		{name: "error page", target: "/", status: http.StatusNotFound, maxAge: time.Minute},
+		{name: "API key in the links", target: "/?api_key=s3cret", status: http.StatusOK, maxAge: time.Minute},
+		{name: "logged in", target: "/", identity: auth.UserIdentity("alice"), status: http.StatusOK, maxAge: time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := func(ifNoneMatch string) *httptest.ResponseRecorder {
+				r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+				if tt.identity != "" {
+					r = r.WithContext(auth.WithIdentity(r.Context(), tt.identity))
+				}
+				if ifNoneMatch != "" {
+					r.Header.Set("If-None-Match", ifNoneMatch)
+				}
+				w := httptest.NewRecorder()
+				renderStatus(w, r, tt.status, "error", tt.maxAge, webPage{Title: "Oops", Data: "Something happened."})
+				return w
+			}
+
+			w := request("")
+			if w.Code != tt.status || !strings.Contains(w.Body.String(), "Something happened.") {
+				t.Fatalf("status %d, body %s", w.Code, w.Body.String())
+			}
+
+			etag := w.Header().Get("ETag")
+			if !tt.cached {
+				if got := w.Header().Get("Cache-Control"); got != "no-store" || etag != "" {
+					t.Errorf("Cache-Control %q and ETag %q, want no-store without ETag", got, etag)
+				}
+				return
+			}
+
+			if got := w.Header().Get("Cache-Control"); got != "public, max-age=60" || etag == "" {
+				t.Fatalf("Cache-Control %q and ETag %q, want cacheable for a minute", got, etag)
+			}
+			if w := request(etag); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+				t.Errorf("revalidating: status %d with %d bytes, want an empty 304", w.Code, w.Body.Len())
+			}
+			if w := request(`"stale"`); w.Code != http.StatusOK {
+				t.Errorf("stale ETag: status %d, want 200", w.Code)
+			}
+		})
+	}
+}
+
+func TestRenderStatusCarriesTheAPIKey(t *testing.T) {
+	w := httptest.NewRecorder()
+	renderError(w, httptest.NewRequest(http.MethodGet, "/anime/x?api_key=s3cret", nil), http.StatusNotFound, "Not here.")
+
+	body := w.Body.String()
+	if !strings.Contains(body, `href="/?api_key=s3cret"`) || !strings.Contains(body, `name="api_key" value="s3cret"`) {
+		t.Errorf("the page links lose the API key: %s", body)
+	}
+}
@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"yokai/internal/auth"
+	"yokai/internal/netguard"
+	"yokai/internal/webhook"
+
+	"github.com/gorilla/mux"
+)
+
+type WebhookHandler struct {
+	store *webhook.Store
+}
+
+type createWebhookRequest struct {
+	URL   string   `json:"url"`
+	Slugs []string `json:"slugs"`
+}
+
+func NewWebhookHandler(store *webhook.Store) *WebhookHandler {
+	return &WebhookHandler{
+		store: store,
+	}
+}
+
+// ListWebhooks returns the subscriptions of the client
+func (h *WebhookHandler) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	owner := auth.IdentityFrom(r.Context())
+	subs := []webhook.Subscription{}
+	for _, sub := range h.store.List() {
+		if sub.Owner == owner {
+			subs = append(subs, sub.Redacted())
+		}
+	}
+
+	setNoStore(w)
+	writeJSON(w, r, subs, nil)
+}
+
+// CreateWebhook registers a subscription. The signing secret is only
+// returned in this response.
+func (h *WebhookHandler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var req createWebhookRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidParameter, "Body must be a JSON object")
+		return
+	}
+
+	target, err := url.Parse(req.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		writeError(w, http.StatusBadRequest, CodeInvalidParameter, "Url must be an absolute http(s) URL")
+		return
+	}
+
+	// Deliveries must not reach the network the server runs in
+	if err := netguard.CheckURL(r.Context(), target.String()); err != nil {
+		if errors.Is(err, netguard.ErrNotPublic) {
+			writeError(w, http.StatusBadRequest, CodeInvalidParameter, "Url must point to a public address")
+		} else {
+			writeError(w, http.StatusBadRequest, CodeInvalidParameter, "Url host could not be resolved")
+		}
+		return
+	}
+
+	var slugs []string
+	for _, slug := range req.Slugs {
+		if slug = strings.TrimSpace(slug); slug != "" {
+			slugs = append(slugs, slug)
+		}
+	}
+
+	sub, err := h.store.Create(auth.IdentityFrom(r.Context()), target.String(), slugs)
+	if err != nil {
+		logger(r).Errorf("Error creating webhook: %v", err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error creating webhook")
+		return
+	}
+
+	setNoStore(w)
+	writeCreated(w, r, "/api/v1/webhooks/"+sub.ID, sub)
+}
+
+func (h *WebhookHandler) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	sub, ok := h.subscription(w, r)
+	if !ok {
+		return
+	}
+
+	setNoStore(w)
+	writeJSON(w, r, sub.Redacted(), nil)
+}
+
+func (h *WebhookHandler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	sub, ok := h.subscription(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.store.Delete(sub.ID)
+	if errors.Is(err, webhook.ErrNotFound) {
+		writeError(w, http.StatusNotFound, CodeNotFound, "Webhook not found")
+		return
+	}
+	if err != nil {
+		logger(r).Errorf("Error deleting webhook: %v", err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Error deleting webhook")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *WebhookHandler) GetDeliveries(w http.ResponseWriter, r *http.Request) {
+	sub, ok := h.subscription(w, r)
+	if !ok {
+		return
+	}
+
+	deliveries, err := h.store.Deliveries(sub.ID)
+	if errors.Is(err, webhook.ErrNotFound) {
+		writeError(w, http.StatusNotFound, CodeNotFound, "Webhook not found")
+		return
+	}
+
+	setNoStore(w)
+	writeJSON(w, r, deliveries, nil)
+}
+
+// subscription returns the subscription of the route, answering 404 when
+// it doesn't exist or belongs to another client
+func (h *WebhookHandler) subscription(w http.ResponseWriter, r *http.Request) (webhook.Subscription, bool) {
+	sub, err := h.store.Get(mux.Vars(r)["id"])
+	if err != nil || sub.Owner != auth.IdentityFrom(r.Context()) {
+		writeError(w, http.StatusNotFound, CodeNotFound, "Webhook not found")
+		return webhook.Subscription{}, false
+	}
+	return sub, true
+}
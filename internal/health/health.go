@@ -0,0 +1,147 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Check statuses
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// CheckFunc reports whether a dependency is usable, it must give up once
+// ctx is done
+type CheckFunc func(ctx context.Context) error
+
+// Result is the outcome of a single check
+type Result struct {
+	Name      string `json:"name"`
+	Status    string `json:"status"`
+	LatencyMs int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Report is the outcome of every check, ok only when all of them passed
+type Report struct {
+	Status  string    `json:"status"`
+	Checked time.Time `json:"checked"`
+	Checks  []Result  `json:"checks"`
+}
+
+// OK reports whether every check passed
+func (r Report) OK() bool {
+	return r.Status == StatusOK
+}
+
+type check struct {
+	name string
+	fn   CheckFunc
+}
+
+// Checker runs the readiness checks concurrently. Reports are reused for
+// a while so frequent probes don't launch a browser every time.
+type Checker struct {
+	timeout  time.Duration
+	cacheFor time.Duration
+	checks   []check
+
+	mu   sync.Mutex
+	last *Report
+}
+
+// NewChecker creates a checker giving every check up to timeout and
+// reusing reports for cacheFor
+func NewChecker(timeout, cacheFor time.Duration) *Checker {
+	return &Checker{
+		timeout:  timeout,
+		cacheFor: cacheFor,
+	}
+}
+
+// Add registers a named check
+func (c *Checker) Add(name string, fn CheckFunc) {
+	c.checks = append(c.checks, check{name: name, fn: fn})
+}
+
+// Run returns the latest report, running the checks when it is stale
+func (c *Checker) Run(ctx context.Context) Report {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.last != nil && time.Since(c.last.Checked) < c.cacheFor {
+		return *c.last
+	}
+
+	report := Report{
+		Status:  StatusOK,
+		Checked: time.Now().UTC(),
+		Checks:  make([]Result, len(c.checks)),
+	}
+
+	var wg sync.WaitGroup
+	for i, check := range c.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			report.Checks[i] = c.run(ctx, check)
+		}()
+	}
+	wg.Wait()
+
+	for _, result := range report.Checks {
+		if result.Status != StatusOK {
+			report.Status = StatusFail
+		}
+	}
+
+	// A probe that gave up says nothing about the dependencies
+	if ctx.Err() == nil {
+		c.last = &report
+	}
+
+	return report
+}
+
+func (c *Checker) run(ctx context.Context, check check) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check.fn(ctx)
+	result := Result{
+		Name:      check.name,
+		Status:    StatusOK,
+		LatencyMs: time.Since(start).Milliseconds(),
+	}
+	if err == nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		result.Status = StatusFail
+		result.Error = err.Error()
+	}
+
+	return result
+}
+
+// WritableDir checks that files can be created in dir
+func WritableDir(dir string) CheckFunc {
+	return func(ctx context.Context) error {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+
+		f, err := os.CreateTemp(dir, ".health-*")
+		if err != nil {
+			return fmt.Errorf("%s is not writable: %w", dir, err)
+		}
+		f.Close()
+
+		return os.Remove(f.Name())
+	}
+}
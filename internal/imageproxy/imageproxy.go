@@ -0,0 +1,350 @@
+package imageproxy
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"yokai/internal/metrics"
+	"yokai/internal/netguard"
+
+	_ "image/gif"
+	_ "image/png"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+var (
+	// ErrHostNotAllowed is returned for sources outside the allowed hosts
+	ErrHostNotAllowed = errors.New("image host not allowed")
+	// ErrInvalidSource is returned for sources that are not absolute http(s) URLs
+	ErrInvalidSource = errors.New("invalid image source")
+	// ErrTooLarge is returned for sources over maxSourceBytes or maxPixels
+	ErrTooLarge = errors.New("image too large")
+)
+
+// Widths are the sizes images are resized to, a requested width is rounded
+// up to the closest one so the cache only holds a handful of variants.
+var Widths = []int{160, 320, 480, 640, 960, 1280}
+
+const (
+	maxSourceBytes = 10 << 20
+	// maxPixels bounds the decoded size, a small file can declare huge dimensions
+	maxPixels    = 40_000_000
+	maxRedirects = 5
+	jpegQuality  = 85
+)
+
+// Image is a cached, re-encoded image
+type Image struct {
+	Data        []byte
+	ContentType string
+	ETag        string
+	ModTime     time.Time
+}
+
+// meta is stored next to every cached image
+type meta struct {
+	Source      string    `json:"source"`
+	Width       int       `json:"width"`
+	ETag        string    `json:"etag"`
+	ContentType string    `json:"content_type"`
+	Fetched     time.Time `json:"fetched"`
+}
+
+// Proxy fetches images from allowed hosts and caches them on disk
+type Proxy struct {
+	dir          string
+	allowedHosts []string
+	client       *http.Client
+}
+
+// New creates a proxy caching images in dir. Hosts match themselves and
+// any of their subdomains.
+func New(dir string, allowedHosts []string) *Proxy {
+	metrics.KnownHosts(allowedHosts...)
+
+	p := &Proxy{
+		dir:          dir,
+		allowedHosts: allowedHosts,
+	}
+
+	p.client = &http.Client{
+		Timeout:   15 * time.Second,
+		Transport: netguard.Transport(),
+		// Every hop has to stay on the allowed hosts
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return errors.New("too many redirects")
+			}
+			return p.Allowed(req.URL.String())
+		},
+	}
+
+	return p
+}
+
+// Allowed reports whether src may be fetched through the proxy
+func (p *Proxy) Allowed(src string) error {
+	u, err := url.Parse(src)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ErrInvalidSource
+	}
+
+	host := strings.ToLower(u.Hostname())
+	for _, allowed := range p.allowedHosts {
+		allowed = strings.ToLower(strings.TrimSpace(allowed))
+		if allowed != "" && (host == allowed || strings.HasSuffix(host, "."+allowed)) {
+			return nil
+		}
+	}
+
+	return ErrHostNotAllowed
+}
+
+// Get returns the image at src resized to width, from cache when possible.
+// A width of 0 keeps the original size up to the largest allowed width.
+func (p *Proxy) Get(src string, width int) (*Image, error) {
+	if err := p.Allowed(src); err != nil {
+		return nil, err
+	}
+
+	width = SnapWidth(width)
+	key := cacheKey(src, width)
+
+	if img, err := p.load(key); err == nil {
+		metrics.CacheHit("images")
+		return img, nil
+	}
+	metrics.CacheMiss("images")
+
+	data, err := p.fetch(src)
+	if err != nil {
+		return nil, err
+	}
+
+	encoded, err := encode(data, width)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(encoded)
+	img := &Image{
+		Data:        encoded,
+		ContentType: "image/jpeg",
+		ETag:        `"` + hex.EncodeToString(sum[:8]) + `"`,
+		ModTime:     time.Now().UTC().Truncate(time.Second),
+	}
+
+	if err := p.store(key, src, width, img); err != nil {
+		return nil, err
+	}
+
+	return img, nil
+}
+
+// SnapWidth rounds width up to the closest supported size
+func SnapWidth(width int) int {
+	if width <= 0 {
+		return 0
+	}
+	for _, w := range Widths {
+		if width <= w {
+			return w
+		}
+	}
+	return Widths[len(Widths)-1]
+}
+
+// Purge removes the cached images whose source starts with prefix, every
+// image when prefix is empty, and returns how many were removed
+func (p *Proxy) Purge(prefix string) (int, error) {
+	paths, err := filepath.Glob(filepath.Join(p.dir, "*.json"))
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, path := range paths {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+
+		var m meta
+		if err := json.Unmarshal(raw, &m); err != nil || !strings.HasPrefix(m.Source, prefix) {
+			continue
+		}
+
+		// The metadata goes first so readers never see it without its image
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return purged, err
+		}
+		if err := os.Remove(strings.TrimSuffix(path, ".json") + ".jpg"); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return purged, err
+		}
+		purged++
+	}
+
+	return purged, nil
+}
+
+func (p *Proxy) fetch(src string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, src, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 Chrome/120.0.0.0 Safari/537.36")
+	// Hot-link protection only lets requests coming from the site itself through
+	req.Header.Set("Referer", "https://jkanime.net/")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	metrics.UpstreamResponse(req.URL.Hostname(), resp.StatusCode)
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("upstream answered %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxSourceBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxSourceBytes {
+		return nil, ErrTooLarge
+	}
+
+	return data, nil
+}
+
+// encode decodes any supported format and re-encodes it as a JPEG no wider than width
+func encode(data []byte, width int) ([]byte, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if config.Width*config.Height > maxPixels {
+		return nil, ErrTooLarge
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	if width == 0 {
+		width = Widths[len(Widths)-1]
+	}
+
+	bounds := src.Bounds()
+	size := image.Rect(0, 0, bounds.Dx(), bounds.Dy())
+	if bounds.Dx() > width {
+		height := bounds.Dy() * width / bounds.Dx()
+		if height < 1 {
+			height = 1
+		}
+		size = image.Rect(0, 0, width, height)
+	}
+
+	// JPEG has no alpha, transparent covers go on white instead of black
+	dst := image.NewRGBA(size)
+	draw.Draw(dst, size, image.White, image.Point{}, draw.Src)
+	if size.Dx() != bounds.Dx() {
+		draw.CatmullRom.Scale(dst, size, src, bounds, draw.Over, nil)
+	} else {
+		draw.Draw(dst, size, src, bounds.Min, draw.Over)
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: jpegQuality}); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (p *Proxy) load(key string) (*Image, error) {
+	raw, err := os.ReadFile(filepath.Join(p.dir, key+".json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var m meta
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(filepath.Join(p.dir, key+".jpg"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Image{
+		Data:        data,
+		ContentType: m.ContentType,
+		ETag:        m.ETag,
+		ModTime:     m.Fetched,
+	}, nil
+}
+
+func (p *Proxy) store(key, src string, width int, img *Image) error {
+	if err := os.MkdirAll(p.dir, 0o755); err != nil {
+		return err
+	}
+
+	raw, err := json.Marshal(meta{
+		Source:      src,
+		Width:       width,
+		ETag:        img.ETag,
+		ContentType: img.ContentType,
+		Fetched:     img.ModTime,
+	})
+	if err != nil {
+		return err
+	}
+
+	// The metadata is written last so readers never see it without its image
+	if err := writeFile(filepath.Join(p.dir, key+".jpg"), img.Data); err != nil {
+		return err
+	}
+
+	return writeFile(filepath.Join(p.dir, key+".json"), raw)
+}
+
+func writeFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func cacheKey(src string, width int) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%d", src, width)))
+	return hex.EncodeToString(sum[:])
+}
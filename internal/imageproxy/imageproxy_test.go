@@ -0,0 +1,185 @@
+package imageproxy
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// newTestProxy serves images from a loopback server, which the public
+// address check of the real transport would refuse
+func newTestProxy(t *testing.T, handler http.Handler) (*Proxy, *httptest.Server) {
+	t.Helper()
+
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	p := New(t.TempDir(), []string{"127.0.0.1"})
+	p.client.Transport = srv.Client().Transport
+	return p, srv
+}
+
+func pngImage(t *testing.T, width, height int) []byte {
+	t.Helper()
+
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for x := range width {
+		img.Set(x, 0, color.NRGBA{R: 255, A: 255})
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestGet(t *testing.T) {
+	var requests atomic.Int32
+	data := pngImage(t, 1000, 500)
+	p, srv := newTestProxy(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Write(data)
+	}))
+
+	img, err := p.Get(srv.URL+"/cover.png", 300)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	config, format, err := image.DecodeConfig(bytes.NewReader(img.Data))
+	if err != nil || format != "jpeg" || config.Width != 320 || config.Height != 160 {
+		t.Errorf("got %s %dx%d (%v), want a 320x160 jpeg", format, config.Width, config.Height, err)
+	}
+
+	cached, err := p.Get(srv.URL+"/cover.png", 320)
+	if err != nil || cached.ETag != img.ETag {
+		t.Errorf("cached Get = %v, %v, want the same image", cached, err)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("fetched %d times, want 1", n)
+	}
+}
+
+func TestGetRefusesSources(t *testing.T) {
+	var requests atomic.Int32
+	p, srv := newTestProxy(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+	}))
+
+	tests := []struct {
+		src  string
+		want error
+	}{
+		{"http://evil.example/cover.png", ErrHostNotAllowed},
+		{"http://127.0.0.1.evil.example/cover.png", ErrHostNotAllowed},
+		{"ftp://127.0.0.1/cover.png", ErrInvalidSource},
+		{"/cover.png", ErrInvalidSource},
+		{strings.Replace(srv.URL, "http", "file", 1), ErrInvalidSource},
+	}
+
+	for _, tt := range tests {
+		if _, err := p.Get(tt.src, 0); !errors.Is(err, tt.want) {
+			t.Errorf("Get(%s) = %v, want %v", tt.src, err, tt.want)
+		}
+	}
+	if n := requests.Load(); n != 0 {
+		t.Errorf("fetched %d refused sources", n)
+	}
+}
+
+func TestGetRefusesRedirectsOffTheAllowlist(t *testing.T) {
+	var redirected atomic.Int32
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		redirected.Add(1)
+	}))
+	defer other.Close()
+
+	// localhost is the same server under a host that isn't allowed
+	target := strings.Replace(other.URL, "127.0.0.1", "localhost", 1)
+	p, srv := newTestProxy(t, http.RedirectHandler(target+"/metadata", http.StatusFound))
+
+	if _, err := p.Get(srv.URL+"/cover.png", 0); !errors.Is(err, ErrHostNotAllowed) {
+		t.Errorf("Get = %v, want ErrHostNotAllowed", err)
+	}
+	if redirected.Load() != 0 {
+		t.Error("followed a redirect off the allowed hosts")
+	}
+}
+
+func TestGetRefusesLargeImages(t *testing.T) {
+	// A GIF header declaring a 10000x10000 image in a few bytes
+	bomb := []byte("GIF89a\x10\x27\x10\x27\x00\x00\x00")
+
+	tests := []struct {
+		name string
+		body []byte
+	}{
+		{"over maxSourceBytes", bytes.Repeat([]byte{0}, maxSourceBytes+1)},
+		{"over maxPixels", bomb},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, srv := newTestProxy(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write(tt.body)
+			}))
+
+			if _, err := p.Get(srv.URL+"/cover.gif", 0); !errors.Is(err, ErrTooLarge) {
+				t.Errorf("Get = %v, want ErrTooLarge", err)
+			}
+		})
+	}
+}
+
+func TestGetUpstreamError(t *testing.T) {
+	p, srv := newTestProxy(t, http.NotFoundHandler())
+
+	if _, err := p.Get(srv.URL+"/cover.png", 0); err == nil {
+		t.Error("Get of a missing image succeeded")
+	}
+}
+
+func TestPurge(t *testing.T) {
+	data := pngImage(t, 100, 100)
+	p, srv := newTestProxy(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(data)
+	}))
+
+	for _, src := range []string{"/covers/a.png", "/covers/b.png", "/banners/a.png"} {
+		for _, width := range []int{0, 160} {
+			if _, err := p.Get(srv.URL+src, width); err != nil {
+				t.Fatalf("Get(%s): %v", src, err)
+			}
+		}
+	}
+
+	purged, err := p.Purge(srv.URL + "/covers/")
+	if err != nil || purged != 4 {
+		t.Errorf("Purge of the covers = %d, %v, want 4", purged, err)
+	}
+	if _, err := p.load(cacheKey(srv.URL+"/covers/a.png", 0)); err == nil {
+		t.Error("a purged image is still cached")
+	}
+	if _, err := p.load(cacheKey(srv.URL+"/banners/a.png", 0)); err != nil {
+		t.Errorf("Purge removed an image outside the prefix: %v", err)
+	}
+
+	if purged, err := p.Purge(""); err != nil || purged != 2 {
+		t.Errorf("Purge of everything = %d, %v, want 2", purged, err)
+	}
+}
+
+func TestSnapWidth(t *testing.T) {
+	tests := map[int]int{-1: 0, 0: 0, 1: 160, 160: 160, 161: 320, 1280: 1280, 5000: 1280}
+	for width, want := range tests {
+		if got := SnapWidth(width); got != want {
+			t.Errorf("SnapWidth(%d) = %d, want %d", width, got, want)
+		}
+	}
+}
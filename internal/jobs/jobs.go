@@ -0,0 +1,292 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Job statuses
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+)
+
+var (
+	// ErrNotFound is returned for unknown or expired jobs
+	ErrNotFound = errors.New("job not found")
+	// ErrQueueFull is returned when too many jobs are waiting for a worker
+	ErrQueueFull = errors.New("job queue is full")
+	// ErrFinished is returned when cancelling a job that already finished
+	ErrFinished = errors.New("job already finished")
+)
+
+// minTTL is the shortest time finished jobs are kept, so clients get a
+// chance to fetch their result
+const minTTL = time.Second
+
+// Func does the work of a job, it must give up once ctx is done
+type Func func(ctx context.Context) (any, error)
+
+// Job is a snapshot of an asynchronous operation
+type Job struct {
+	ID         string            `json:"id"`
+	Operation  string            `json:"operation"`
+	Params     map[string]string `json:"params,omitempty"`
+	Status     string            `json:"status"`
+	Result     any               `json:"result,omitempty"`
+	Error      string            `json:"error,omitempty"`
+	CreatedAt  time.Time         `json:"created_at"`
+	StartedAt  *time.Time        `json:"started_at,omitempty"`
+	FinishedAt *time.Time        `json:"finished_at,omitempty"`
+	ExpiresAt  *time.Time        `json:"expires_at,omitempty"`
+	// Owner is the client that submitted the job, only it may see the job
+	Owner string `json:"-"`
+}
+
+// Finished reports whether the job won't change anymore
+func (j Job) Finished() bool {
+	return j.Status == StatusSucceeded || j.Status == StatusFailed || j.Status == StatusCancelled
+}
+
+type entry struct {
+	job    Job
+	fn     Func
+	ctx    context.Context
+	cancel context.CancelFunc
+	// changed is closed and replaced on every status change
+	changed chan struct{}
+}
+
+// Manager runs jobs on a bounded pool of workers and keeps finished jobs
+// around for a while so clients can fetch their result
+type Manager struct {
+	workers int
+	ttl     time.Duration
+	queue   chan *entry
+
+	mu   sync.Mutex
+	jobs map[string]*entry
+}
+
+// NewManager creates a manager running up to workers jobs at once, with
+// up to queueSize more waiting, and keeping finished jobs for ttl
+func NewManager(workers, queueSize int, ttl time.Duration) *Manager {
+	if workers < 1 {
+		workers = 1
+	}
+	if queueSize < 0 {
+		queueSize = 0
+	}
+	if ttl < minTTL {
+		ttl = minTTL
+	}
+	return &Manager{
+		workers: workers,
+		ttl:     ttl,
+		queue:   make(chan *entry, queueSize),
+		jobs:    make(map[string]*entry),
+	}
+}
+
+// Run starts the workers and expires finished jobs until ctx is
+// cancelled, then cancels every job still pending
+func (m *Manager) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for range m.workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.work(ctx)
+		}()
+	}
+
+	ticker := time.NewTicker(m.ttl/2 + time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			m.mu.Lock()
+			for _, e := range m.jobs {
+				e.cancel()
+			}
+			m.mu.Unlock()
+			wg.Wait()
+			return
+		case <-ticker.C:
+			m.expire()
+		}
+	}
+}
+
+// Submit queues fn as a new job owned by owner. The job keeps the values
+// of ctx, like the request ID, but not its cancellation.
+func (m *Manager) Submit(ctx context.Context, owner, operation string, params map[string]string, fn Func) (Job, error) {
+	jobCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	e := &entry{
+		job: Job{
+			ID:        newID(),
+			Operation: operation,
+			Params:    params,
+			Status:    StatusQueued,
+			CreatedAt: time.Now().UTC(),
+			Owner:     owner,
+		},
+		fn:      fn,
+		ctx:     jobCtx,
+		cancel:  cancel,
+		changed: make(chan struct{}),
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	select {
+	case m.queue <- e:
+	default:
+		cancel()
+		return Job{}, ErrQueueFull
+	}
+	m.jobs[e.job.ID] = e
+
+	return e.job, nil
+}
+
+// Get returns the job with id
+func (m *Manager) Get(id string) (Job, error) {
+	job, _, err := m.Watch(id)
+	return job, err
+}
+
+// Watch returns the job with id and a channel closed on its next change
+func (m *Manager) Watch(id string) (Job, <-chan struct{}, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.jobs[id]
+	if !ok {
+		return Job{}, nil, ErrNotFound
+	}
+	return e.job, e.changed, nil
+}
+
+// Cancel stops a queued or running job
+func (m *Manager) Cancel(id string) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.jobs[id]
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+	if e.job.Finished() {
+		return e.job, ErrFinished
+	}
+
+	e.cancel()
+	// A running job is marked cancelled by its worker once it returns
+	if e.job.Status == StatusQueued {
+		m.finish(e, nil, context.Canceled)
+	}
+
+	return e.job, nil
+}
+
+func (m *Manager) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-m.queue:
+			m.run(e)
+		}
+	}
+}
+
+func (m *Manager) run(e *entry) {
+	m.mu.Lock()
+	if e.job.Status != StatusQueued {
+		m.mu.Unlock()
+		return
+	}
+	started := time.Now().UTC()
+	e.job.Status = StatusRunning
+	e.job.StartedAt = &started
+	m.notify(e)
+	m.mu.Unlock()
+
+	result, err := m.call(e)
+
+	m.mu.Lock()
+	m.finish(e, result, err)
+	m.mu.Unlock()
+}
+
+// call runs the job, turning a panic into a failure instead of taking the
+// whole server down
+func (m *Manager) call(e *entry) (result any, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			logrus.Errorf("Job %s (%s) panicked: %v", e.job.ID, e.job.Operation, p)
+			err = errors.New("job panicked")
+		}
+	}()
+
+	return e.fn(e.ctx)
+}
+
+// finish records the outcome of a job, m.mu must be held
+func (m *Manager) finish(e *entry, result any, err error) {
+	finished := time.Now().UTC()
+	expires := finished.Add(m.ttl)
+
+	switch {
+	case e.ctx.Err() != nil:
+		e.job.Status = StatusCancelled
+		e.job.Error = "job was cancelled"
+	case err != nil:
+		e.job.Status = StatusFailed
+		e.job.Error = err.Error()
+	default:
+		e.job.Status = StatusSucceeded
+		e.job.Result = result
+	}
+	e.job.FinishedAt = &finished
+	e.job.ExpiresAt = &expires
+	e.cancel()
+	m.notify(e)
+}
+
+// notify wakes up the watchers of a job, m.mu must be held
+func (m *Manager) notify(e *entry) {
+	close(e.changed)
+	e.changed = make(chan struct{})
+}
+
+// expire drops the finished jobs older than the TTL
+func (m *Manager) expire() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for id, e := range m.jobs {
+		if e.job.ExpiresAt != nil && now.After(*e.job.ExpiresAt) {
+			delete(m.jobs, id)
+		}
+	}
+}
+
+func newID() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
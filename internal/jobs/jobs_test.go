@@ -0,0 +1,203 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// start runs a manager until the test ends
+func start(t *testing.T, workers, queueSize int, ttl time.Duration) *Manager {
+	t.Helper()
+
+	m := NewManager(workers, queueSize, ttl)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		m.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return m
+}
+
+// wait blocks until the job with id reaches status
+func wait(t *testing.T, m *Manager, id, status string) Job {
+	t.Helper()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		job, changed, err := m.Watch(id)
+		if err != nil {
+			t.Fatalf("Watch(%s): %v", id, err)
+		}
+		if job.Status == status {
+			return job
+		}
+		select {
+		case <-changed:
+		case <-timeout:
+			t.Fatalf("job %s is %s, want %s", id, job.Status, status)
+		}
+	}
+}
+
+// blocking returns a job func that signals started and runs until cancelled
+func blocking(started chan<- struct{}) Func {
+	return func(ctx context.Context) (any, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+}
+
+func TestNewManagerClampsTTL(t *testing.T) {
+	for _, ttl := range []time.Duration{-time.Hour, 0, time.Millisecond} {
+		if m := NewManager(1, 1, ttl); m.ttl != minTTL {
+			t.Errorf("NewManager(ttl %v) keeps jobs for %v, want %v", ttl, m.ttl, minTTL)
+		}
+	}
+	if m := NewManager(1, 1, time.Hour); m.ttl != time.Hour {
+		t.Errorf("NewManager(ttl 1h) keeps jobs for %v", m.ttl)
+	}
+}
+
+func TestJobSucceeds(t *testing.T) {
+	m := start(t, 1, 1, time.Minute)
+
+	job, err := m.Submit(context.Background(), "ops", "episodes", nil, func(ctx context.Context) (any, error) {
+		return 42, nil
+	})
+	if err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	if job.Status != StatusQueued || job.Owner != "ops" {
+		t.Errorf("submitted job = %+v, want queued and owned by ops", job)
+	}
+
+	job = wait(t, m, job.ID, StatusSucceeded)
+	if job.Result != 42 || job.StartedAt == nil || job.FinishedAt == nil || job.ExpiresAt == nil {
+		t.Errorf("finished job = %+v", job)
+	}
+	if _, err := m.Cancel(job.ID); !errors.Is(err, ErrFinished) {
+		t.Errorf("Cancel of a finished job: %v, want ErrFinished", err)
+	}
+}
+
+func TestJobFails(t *testing.T) {
+	m := start(t, 1, 1, time.Minute)
+
+	failed, _ := m.Submit(context.Background(), "ops", "episodes", nil, func(ctx context.Context) (any, error) {
+		return nil, errors.New("no episodes")
+	})
+	if job := wait(t, m, failed.ID, StatusFailed); job.Error != "no episodes" {
+		t.Errorf("Error = %q, want no episodes", job.Error)
+	}
+
+	panicked, _ := m.Submit(context.Background(), "ops", "episodes", nil, func(ctx context.Context) (any, error) {
+		panic("boom")
+	})
+	if job := wait(t, m, panicked.ID, StatusFailed); job.Error != "job panicked" {
+		t.Errorf("Error = %q, want job panicked", job.Error)
+	}
+}
+
+func TestCancelQueuedJob(t *testing.T) {
+	m := start(t, 1, 1, time.Minute)
+
+	started := make(chan struct{})
+	running, _ := m.Submit(context.Background(), "ops", "stream", nil, blocking(started))
+	<-started
+
+	called := false
+	queued, err := m.Submit(context.Background(), "ops", "stream", nil, func(ctx context.Context) (any, error) {
+		called = true
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+
+	job, err := m.Cancel(queued.ID)
+	if err != nil {
+		t.Fatalf("Cancel: %v", err)
+	}
+	if job.Status != StatusCancelled || job.StartedAt != nil {
+		t.Errorf("cancelled job = %+v, want cancelled without starting", job)
+	}
+
+	// The worker skips the cancelled job once it's free
+	m.Cancel(running.ID)
+	wait(t, m, running.ID, StatusCancelled)
+	if job, _ := m.Get(queued.ID); job.Status != StatusCancelled || called {
+		t.Errorf("cancelled job ran: %+v", job)
+	}
+}
+
+func TestCancelRunningJob(t *testing.T) {
+	m := start(t, 1, 1, time.Minute)
+
+	started := make(chan struct{})
+	job, _ := m.Submit(context.Background(), "ops", "stream", nil, blocking(started))
+	<-started
+
+	cancelled, err := m.Cancel(job.ID)
+	if err != nil {
+		t.Fatalf("Cancel: %v", err)
+	}
+	if cancelled.Status != StatusRunning {
+		t.Errorf("Cancel returned %s, want running until the job returns", cancelled.Status)
+	}
+
+	job = wait(t, m, job.ID, StatusCancelled)
+	if job.Error != "job was cancelled" || job.StartedAt == nil {
+		t.Errorf("cancelled job = %+v", job)
+	}
+}
+
+func TestSubmitQueueFull(t *testing.T) {
+	m := start(t, 1, 1, time.Minute)
+
+	started := make(chan struct{})
+	m.Submit(context.Background(), "ops", "stream", nil, blocking(started))
+	<-started
+
+	if _, err := m.Submit(context.Background(), "ops", "stream", nil, blocking(make(chan struct{}))); err != nil {
+		t.Fatalf("Submit while a worker is busy: %v", err)
+	}
+	if _, err := m.Submit(context.Background(), "ops", "stream", nil, blocking(make(chan struct{}))); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Submit with a full queue: %v, want ErrQueueFull", err)
+	}
+}
+
+func TestFinishedJobsExpire(t *testing.T) {
+	m := NewManager(1, 1, minTTL)
+
+	job, _ := m.Submit(context.Background(), "ops", "episodes", nil, func(ctx context.Context) (any, error) {
+		return nil, nil
+	})
+	m.run(<-m.queue)
+
+	m.expire()
+	if _, err := m.Get(job.ID); err != nil {
+		t.Fatalf("Get before the TTL: %v", err)
+	}
+
+	// Queued and running jobs never expire
+	pending, _ := m.Submit(context.Background(), "ops", "episodes", nil, func(ctx context.Context) (any, error) {
+		return nil, nil
+	})
+
+	time.Sleep(minTTL + 100*time.Millisecond)
+	m.expire()
+	if _, err := m.Get(job.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after the TTL: %v, want ErrNotFound", err)
+	}
+	if _, err := m.Get(pending.ID); err != nil {
+		t.Errorf("Get of a queued job after the TTL: %v", err)
+	}
+}
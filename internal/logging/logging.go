@@ -0,0 +1,112 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/url"
+	"regexp"
+
+	"github.com/sirupsen/logrus"
+)
+
+// HeaderRequestID carries the request ID from and back to clients
+const HeaderRequestID = "X-Request-ID"
+
+// maxRequestIDLength bounds propagated request IDs so clients can't bloat the logs
+const maxRequestIDLength = 128
+
+type contextKey struct{}
+
+// Setup configures the global logger to write JSON lines in production
+// and human readable text anywhere else
+func Setup(environment, level string) error {
+	if environment == "production" {
+		logrus.SetFormatter(&logrus.JSONFormatter{})
+	} else {
+		logrus.SetFormatter(&logrus.TextFormatter{FullTimestamp: true})
+	}
+	logrus.AddHook(redactHook{})
+
+	parsed, err := logrus.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	logrus.SetLevel(parsed)
+
+	return nil
+}
+
+// NewRequestID generates a random request ID
+func NewRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]+$`)
+
+// ValidRequestID reports whether a propagated request ID is safe to log
+func ValidRequestID(id string) bool {
+	return len(id) <= maxRequestIDLength && requestIDPattern.MatchString(id)
+}
+
+// WithRequestID returns a copy of ctx carrying the request ID
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// RequestID returns the request ID stored in ctx, if any
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// FromContext returns a logger tagging every line with the request ID of ctx
+func FromContext(ctx context.Context) *logrus.Entry {
+	entry := logrus.NewEntry(logrus.StandardLogger())
+	if id := RequestID(ctx); id != "" {
+		entry = entry.WithField("request_id", id)
+	}
+	return entry
+}
+
+// RedactURL keeps the scheme and host of a URL and hides the rest, stream
+// and embed URLs carry signed tokens in their path and query string
+func RedactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return "[REDACTED]"
+	}
+	return u.Scheme + "://" + u.Host + "/[REDACTED]"
+}
+
+var queryPattern = regexp.MustCompile(`(https?://[^\s"'?]+)\?[^\s"']*`)
+
+// redactQueries hides the query string of every URL found in s
+func redactQueries(s string) string {
+	return queryPattern.ReplaceAllString(s, "$1?[REDACTED]")
+}
+
+// redactHook strips query strings, where tokens and API keys travel, from
+// URLs that end up in log messages or fields, error messages included
+type redactHook struct{}
+
+func (redactHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (redactHook) Fire(entry *logrus.Entry) error {
+	entry.Message = redactQueries(entry.Message)
+
+	for key, value := range entry.Data {
+		switch v := value.(type) {
+		case string:
+			entry.Data[key] = redactQueries(v)
+		case error:
+			entry.Data[key] = redactQueries(v.Error())
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,197 @@
+package metrics
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "okarun"
+
+var (
+	knownHostsMu sync.RWMutex
+	knownHosts   = make(map[string]bool)
+)
+
+var (
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of HTTP requests by route template, method and status code.",
+		Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	}, []string{"route", "method", "status"})
+
+	scrapeDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "scrape_duration_seconds",
+		Help:      "Duration of scraper calls by method and scraped host.",
+		Buckets:   []float64{0.25, 0.5, 1, 2.5, 5, 10, 20, 30, 60},
+	}, []string{"method", "host"})
+
+	scrapeErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "scrape_errors_total",
+		Help:      "Failed scraper calls by method and scraped host.",
+	}, []string{"method", "host"})
+
+	coalescedScrapes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "scrape_coalesced_total",
+		Help:      "Scraper calls served by an identical fetch already in flight, by method.",
+	}, []string{"method"})
+
+	activeBrowsers = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "browsers_active",
+		Help:      "Headless browsers currently running.",
+	})
+
+	cacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_requests_total",
+		Help:      "Cache lookups by cache and result (hit or miss).",
+	}, []string{"cache", "result"})
+
+	upstreamResponses = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upstream_responses_total",
+		Help:      "HTTP responses received from upstream sites by host and status code.",
+	}, []string{"host", "code"})
+)
+
+// Handler serves the metrics in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// statusRecorder captures the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the flusher of event streams
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// Middleware records the latency of every matched route. Routes are
+// labelled with their template so path parameters don't explode the
+// number of series.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := "unmatched"
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r)
+
+		status := recorder.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		requestDuration.WithLabelValues(route, r.Method, strconv.Itoa(status)).Observe(time.Since(start).Seconds())
+	})
+}
+
+// ObserveScrape records the duration of a scraper call and counts it as
+// failed when err is not nil
+func ObserveScrape(method, host string, start time.Time, err error) {
+	host = hostLabel(host)
+	scrapeDuration.WithLabelValues(method, host).Observe(time.Since(start).Seconds())
+	if err != nil {
+		scrapeErrors.WithLabelValues(method, host).Inc()
+	}
+}
+
+// CoalescedScrape counts a scraper call that joined a fetch in flight
+func CoalescedScrape(method string) {
+	coalescedScrapes.WithLabelValues(method).Inc()
+}
+
+// BrowserStarted counts a new headless browser, call the returned func
+// once it is closed
+func BrowserStarted() func() {
+	activeBrowsers.Inc()
+	return activeBrowsers.Dec
+}
+
+// CacheHit counts a lookup served from the named cache
+func CacheHit(cache string) {
+	cacheRequests.WithLabelValues(cache, "hit").Inc()
+}
+
+// CacheMiss counts a lookup the named cache couldn't serve
+func CacheMiss(cache string) {
+	cacheRequests.WithLabelValues(cache, "miss").Inc()
+}
+
+// UpstreamResponse counts a response from an upstream site
+func UpstreamResponse(host string, code int) {
+	upstreamResponses.WithLabelValues(hostLabel(host), strconv.Itoa(code)).Inc()
+}
+
+// KnownHosts adds domains reported as themselves in host labels. Their
+// subdomains are reported as the domain and any other host as "other",
+// scraped pages link anywhere and every host would be a new series.
+func KnownHosts(domains ...string) {
+	knownHostsMu.Lock()
+	defer knownHostsMu.Unlock()
+
+	for _, domain := range domains {
+		knownHosts[strings.ToLower(domain)] = true
+	}
+}
+
+// Host returns the host of rawURL as a metric label
+func Host(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Hostname() == "" {
+		return "unknown"
+	}
+	return hostLabel(u.Hostname())
+}
+
+func hostLabel(host string) string {
+	if host == "unknown" {
+		return host
+	}
+
+	knownHostsMu.RLock()
+	defer knownHostsMu.RUnlock()
+
+	for domain := strings.ToLower(host); domain != ""; {
+		if knownHosts[domain] {
+			return domain
+		}
+		_, domain, _ = strings.Cut(domain, ".")
+	}
+	return "other"
+}
@@ -0,0 +1,212 @@
+package mpv
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// connectTimeout is how long mpv gets to open its IPC socket
+const connectTimeout = 5 * time.Second
+
+// Properties observed over IPC, by the ID they're reported with
+const (
+	observePosition = iota + 1
+	observeDuration
+	observePause
+)
+
+// Status is the playback state mpv reports, in seconds
+type Status struct {
+	Position float64
+	Duration float64
+	Paused   bool
+	// Ended is set once the file played to its end, rather than mpv being
+	// closed halfway
+	Ended bool
+}
+
+// Options tune how mpv starts
+type Options struct {
+	Title string
+	// Start is the position to resume from, in seconds
+	Start float64
+}
+
+// Player is a running mpv followed over its JSON IPC socket
+type Player struct {
+	conn    net.Conn
+	updates chan Status
+}
+
+// Start runs mpv on url and connects to its IPC socket. Where IPC isn't
+// supported mpv plays on its own and Updates is closed right away.
+func Start(url string, opts Options) (*Player, error) {
+	var args []string
+	if opts.Title != "" {
+		args = append(args, "--force-media-title="+opts.Title)
+	}
+	if opts.Start > 0 {
+		args = append(args, "--start="+strconv.FormatFloat(opts.Start, 'f', 0, 64))
+	}
+
+	var socket string
+	if Supported {
+		var err error
+		if socket, err = socketPath(); err != nil {
+			return nil, err
+		}
+		args = append(args, "--input-ipc-server="+socket)
+	}
+	removeSocket := func() {
+		if socket != "" {
+			os.RemoveAll(filepath.Dir(socket))
+		}
+	}
+
+	cmd := exec.Command("mpv", append(args, url)...)
+	if err := cmd.Start(); err != nil {
+		removeSocket()
+		return nil, err
+	}
+
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+		removeSocket()
+	}()
+
+	p := &Player{updates: make(chan Status, 1)}
+	if !Supported {
+		close(p.updates)
+		return p, nil
+	}
+
+	conn, err := connect(socket, exited)
+	if err != nil {
+		cmd.Process.Kill()
+		return nil, err
+	}
+	p.conn = conn
+
+	for id, property := range map[int]string{
+		observePosition: "time-pos",
+		observeDuration: "duration",
+		observePause:    "pause",
+	} {
+		if err := p.send("observe_property", id, property); err != nil {
+			conn.Close()
+			cmd.Process.Kill()
+			return nil, err
+		}
+	}
+
+	go p.read(exited)
+	return p, nil
+}
+
+// Updates delivers the latest status whenever it changes, and is closed
+// once mpv exits. Updates nobody received yet are replaced by newer ones.
+func (p *Player) Updates() <-chan Status {
+	return p.updates
+}
+
+// connect waits for mpv to open its socket, failing early when it exits
+func connect(socket string, exited <-chan error) (net.Conn, error) {
+	deadline := time.Now().Add(connectTimeout)
+	for {
+		conn, err := dial(socket)
+		if err == nil {
+			return conn, nil
+		}
+
+		select {
+		case err := <-exited:
+			if err == nil {
+				err = errors.New("mpv exited")
+			}
+			return nil, fmt.Errorf("starting mpv: %w", err)
+		case <-time.After(100 * time.Millisecond):
+		}
+
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("connecting to mpv: %w", err)
+		}
+	}
+}
+
+func (p *Player) send(command ...any) error {
+	data, err := json.Marshal(map[string]any{"command": command})
+	if err != nil {
+		return err
+	}
+
+	_, err = p.conn.Write(append(data, '\n'))
+	return err
+}
+
+// event is a line mpv writes on the socket, replies to commands included
+type event struct {
+	Event  string          `json:"event"`
+	ID     int             `json:"id"`
+	Data   json.RawMessage `json:"data"`
+	Reason string          `json:"reason"`
+}
+
+// read follows the events of mpv until it exits, publishing the status
+// every time a whole second passes or anything else changes
+func (p *Player) read(exited <-chan error) {
+	defer close(p.updates)
+	defer p.conn.Close()
+
+	var status Status
+	scanner := bufio.NewScanner(p.conn)
+	for scanner.Scan() {
+		var e event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+
+		next := status
+		switch e.Event {
+		case "property-change":
+			switch e.ID {
+			case observePosition:
+				json.Unmarshal(e.Data, &next.Position)
+			case observeDuration:
+				json.Unmarshal(e.Data, &next.Duration)
+			case observePause:
+				json.Unmarshal(e.Data, &next.Paused)
+			}
+		case "end-file":
+			next.Ended = e.Reason == "eof"
+		default:
+			continue
+		}
+
+		changed := math.Floor(next.Position) != math.Floor(status.Position) ||
+			next.Duration != status.Duration || next.Paused != status.Paused || next.Ended != status.Ended
+		status = next
+		if changed {
+			p.publish(status)
+		}
+	}
+
+	<-exited
+}
+
+func (p *Player) publish(status Status) {
+	select {
+	case <-p.updates:
+	default:
+	}
+	p.updates <- status
+}
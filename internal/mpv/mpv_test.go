@@ -0,0 +1,167 @@
+package mpv
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// fakeMPV feeds events to a player as mpv would over its socket
+type fakeMPV struct {
+	t      *testing.T
+	conn   net.Conn
+	player *Player
+	exited chan error
+}
+
+func newFakeMPV(t *testing.T) *fakeMPV {
+	t.Helper()
+
+	client, server := net.Pipe()
+	m := &fakeMPV{
+		t:      t,
+		conn:   server,
+		player: &Player{conn: client, updates: make(chan Status, 1)},
+		exited: make(chan error, 1),
+	}
+	go m.player.read(m.exited)
+	t.Cleanup(func() {
+		m.conn.Close()
+		m.exited <- nil
+	})
+	return m
+}
+
+// send writes the lines and returns once the player handled them: the
+// pipe only takes the extra line after the previous ones were read
+func (m *fakeMPV) send(lines ...string) {
+	m.t.Helper()
+
+	for _, line := range append(lines, `{"event":"idle"}`) {
+		if _, err := m.conn.Write([]byte(line + "\n")); err != nil {
+			m.t.Fatalf("writing %s: %v", line, err)
+		}
+	}
+}
+
+// update returns the status waiting to be received, if any
+func (m *fakeMPV) update() (Status, bool) {
+	select {
+	case status := <-m.player.Updates():
+		return status, true
+	default:
+		return Status{}, false
+	}
+}
+
+func TestReadProperties(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		want  Status
+	}{
+		{"position", []string{`{"event":"property-change","id":1,"name":"time-pos","data":12.5}`}, Status{Position: 12.5}},
+		{"duration", []string{`{"event":"property-change","id":2,"name":"duration","data":1440}`}, Status{Duration: 1440}},
+		{"pause", []string{`{"event":"property-change","id":3,"name":"pause","data":true}`}, Status{Paused: true}},
+		{"eof", []string{`{"event":"end-file","reason":"eof"}`}, Status{Ended: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newFakeMPV(t)
+			m.send(tt.lines...)
+
+			if got, ok := m.update(); !ok || got != tt.want {
+				t.Errorf("update = %+v, %v, want %+v", got, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadIgnores(t *testing.T) {
+	m := newFakeMPV(t)
+	m.send(
+		`{"request_id":0,"error":"success"}`,
+		`{"event":"property-change","id":9,"name":"volume","data":50}`,
+		`{"event":"property-change","id":1,"name":"time-pos","data":null}`,
+		`{"event":"end-file","reason":"quit"}`,
+		`not json`,
+	)
+
+	if got, ok := m.update(); ok {
+		t.Errorf("published %+v for events that change nothing", got)
+	}
+}
+
+func TestReadThrottlesPosition(t *testing.T) {
+	m := newFakeMPV(t)
+	position := func(seconds string) string {
+		return `{"event":"property-change","id":1,"name":"time-pos","data":` + seconds + `}`
+	}
+
+	m.send(position("1.2"))
+	if got, ok := m.update(); !ok || got.Position != 1.2 {
+		t.Fatalf("update = %+v, %v, want position 1.2", got, ok)
+	}
+
+	m.send(position("1.7"))
+	if got, ok := m.update(); ok {
+		t.Errorf("published %+v within the same second", got)
+	}
+
+	// A pause is published right away, with the position it happened at
+	m.send(`{"event":"property-change","id":3,"name":"pause","data":true}`)
+	if got, ok := m.update(); !ok || got.Position != 1.7 || !got.Paused {
+		t.Errorf("update = %+v, %v, want paused at 1.7", got, ok)
+	}
+
+	m.send(position("2.1"))
+	if got, ok := m.update(); !ok || got.Position != 2.1 {
+		t.Errorf("update = %+v, %v, want position 2.1", got, ok)
+	}
+}
+
+func TestReadClosesUpdates(t *testing.T) {
+	m := newFakeMPV(t)
+	m.send(`{"event":"end-file","reason":"eof"}`)
+	m.conn.Close()
+
+	select {
+	case <-m.player.Updates():
+	case <-time.After(time.Second):
+		t.Fatal("no update before mpv exited")
+	}
+
+	select {
+	case _, ok := <-m.player.Updates():
+		t.Errorf("Updates still open after the socket closed: %v", ok)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	m.exited <- nil
+	select {
+	case _, ok := <-m.player.Updates():
+		if ok {
+			t.Error("got an update after mpv exited")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Updates not closed once mpv exited")
+	}
+	m.exited = make(chan error, 1)
+}
+
+func TestPublishReplacesUnread(t *testing.T) {
+	p := &Player{updates: make(chan Status, 1)}
+
+	p.publish(Status{Position: 1})
+	p.publish(Status{Position: 2})
+
+	if got := <-p.Updates(); got.Position != 2 {
+		t.Errorf("received %+v, want the latest status", got)
+	}
+	select {
+	case got := <-p.Updates():
+		t.Errorf("received %+v, want only the latest status", got)
+	default:
+	}
+}
@@ -0,0 +1,27 @@
+//go:build !windows
+
+package mpv
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+)
+
+// Supported reports whether mpv can be followed over IPC here
+const Supported = true
+
+// socketPath returns where mpv should listen, in a new directory only the
+// user can enter so other users can't connect to or replace the socket.
+// Remove the directory once mpv exits.
+func socketPath() (string, error) {
+	dir, err := os.MkdirTemp(os.Getenv("XDG_RUNTIME_DIR"), "okarun-mpv-")
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "mpv.sock"), nil
+}
+
+func dial(socket string) (net.Conn, error) {
+	return net.Dial("unix", socket)
+}
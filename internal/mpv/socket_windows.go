@@ -0,0 +1,20 @@
+//go:build windows
+
+package mpv
+
+import (
+	"errors"
+	"net"
+)
+
+// Supported reports whether mpv can be followed over IPC here. On Windows
+// mpv listens on a named pipe, which the standard library can't dial.
+const Supported = false
+
+func socketPath() (string, error) {
+	return "", errors.New("mpv IPC is not supported on Windows")
+}
+
+func dial(string) (net.Conn, error) {
+	return nil, errors.New("mpv IPC is not supported on Windows")
+}
@@ -0,0 +1,111 @@
+package netguard
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestPublic(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"8.8.8.8", true},
+		{"100.63.255.255", true},
+		{"100.128.0.1", true},
+		{"2606:4700:4700::1111", true},
+		{"2001:4860:4860::8888", true},
+		{"::ffff:93.184.216.34", true},
+
+		{"127.0.0.1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"100.64.0.1", false},
+		{"100.100.100.200", false},
+		{"0.0.0.0", false},
+		{"0.1.2.3", false},
+		{"198.18.0.1", false},
+		{"198.19.255.255", false},
+		{"192.0.2.1", false},
+		{"224.0.0.1", false},
+		{"255.255.255.255", false},
+		{"::", false},
+		{"::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:169.254.169.254", false},
+		{"64:ff9b::a9fe:a9fe", false},
+		{"64:ff9b:1::1", false},
+		{"2001::1", false},
+		{"2001:db8::1", false},
+		{"2002:c0a8:101::1", false},
+		{"fc00::1", false},
+		{"fd00:ec2::254", false},
+		{"fe80::1", false},
+		{"ff02::1", false},
+	}
+
+	for _, tt := range tests {
+		if got := Public(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("Public(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+
+	if Public(nil) {
+		t.Error("Public(nil) = true")
+	}
+}
+
+func TestControl(t *testing.T) {
+	tests := []struct {
+		address string
+		want    error
+	}{
+		{"93.184.216.34:443", nil},
+		{"[2606:4700:4700::1111]:443", nil},
+		{"127.0.0.1:80", ErrNotPublic},
+		{"100.100.100.200:80", ErrNotPublic},
+		{"[::1]:80", ErrNotPublic},
+		{"[64:ff9b::7f00:1]:80", ErrNotPublic},
+		// Dialers pass resolved addresses, a name is never allowed through
+		{"localhost:80", ErrNotPublic},
+	}
+
+	for _, tt := range tests {
+		if err := Control("tcp", tt.address, nil); !errors.Is(err, tt.want) {
+			t.Errorf("Control(%s) = %v, want %v", tt.address, err, tt.want)
+		}
+	}
+
+	if err := Control("tcp", "no-port", nil); err == nil {
+		t.Error("Control accepted an address without a port")
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	for _, rawURL := range []string{"http://127.0.0.1/hook", "http://[::1]:8080/hook", "http://10.0.0.1/hook"} {
+		if err := CheckURL(context.Background(), rawURL); !errors.Is(err, ErrNotPublic) {
+			t.Errorf("CheckURL(%s) = %v, want ErrNotPublic", rawURL, err)
+		}
+	}
+	if err := CheckURL(context.Background(), "http://93.184.216.34/hook"); err != nil {
+		t.Errorf("CheckURL of a public address: %v", err)
+	}
+}
+
+func TestTransportRefusesPrivateAddresses(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	_, err = Transport().DialContext(context.Background(), "tcp", listener.Addr().String())
+	if !errors.Is(err, ErrNotPublic) {
+		t.Errorf("dialing %s: %v, want ErrNotPublic", listener.Addr(), err)
+	}
+}
@@ -0,0 +1,105 @@
+package playlist
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"yokai/internal/anime"
+)
+
+// Entry represents a single item of an M3U playlist
+type Entry struct {
+	Title string
+	Logo  string
+	Group string
+	URL   string
+}
+
+// Build fetches an anime and returns one entry per episode. Entries point
+// at baseURL so the stream is only resolved when the player requests it.
+func Build(scraper anime.Jkanime, slug, baseURL string) ([]Entry, error) {
+	if slug == "" {
+		return nil, errors.New("slug cannot be empty")
+	}
+
+	details, err := scraper.GetAnime(slug)
+	if err != nil {
+		return nil, err
+	}
+
+	episodes, err := scraper.GetEpisodes(slug, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	total := episodes.LastEpisode
+	if total == 0 {
+		total = episodes.TotalEpisodes
+	}
+	if total == 0 {
+		total = len(episodes.Episodes)
+	}
+	if total == 0 {
+		return nil, errors.New("anime has no episodes")
+	}
+
+	title := details.Title
+	if title == "" {
+		title = slug
+	}
+
+	entries := make([]Entry, total)
+	for i := range entries {
+		episode := strconv.Itoa(i + 1)
+		entries[i] = Entry{
+			Title: fmt.Sprintf("%s - Episode %s", title, episode),
+			Logo:  details.Img,
+			Group: title,
+			URL:   StreamURL(baseURL, slug, episode),
+		}
+	}
+
+	return entries, nil
+}
+
+// StreamURL returns the server URL that lazily resolves the stream of an episode
+func StreamURL(baseURL, slug, episode string) string {
+	return fmt.Sprintf("%s/api/v1/anime/%s/episodes/%s/play",
+		strings.TrimSuffix(baseURL, "/"), url.PathEscape(slug), url.PathEscape(episode))
+}
+
+// WithAPIKey makes the entries carry key, players can't send headers
+func WithAPIKey(entries []Entry, key string) {
+	if key == "" {
+		return
+	}
+	for i := range entries {
+		entries[i].URL += "?api_key=" + url.QueryEscape(key)
+	}
+}
+
+// Write renders the entries as an extended M3U playlist
+func Write(w io.Writer, entries []Entry) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "#EXTM3U")
+	for _, entry := range entries {
+		fmt.Fprintf(bw, "#EXTINF:-1 tvg-logo=\"%s\" group-title=\"%s\",%s\n",
+			attr(entry.Logo), attr(entry.Group), line(entry.Title))
+		fmt.Fprintln(bw, entry.URL)
+	}
+	return bw.Flush()
+}
+
+// attr sanitizes a value used inside a quoted #EXTINF attribute
+func attr(value string) string {
+	return strings.ReplaceAll(line(value), `"`, "'")
+}
+
+// line removes line breaks that would corrupt the playlist
+func line(value string) string {
+	return strings.Join(strings.Fields(value), " ")
+}
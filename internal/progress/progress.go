@@ -0,0 +1,242 @@
+package progress
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	"yokai/internal/storage"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// ErrNotFound is returned when a user has no progress for an anime
+var ErrNotFound = errors.New("progress not found")
+
+// CompletedRatio is how much of an episode must be played for it to count
+// as watched, the ending credits are usually skipped
+const CompletedRatio = 0.9
+
+// usersBucket holds a bucket per user, with an entry per watched episode
+var usersBucket = []byte("progress")
+
+// Entry is the watch state of an episode
+type Entry struct {
+	Slug    string `json:"slug"`
+	Title   string `json:"title,omitempty"`
+	Episode int    `json:"episode"`
+	// Position and Duration are in seconds
+	Position    float64    `json:"position"`
+	Duration    float64    `json:"duration,omitempty"`
+	Completed   bool       `json:"completed"`
+	StartedAt   time.Time  `json:"started_at,omitzero"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+// Update is a position reported by a player
+type Update struct {
+	Title    string
+	Position float64
+	Duration float64
+	// Completed marks the episode as watched whatever the position
+	Completed bool
+}
+
+// Store persists the watch state of every user in a bbolt database
+type Store struct {
+	db *bolt.DB
+}
+
+// NewStore keeps the watch state in db
+func NewStore(db *bolt.DB) (*Store, error) {
+	if err := storage.CreateBuckets(db, usersBucket); err != nil {
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+// Save records the position of user in an episode. An episode stays
+// completed once it was, so rewatching it doesn't bring it back to
+// continue watching.
+func (s *Store) Save(user, slug string, episode int, update Update) (Entry, error) {
+	var entry Entry
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.Bucket(usersBucket).CreateBucketIfNotExists([]byte(user))
+		if err != nil {
+			return err
+		}
+
+		key := entryKey(slug, episode)
+		now := time.Now().UTC()
+		entry = Entry{Slug: slug, Episode: episode, StartedAt: now}
+		if data := bucket.Get(key); data != nil {
+			if err := json.Unmarshal(data, &entry); err != nil {
+				return err
+			}
+		}
+
+		if update.Title != "" {
+			entry.Title = update.Title
+		}
+		if update.Duration > 0 {
+			entry.Duration = update.Duration
+		}
+		entry.Position = update.Position
+		entry.UpdatedAt = now
+
+		finished := update.Completed || (entry.Duration > 0 && entry.Position >= entry.Duration*CompletedRatio)
+		if finished && !entry.Completed {
+			entry.Completed = true
+			entry.CompletedAt = &now
+		}
+
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		return bucket.Put(key, data)
+	})
+
+	return entry, err
+}
+
+// Anime returns the episodes of slug watched by user, in episode order
+func (s *Store) Anime(user, slug string) ([]Entry, error) {
+	var entries []Entry
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(usersBucket).Bucket([]byte(user))
+		if bucket == nil {
+			return nil
+		}
+
+		prefix := []byte(slug + "\x00")
+		c := bucket.Cursor()
+		for k, v := c.Seek(prefix); k != nil && strings.HasPrefix(string(k), string(prefix)); k, v = c.Next() {
+			var entry Entry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return err
+			}
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	if err == nil && len(entries) == 0 {
+		err = ErrNotFound
+	}
+
+	return entries, err
+}
+
+// Latest returns the most recently watched episode of every anime of user,
+// most recent first
+func (s *Store) Latest(user string) ([]Entry, error) {
+	history, err := s.History(user)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	latest := []Entry{}
+	for _, entry := range history {
+		if !seen[entry.Slug] {
+			seen[entry.Slug] = true
+			latest = append(latest, entry)
+		}
+	}
+
+	return latest, nil
+}
+
+// ContinueWatching returns the episode to play next of every anime of
+// user, most recent first: the latest one watched when it was left
+// halfway, the one after it otherwise. The next episode isn't started, it
+// carries when the anime was last watched. Anime are left out once their
+// episode in lastEpisodes, by slug, was watched; without it they're kept.
+func (s *Store) ContinueWatching(user string, lastEpisodes map[string]int) ([]Entry, error) {
+	latest, err := s.Latest(user)
+	if err != nil {
+		return nil, err
+	}
+
+	next := []Entry{}
+	for _, entry := range latest {
+		switch {
+		case !entry.Completed:
+			next = append(next, entry)
+		case lastEpisodes[entry.Slug] == 0 || entry.Episode < lastEpisodes[entry.Slug]:
+			next = append(next, Entry{
+				Slug:      entry.Slug,
+				Title:     entry.Title,
+				Episode:   entry.Episode + 1,
+				UpdatedAt: entry.UpdatedAt,
+			})
+		}
+	}
+
+	return next, nil
+}
+
+// History returns every episode watched by user, most recent first
+func (s *Store) History(user string) ([]Entry, error) {
+	entries := []Entry{}
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(usersBucket).Bucket([]byte(user))
+		if bucket == nil {
+			return nil
+		}
+
+		return bucket.ForEach(func(_, v []byte) error {
+			var entry Entry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return err
+			}
+			entries = append(entries, entry)
+			return nil
+		})
+	})
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].UpdatedAt.After(entries[j].UpdatedAt)
+	})
+
+	return entries, err
+}
+
+// Forget deletes the progress of user in slug
+func (s *Store) Forget(user, slug string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(usersBucket).Bucket([]byte(user))
+		if bucket == nil {
+			return ErrNotFound
+		}
+
+		prefix := []byte(slug + "\x00")
+		var keys [][]byte
+		c := bucket.Cursor()
+		for k, _ := c.Seek(prefix); k != nil && strings.HasPrefix(string(k), string(prefix)); k, _ = c.Next() {
+			keys = append(keys, slices.Clone(k))
+		}
+		if len(keys) == 0 {
+			return ErrNotFound
+		}
+
+		for _, k := range keys {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// entryKey sorts the episodes of an anime together and in order
+func entryKey(slug string, episode int) []byte {
+	return []byte(fmt.Sprintf("%s\x00%08d", slug, episode))
+}
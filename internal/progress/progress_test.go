@@ -0,0 +1,197 @@
+package progress
+
+import (
+	"errors"
+	"testing"
+	"yokai/internal/storage/storagetest"
+)
+
+func TestSave(t *testing.T) {
+	tests := []struct {
+		name      string
+		updates   []Update
+		completed bool
+		position  float64
+		duration  float64
+	}{
+		{
+			name:     "halfway",
+			updates:  []Update{{Position: 600, Duration: 1400}},
+			position: 600, duration: 1400,
+		},
+		{
+			name:      "nearly to the end",
+			updates:   []Update{{Position: 1400 * CompletedRatio, Duration: 1400}},
+			completed: true,
+			position:  1400 * CompletedRatio, duration: 1400,
+		},
+		{
+			name:      "marked completed",
+			updates:   []Update{{Position: 10, Completed: true}},
+			completed: true,
+			position:  10,
+		},
+		{
+			name:      "completed sticks",
+			updates:   []Update{{Position: 1350, Duration: 1400}, {Position: 30}},
+			completed: true,
+			position:  30, duration: 1400,
+		},
+		{
+			name:     "duration kept",
+			updates:  []Update{{Position: 100, Duration: 1400}, {Position: 700}},
+			position: 700, duration: 1400,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := storagetest.NewStore(t, NewStore)
+
+			var entry Entry
+			var err error
+			for _, update := range tt.updates {
+				if entry, err = store.Save("user:alice", "dandadan", 3, update); err != nil {
+					t.Fatalf("Save: %v", err)
+				}
+			}
+
+			if entry.Completed != tt.completed || entry.Position != tt.position || entry.Duration != tt.duration {
+				t.Errorf("Save = %+v, want completed %v at %v of %v", entry, tt.completed, tt.position, tt.duration)
+			}
+			if (entry.CompletedAt != nil) != tt.completed {
+				t.Errorf("CompletedAt = %v, want it set only once completed", entry.CompletedAt)
+			}
+		})
+	}
+}
+
+func TestSaveKeepsCompletedAt(t *testing.T) {
+	store := storagetest.NewStore(t, NewStore)
+
+	first, _ := store.Save("user:alice", "dandadan", 3, Update{Title: "Dandadan", Completed: true})
+	again, _ := store.Save("user:alice", "dandadan", 3, Update{Position: 1400, Duration: 1400})
+
+	if !again.CompletedAt.Equal(*first.CompletedAt) || !again.StartedAt.Equal(first.StartedAt) {
+		t.Errorf("rewatching moved the times: %+v, was %+v", again, first)
+	}
+	if again.Title != "Dandadan" {
+		t.Errorf("Title = %q, want it kept", again.Title)
+	}
+}
+
+func TestAnimeMatchesWholeSlug(t *testing.T) {
+	store := storagetest.NewStore(t, NewStore)
+	store.Save("user:alice", "a", 2, Update{Position: 10})
+	store.Save("user:alice", "a", 1, Update{Position: 10})
+	store.Save("user:alice", "ab", 1, Update{Position: 10})
+	store.Save("user:bob", "a", 3, Update{Position: 10})
+
+	entries, err := store.Anime("user:alice", "a")
+	if err != nil {
+		t.Fatalf("Anime: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Episode != 1 || entries[1].Episode != 2 {
+		t.Errorf("Anime = %+v, want episodes 1 and 2 of a", entries)
+	}
+
+	if _, err := store.Anime("user:alice", "b"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Anime of an unwatched slug: %v, want ErrNotFound", err)
+	}
+	if _, err := store.Anime("user:carol", "a"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Anime of a new user: %v, want ErrNotFound", err)
+	}
+}
+
+func TestForgetMatchesWholeSlug(t *testing.T) {
+	store := storagetest.NewStore(t, NewStore)
+	store.Save("user:alice", "a", 1, Update{Position: 10})
+	store.Save("user:alice", "a", 2, Update{Position: 10})
+	store.Save("user:alice", "ab", 1, Update{Position: 10})
+	store.Save("user:bob", "a", 1, Update{Position: 10})
+
+	if err := store.Forget("user:alice", "a"); err != nil {
+		t.Fatalf("Forget: %v", err)
+	}
+
+	if _, err := store.Anime("user:alice", "a"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Anime after Forget: %v, want ErrNotFound", err)
+	}
+	if entries, _ := store.Anime("user:alice", "ab"); len(entries) != 1 {
+		t.Errorf("Forget removed ab too: %+v", entries)
+	}
+	if entries, _ := store.Anime("user:bob", "a"); len(entries) != 1 {
+		t.Errorf("Forget removed the progress of another user: %+v", entries)
+	}
+
+	if err := store.Forget("user:alice", "a"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Forget twice: %v, want ErrNotFound", err)
+	}
+	if err := store.Forget("user:carol", "a"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Forget for a new user: %v, want ErrNotFound", err)
+	}
+}
+
+func TestContinueWatching(t *testing.T) {
+	store := storagetest.NewStore(t, NewStore)
+	store.Save("user:alice", "frieren", 1, Update{Position: 300, Duration: 1400})
+	store.Save("user:alice", "dandadan", 1, Update{Completed: true})
+	store.Save("user:alice", "dandadan", 2, Update{Position: 500, Duration: 1400})
+	store.Save("user:alice", "sakamoto", 4, Update{Position: 300, Duration: 1400})
+	store.Save("user:alice", "sakamoto", 4, Update{Title: "Sakamoto Days", Completed: true})
+	store.Save("user:alice", "kaiju", 12, Update{Completed: true})
+	store.Save("user:bob", "one-piece", 1, Update{Position: 300})
+
+	type next struct {
+		slug     string
+		episode  int
+		position float64
+	}
+	tests := []struct {
+		name         string
+		lastEpisodes map[string]int
+		want         []next
+	}{
+		{
+			name: "counts unknown",
+			want: []next{{"kaiju", 13, 0}, {"sakamoto", 5, 0}, {"dandadan", 2, 500}, {"frieren", 1, 300}},
+		},
+		{
+			name:         "last episode watched",
+			lastEpisodes: map[string]int{"kaiju": 12, "sakamoto": 4, "dandadan": 2},
+			want:         []next{{"dandadan", 2, 500}, {"frieren", 1, 300}},
+		},
+		{
+			name:         "more episodes out",
+			lastEpisodes: map[string]int{"kaiju": 24, "sakamoto": 11},
+			want:         []next{{"kaiju", 13, 0}, {"sakamoto", 5, 0}, {"dandadan", 2, 500}, {"frieren", 1, 300}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := store.ContinueWatching("user:alice", tt.lastEpisodes)
+			if err != nil {
+				t.Fatalf("ContinueWatching: %v", err)
+			}
+			if len(entries) != len(tt.want) {
+				t.Fatalf("ContinueWatching = %+v, want %v", entries, tt.want)
+			}
+			for i, w := range tt.want {
+				if got := entries[i]; got.Slug != w.slug || got.Episode != w.episode || got.Position != w.position || got.Completed {
+					t.Errorf("entry %d = %s episode %d at %v, want %s episode %d at %v", i, got.Slug, got.Episode, got.Position, w.slug, w.episode, w.position)
+				}
+			}
+		})
+	}
+
+	entries, _ := store.ContinueWatching("user:alice", nil)
+	if next := entries[1]; next.Title != "Sakamoto Days" || !next.StartedAt.IsZero() || next.UpdatedAt.IsZero() {
+		t.Errorf("next episode = %+v, want the title and last watch time, not started", next)
+	}
+
+	entries, err := store.ContinueWatching("user:carol", nil)
+	if err != nil || entries == nil || len(entries) != 0 {
+		t.Errorf("ContinueWatching of a new user = %#v, %v, want an empty list", entries, err)
+	}
+}
@@ -0,0 +1,129 @@
+package settings
+
+import (
+	"encoding/json"
+	"slices"
+	"sync"
+	"yokai/internal/anime"
+	"yokai/internal/storage"
+
+	"github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	settingsBucket = []byte("settings")
+	runtimeKey     = []byte("runtime")
+)
+
+// Settings are the changes made through the admin API, kept across restarts
+type Settings struct {
+	DisabledServers   []string `json:"disabled_servers"`
+	DisabledProviders []string `json:"disabled_providers"`
+	// LogLevel overrides the configured level when set
+	LogLevel string `json:"log_level,omitempty"`
+}
+
+// Defaults returns the settings of a server no admin has changed
+func Defaults() Settings {
+	return Settings{
+		DisabledServers:   slices.Clone(anime.DefaultDisabledServers),
+		DisabledProviders: []string{},
+	}
+}
+
+// Apply puts the settings into effect
+func (s Settings) Apply() error {
+	if err := anime.SetDisabledProviders(s.DisabledProviders); err != nil {
+		return err
+	}
+	anime.SetDisabledServers(s.DisabledServers)
+
+	if s.LogLevel != "" {
+		level, err := logrus.ParseLevel(s.LogLevel)
+		if err != nil {
+			return err
+		}
+		logrus.SetLevel(level)
+	}
+
+	return nil
+}
+
+// Store persists the settings in a bbolt database
+type Store struct {
+	db *bolt.DB
+
+	// mu orders Change calls, so the settings in effect are the saved ones
+	mu sync.Mutex
+}
+
+// NewStore keeps the settings in db
+func NewStore(db *bolt.DB) (*Store, error) {
+	if err := storage.CreateBuckets(db, settingsBucket); err != nil {
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+// Load returns the stored settings, or the defaults when none were saved
+func (s *Store) Load() (Settings, error) {
+	var settings Settings
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		settings, err = load(tx)
+		return err
+	})
+
+	return settings, err
+}
+
+// Update changes the stored settings with change and saves them
+func (s *Store) Update(change func(*Settings) error) (Settings, error) {
+	var settings Settings
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		settings, err = load(tx)
+		if err != nil {
+			return err
+		}
+
+		if err := change(&settings); err != nil {
+			return err
+		}
+
+		data, err := json.Marshal(settings)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(settingsBucket).Put(runtimeKey, data)
+	})
+
+	return settings, err
+}
+
+// Change updates the stored settings with change and applies them. Changes
+// made at the same time take effect in the order they're saved.
+func (s *Store) Change(change func(*Settings) error) (Settings, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	settings, err := s.Update(change)
+	if err != nil {
+		return settings, err
+	}
+	return settings, settings.Apply()
+}
+
+func load(tx *bolt.Tx) (Settings, error) {
+	data := tx.Bucket(settingsBucket).Get(runtimeKey)
+	if data == nil {
+		return Defaults(), nil
+	}
+
+	settings := Defaults()
+	err := json.Unmarshal(data, &settings)
+	return settings, err
+}
@@ -0,0 +1,115 @@
+package settings
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"yokai/internal/anime"
+	"yokai/internal/storage/storagetest"
+
+	"github.com/sirupsen/logrus"
+)
+
+// restoreSwitches puts the servers, providers and log level back as they
+// were once the test is done, they're global
+func restoreSwitches(t *testing.T) {
+	level := logrus.GetLevel()
+	t.Cleanup(func() {
+		Defaults().Apply()
+		logrus.SetLevel(level)
+	})
+}
+
+func TestLoadDefaults(t *testing.T) {
+	store := storagetest.NewStore(t, NewStore)
+
+	loaded, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if !slices.Equal(loaded.DisabledServers, anime.DefaultDisabledServers) ||
+		loaded.DisabledProviders == nil || len(loaded.DisabledProviders) != 0 || loaded.LogLevel != "" {
+		t.Errorf("Load of an empty store = %+v, want the defaults", loaded)
+	}
+}
+
+func TestApplyDefaults(t *testing.T) {
+	restoreSwitches(t)
+	anime.SetDisabledServers([]string{"Streamwish"})
+	anime.SetDisabledProviders([]string{anime.Provider})
+	logrus.SetLevel(logrus.DebugLevel)
+
+	if err := Defaults().Apply(); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+
+	if !anime.ServerEnabled("Streamwish") || anime.ServerEnabled("Mega") {
+		t.Errorf("disabled servers = %v, want the defaults", anime.DisabledServers())
+	}
+	if !anime.ProviderEnabled(anime.Provider) {
+		t.Error("the provider is still disabled")
+	}
+	if logrus.GetLevel() != logrus.DebugLevel {
+		t.Errorf("level = %s, want it left alone without a LogLevel", logrus.GetLevel())
+	}
+}
+
+func TestChange(t *testing.T) {
+	restoreSwitches(t)
+	store := storagetest.NewStore(t, NewStore)
+
+	changed, err := store.Change(func(s *Settings) error {
+		s.DisabledServers = append(s.DisabledServers, "Streamwish")
+		s.LogLevel = "warning"
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Change: %v", err)
+	}
+	if anime.ServerEnabled("Streamwish") || logrus.GetLevel() != logrus.WarnLevel {
+		t.Error("the change wasn't applied")
+	}
+
+	loaded, err := store.Load()
+	if err != nil || !slices.Equal(loaded.DisabledServers, changed.DisabledServers) || loaded.LogLevel != "warning" {
+		t.Errorf("Load = %+v, %v, want the change saved", loaded, err)
+	}
+}
+
+func TestChangeRejectsUnknownProviders(t *testing.T) {
+	restoreSwitches(t)
+	store := storagetest.NewStore(t, NewStore)
+
+	_, err := store.Change(func(s *Settings) error {
+		s.DisabledProviders = []string{"crunchyroll"}
+		return nil
+	})
+	if !errors.Is(err, anime.ErrUnknownProvider) {
+		t.Errorf("Change = %v, want ErrUnknownProvider", err)
+	}
+}
+
+func TestChangeInOrder(t *testing.T) {
+	restoreSwitches(t)
+	store := storagetest.NewStore(t, NewStore)
+
+	var wg sync.WaitGroup
+	for _, name := range []string{"Desu", "Magi", "Streamwish", "Vidhide", "Filemoon", "VOE", "Streamtape"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			store.Change(func(s *Settings) error {
+				s.DisabledServers = append(s.DisabledServers, name)
+				return nil
+			})
+		}()
+	}
+	wg.Wait()
+
+	loaded, _ := store.Load()
+	slices.Sort(loaded.DisabledServers)
+	if applied := anime.DisabledServers(); !slices.Equal(applied, loaded.DisabledServers) {
+		t.Errorf("applied %v, saved %v", applied, loaded.DisabledServers)
+	}
+}
@@ -0,0 +1,34 @@
+// Package storagetest opens databases for the tests of the stores kept in
+// them
+package storagetest
+
+import (
+	"path/filepath"
+	"testing"
+	"yokai/internal/storage"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Open opens an empty database, closed and removed with the test
+func Open(t testing.TB) *bolt.DB {
+	t.Helper()
+
+	db, err := storage.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// NewStore creates a store with newStore in an empty database
+func NewStore[S any](t testing.TB, newStore func(*bolt.DB) (S, error)) S {
+	t.Helper()
+
+	store, err := newStore(Open(t))
+	if err != nil {
+		t.Fatalf("creating store: %v", err)
+	}
+	return store
+}
@@ -0,0 +1,250 @@
+package users
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"slices"
+	"time"
+	"yokai/internal/storage"
+
+	bolt "go.etcd.io/bbolt"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	// ErrNotFound is returned for unknown users
+	ErrNotFound = errors.New("user not found")
+	// ErrExists is returned when creating a user whose name is taken
+	ErrExists = errors.New("user already exists")
+	// ErrInvalidCredentials is returned for an unknown user or a wrong password
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	// ErrInvalidUsername is returned for names that don't match usernamePattern
+	ErrInvalidUsername = errors.New("username must be 1 to 32 lowercase letters, digits, dots, dashes or underscores")
+	// ErrWeakPassword is returned for passwords shorter than MinPasswordLength
+	ErrWeakPassword = errors.New("password is too short")
+)
+
+// MinPasswordLength is the shortest password accepted
+const MinPasswordLength = 8
+
+var (
+	usersBucket    = []byte("users")
+	sessionsBucket = []byte("sessions")
+)
+
+var usernamePattern = regexp.MustCompile(`^[a-z0-9._-]{1,32}$`)
+
+// User is a local account
+type User struct {
+	Username  string    `json:"username"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type userRecord struct {
+	User
+	PasswordHash []byte `json:"password_hash"`
+}
+
+// Session is a login, its token is only known to the client
+type Session struct {
+	Token     string    `json:"token"`
+	Username  string    `json:"username"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Store persists accounts and sessions in a bbolt database
+type Store struct {
+	db *bolt.DB
+	// dummyHash is compared against when the user doesn't exist, so a login
+	// takes as long whether the user exists or not
+	dummyHash []byte
+}
+
+// NewStore keeps accounts and sessions in db
+func NewStore(db *bolt.DB) (*Store, error) {
+	if err := storage.CreateBuckets(db, usersBucket, sessionsBucket); err != nil {
+		return nil, err
+	}
+
+	dummyHash, err := bcrypt.GenerateFromPassword([]byte("okarun"), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Store{db: db, dummyHash: dummyHash}, nil
+}
+
+// Create adds a user with a bcrypt hash of password
+func (s *Store) Create(username, password string) (User, error) {
+	if !usernamePattern.MatchString(username) {
+		return User{}, ErrInvalidUsername
+	}
+	if len(password) < MinPasswordLength {
+		return User{}, ErrWeakPassword
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return User{}, err
+	}
+
+	record := userRecord{
+		User:         User{Username: username, CreatedAt: time.Now().UTC()},
+		PasswordHash: hash,
+	}
+
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(usersBucket)
+		if bucket.Get([]byte(username)) != nil {
+			return ErrExists
+		}
+
+		data, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(username), data)
+	})
+	if err != nil {
+		return User{}, err
+	}
+
+	return record.User, nil
+}
+
+// Authenticate checks the password of username
+func (s *Store) Authenticate(username, password string) (User, error) {
+	record, err := s.get(username)
+	if err != nil {
+		bcrypt.CompareHashAndPassword(s.dummyHash, []byte(password))
+		return User{}, ErrInvalidCredentials
+	}
+
+	if bcrypt.CompareHashAndPassword(record.PasswordHash, []byte(password)) != nil {
+		return User{}, ErrInvalidCredentials
+	}
+
+	return record.User, nil
+}
+
+// Get returns the user named username
+func (s *Store) Get(username string) (User, error) {
+	record, err := s.get(username)
+	return record.User, err
+}
+
+func (s *Store) get(username string) (userRecord, error) {
+	var record userRecord
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(usersBucket).Get([]byte(username))
+		if data == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(data, &record)
+	})
+
+	return record, err
+}
+
+// CreateSession logs username in for ttl. Only a hash of the token is
+// stored, a leaked database doesn't leak sessions.
+func (s *Store) CreateSession(username string, ttl time.Duration) (Session, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return Session{}, err
+	}
+
+	now := time.Now().UTC()
+	session := Session{
+		Token:     base64.RawURLEncoding.EncodeToString(buf),
+		Username:  username,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+
+	stored := session
+	stored.Token = ""
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return Session{}, err
+	}
+
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(sessionsBucket).Put(tokenKey(session.Token), data)
+	})
+
+	return session, err
+}
+
+// Resolve returns the user logged in with token, dropping the session once
+// it expired
+func (s *Store) Resolve(token string) (string, bool) {
+	if token == "" {
+		return "", false
+	}
+
+	var session Session
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(sessionsBucket).Get(tokenKey(token))
+		if data == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(data, &session)
+	})
+	if err != nil {
+		return "", false
+	}
+
+	if time.Now().After(session.ExpiresAt) {
+		s.DeleteSession(token)
+		return "", false
+	}
+
+	return session.Username, true
+}
+
+// DeleteSession logs the session of token out
+func (s *Store) DeleteSession(token string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(sessionsBucket).Delete(tokenKey(token))
+	})
+}
+
+// ExpireSessions drops the sessions that expired
+func (s *Store) ExpireSessions() error {
+	now := time.Now()
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(sessionsBucket)
+
+		var expired [][]byte
+		err := bucket.ForEach(func(k, v []byte) error {
+			var session Session
+			if err := json.Unmarshal(v, &session); err != nil || now.After(session.ExpiresAt) {
+				expired = append(expired, slices.Clone(k))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, k := range expired {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func tokenKey(token string) []byte {
+	sum := sha256.Sum256([]byte(token))
+	return sum[:]
+}
@@ -0,0 +1,170 @@
+package users
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+	"yokai/internal/storage/storagetest"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestCreateAndAuthenticate(t *testing.T) {
+	store := storagetest.NewStore(t, NewStore)
+
+	created, err := store.Create("alice", "hunter2hunter2")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if created.Username != "alice" {
+		t.Errorf("Create returned username %q, want alice", created.Username)
+	}
+
+	if _, err := store.Create("alice", "another-password"); !errors.Is(err, ErrExists) {
+		t.Errorf("Create of a taken name: got %v, want ErrExists", err)
+	}
+
+	user, err := store.Authenticate("alice", "hunter2hunter2")
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if user.Username != "alice" {
+		t.Errorf("Authenticate returned username %q, want alice", user.Username)
+	}
+}
+
+func TestAuthenticateRejects(t *testing.T) {
+	store := storagetest.NewStore(t, NewStore)
+	if _, err := store.Create("alice", "hunter2hunter2"); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+	}{
+		{"wrong password", "alice", "wrong-password"},
+		{"unknown user", "bob", "hunter2hunter2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := store.Authenticate(tt.username, tt.password); !errors.Is(err, ErrInvalidCredentials) {
+				t.Errorf("got %v, want ErrInvalidCredentials", err)
+			}
+		})
+	}
+}
+
+func TestCreateValidates(t *testing.T) {
+	store := storagetest.NewStore(t, NewStore)
+
+	if _, err := store.Create("Alice!", "hunter2hunter2"); !errors.Is(err, ErrInvalidUsername) {
+		t.Errorf("invalid username: got %v, want ErrInvalidUsername", err)
+	}
+	if _, err := store.Create("alice", "short"); !errors.Is(err, ErrWeakPassword) {
+		t.Errorf("short password: got %v, want ErrWeakPassword", err)
+	}
+}
+
+func TestSessions(t *testing.T) {
+	store := storagetest.NewStore(t, NewStore)
+
+	session, err := store.CreateSession("alice", time.Hour)
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+
+	if user, ok := store.Resolve(session.Token); !ok || user != "alice" {
+		t.Errorf("Resolve = %q, %v, want alice, true", user, ok)
+	}
+	if _, ok := store.Resolve("not-a-token"); ok {
+		t.Error("Resolve accepted an unknown token")
+	}
+	if _, ok := store.Resolve(""); ok {
+		t.Error("Resolve accepted an empty token")
+	}
+
+	if err := store.DeleteSession(session.Token); err != nil {
+		t.Fatalf("DeleteSession: %v", err)
+	}
+	if _, ok := store.Resolve(session.Token); ok {
+		t.Error("Resolve accepted a deleted session")
+	}
+}
+
+func TestSessionExpiry(t *testing.T) {
+	store := storagetest.NewStore(t, NewStore)
+
+	expired, err := store.CreateSession("alice", -time.Minute)
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	if _, ok := store.Resolve(expired.Token); ok {
+		t.Error("Resolve accepted an expired session")
+	}
+
+	stale, err := store.CreateSession("alice", -time.Minute)
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	valid, err := store.CreateSession("alice", time.Hour)
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+
+	if err := store.ExpireSessions(); err != nil {
+		t.Fatalf("ExpireSessions: %v", err)
+	}
+	if got := countSessions(t, store); got != 1 {
+		t.Errorf("%d sessions left after ExpireSessions, want 1", got)
+	}
+	if _, ok := store.Resolve(valid.Token); !ok {
+		t.Error("ExpireSessions dropped a valid session")
+	}
+	if _, ok := store.Resolve(stale.Token); ok {
+		t.Error("Resolve accepted a session dropped by ExpireSessions")
+	}
+}
+
+func TestSessionStoresTokenHash(t *testing.T) {
+	store := storagetest.NewStore(t, NewStore)
+
+	session, err := store.CreateSession("alice", time.Hour)
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+
+	err = store.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(sessionsBucket).ForEach(func(k, v []byte) error {
+			if !bytes.Equal(k, tokenKey(session.Token)) {
+				t.Errorf("session stored under %x, want the token hash", k)
+			}
+			if bytes.Contains(k, []byte(session.Token)) || bytes.Contains(v, []byte(session.Token)) {
+				t.Error("the session token is stored in plain text")
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatalf("reading sessions: %v", err)
+	}
+}
+
+func countSessions(t *testing.T, store *Store) int {
+	t.Helper()
+
+	count := 0
+	err := store.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(sessionsBucket).ForEach(func(_, _ []byte) error {
+			count++
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatalf("counting sessions: %v", err)
+	}
+	return count
+}
@@ -0,0 +1,216 @@
+package watchlist
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"sort"
+	"time"
+	"yokai/internal/anime"
+	"yokai/internal/events"
+	"yokai/internal/storage"
+
+	"github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Watchlist statuses
+const (
+	StatusPlanning  = "planning"
+	StatusWatching  = "watching"
+	StatusCompleted = "completed"
+	StatusDropped   = "dropped"
+)
+
+// Statuses lists every valid status
+var Statuses = []string{StatusPlanning, StatusWatching, StatusCompleted, StatusDropped}
+
+var (
+	// ErrNotFound is returned for anime missing from a watchlist
+	ErrNotFound = errors.New("anime not in watchlist")
+	// ErrInvalidStatus is returned for statuses not in Statuses
+	ErrInvalidStatus = errors.New("invalid watchlist status")
+)
+
+var (
+	// listsBucket holds a bucket per user, with an item per anime
+	listsBucket = []byte("watchlists")
+	// latestBucket holds the newest episode known of every anime, shared
+	// by every user
+	latestBucket = []byte("latest_episodes")
+)
+
+// Item is an anime on a watchlist, with the details it had when added
+type Item struct {
+	anime.Anime
+	Status    string    `json:"status"`
+	AddedAt   time.Time `json:"added_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ValidStatus reports whether status is one of Statuses
+func ValidStatus(status string) bool {
+	return slices.Contains(Statuses, status)
+}
+
+// Store persists the watchlists of every user in a bbolt database
+type Store struct {
+	db *bolt.DB
+}
+
+// NewStore keeps the watchlists in db
+func NewStore(db *bolt.DB) (*Store, error) {
+	if err := storage.CreateBuckets(db, listsBucket, latestBucket); err != nil {
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+// Put adds details to the watchlist of user with status, or changes the
+// status when it's already there. It reports whether the anime was added.
+func (s *Store) Put(user string, details anime.Anime, status string) (Item, bool, error) {
+	if !ValidStatus(status) {
+		return Item{}, false, ErrInvalidStatus
+	}
+
+	var item Item
+	var created bool
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.Bucket(listsBucket).CreateBucketIfNotExists([]byte(user))
+		if err != nil {
+			return err
+		}
+
+		now := time.Now().UTC()
+		if data := bucket.Get([]byte(details.Slug)); data != nil {
+			if err := json.Unmarshal(data, &item); err != nil {
+				return err
+			}
+		} else {
+			item = Item{Anime: details, AddedAt: now}
+			created = true
+		}
+		item.Status = status
+		item.UpdatedAt = now
+
+		data, err := json.Marshal(item)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(details.Slug), data)
+	})
+
+	return item, created, err
+}
+
+// Get returns the item of slug on the watchlist of user
+func (s *Store) Get(user, slug string) (Item, error) {
+	var item Item
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(listsBucket).Bucket([]byte(user))
+		if bucket == nil {
+			return ErrNotFound
+		}
+
+		data := bucket.Get([]byte(slug))
+		if data == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(data, &item)
+	})
+
+	return item, err
+}
+
+// List returns the watchlist of user, only the items with status unless
+// it's empty, most recently updated first
+func (s *Store) List(user, status string) ([]Item, error) {
+	items := []Item{}
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(listsBucket).Bucket([]byte(user))
+		if bucket == nil {
+			return nil
+		}
+
+		return bucket.ForEach(func(_, v []byte) error {
+			var item Item
+			if err := json.Unmarshal(v, &item); err != nil {
+				return err
+			}
+			if status == "" || item.Status == status {
+				items = append(items, item)
+			}
+			return nil
+		})
+	})
+
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].UpdatedAt.After(items[j].UpdatedAt)
+	})
+
+	return items, err
+}
+
+// Remove takes slug off the watchlist of user
+func (s *Store) Remove(user, slug string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(listsBucket).Bucket([]byte(user))
+		if bucket == nil || bucket.Get([]byte(slug)) == nil {
+			return ErrNotFound
+		}
+		return bucket.Delete([]byte(slug))
+	})
+}
+
+// SetLatest records episode as the newest of its anime, unless a later
+// one is known already
+func (s *Store) SetLatest(episode anime.LatestEpisode) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(latestBucket)
+
+		if data := bucket.Get([]byte(episode.Slug)); data != nil {
+			var known anime.LatestEpisode
+			if err := json.Unmarshal(data, &known); err == nil && known.Number() > episode.Number() {
+				return nil
+			}
+		}
+
+		data, err := json.Marshal(episode)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(episode.Slug), data)
+	})
+}
+
+// Follow records every release published on broker as the latest episode
+// of its anime, until ctx is cancelled
+func (s *Store) Follow(ctx context.Context, broker *events.Broker) {
+	events.Follow(ctx, broker, func(event events.Event) {
+		if err := s.SetLatest(event.Episode); err != nil {
+			logrus.Errorf("Error saving latest episode of %s: %v", event.Episode.Slug, err)
+		}
+	})
+}
+
+// Latest returns the newest episode known of every anime, by slug
+func (s *Store) Latest() (map[string]anime.LatestEpisode, error) {
+	latest := make(map[string]anime.LatestEpisode)
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(latestBucket).ForEach(func(k, v []byte) error {
+			var episode anime.LatestEpisode
+			if err := json.Unmarshal(v, &episode); err != nil {
+				return err
+			}
+			latest[string(k)] = episode
+			return nil
+		})
+	})
+
+	return latest, err
+}
@@ -0,0 +1,113 @@
+package watchlist
+
+import (
+	"errors"
+	"testing"
+	"yokai/internal/anime"
+	"yokai/internal/storage/storagetest"
+)
+
+func TestPut(t *testing.T) {
+	store := storagetest.NewStore(t, NewStore)
+	details := anime.Anime{Slug: "one-piece", Title: "One Piece"}
+
+	item, created, err := store.Put("user:alice", details, StatusPlanning)
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if !created || item.Status != StatusPlanning || item.Title != "One Piece" {
+		t.Errorf("Put = %+v, %v, want a new planning item", item, created)
+	}
+
+	item, created, err = store.Put("user:alice", anime.Anime{Slug: "one-piece"}, StatusWatching)
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if created {
+		t.Error("Put of an anime already listed reported it as created")
+	}
+	if item.Status != StatusWatching || item.Title != "One Piece" {
+		t.Errorf("Put = %+v, want the details kept and the status changed", item)
+	}
+
+	if _, _, err := store.Put("user:alice", details, "binging"); !errors.Is(err, ErrInvalidStatus) {
+		t.Errorf("Put with an invalid status: got %v, want ErrInvalidStatus", err)
+	}
+}
+
+func TestListFiltersByStatus(t *testing.T) {
+	store := storagetest.NewStore(t, NewStore)
+	for slug, status := range map[string]string{
+		"one-piece": StatusWatching,
+		"naruto":    StatusCompleted,
+		"bleach":    StatusWatching,
+	} {
+		if _, _, err := store.Put("user:alice", anime.Anime{Slug: slug}, status); err != nil {
+			t.Fatalf("Put %s: %v", slug, err)
+		}
+	}
+
+	tests := []struct {
+		status string
+		want   int
+	}{
+		{"", 3},
+		{StatusWatching, 2},
+		{StatusCompleted, 1},
+		{StatusDropped, 0},
+	}
+
+	for _, tt := range tests {
+		items, err := store.List("user:alice", tt.status)
+		if err != nil {
+			t.Fatalf("List %q: %v", tt.status, err)
+		}
+		if len(items) != tt.want {
+			t.Errorf("List %q returned %d items, want %d", tt.status, len(items), tt.want)
+		}
+		for _, item := range items {
+			if tt.status != "" && item.Status != tt.status {
+				t.Errorf("List %q returned %s with status %q", tt.status, item.Slug, item.Status)
+			}
+		}
+	}
+}
+
+func TestListsArePerUser(t *testing.T) {
+	store := storagetest.NewStore(t, NewStore)
+	if _, _, err := store.Put("user:alice", anime.Anime{Slug: "one-piece"}, StatusWatching); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	items, err := store.List("user:bob", "")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(items) != 0 {
+		t.Errorf("bob sees %d items of alice", len(items))
+	}
+	if _, err := store.Get("user:bob", "one-piece"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get of another user's item: got %v, want ErrNotFound", err)
+	}
+	if err := store.Remove("user:bob", "one-piece"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Remove of another user's item: got %v, want ErrNotFound", err)
+	}
+}
+
+func TestSetLatestKeepsNewest(t *testing.T) {
+	store := storagetest.NewStore(t, NewStore)
+
+	for _, episode := range []string{"1100", "1102", "1101"} {
+		if err := store.SetLatest(anime.LatestEpisode{Slug: "one-piece", Episode: episode}); err != nil {
+			t.Fatalf("SetLatest %s: %v", episode, err)
+		}
+	}
+
+	latest, err := store.Latest()
+	if err != nil {
+		t.Fatalf("Latest: %v", err)
+	}
+	if got := latest["one-piece"].Episode; got != "1102" {
+		t.Errorf("latest episode is %s, want 1102", got)
+	}
+}
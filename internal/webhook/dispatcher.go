@@ -0,0 +1,165 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+	"yokai/internal/anime"
+	"yokai/internal/events"
+	"yokai/internal/netguard"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Headers sent with every delivery
+const (
+	HeaderEvent     = "X-Okarun-Event"
+	HeaderDelivery  = "X-Okarun-Delivery"
+	HeaderSignature = "X-Okarun-Signature"
+)
+
+// EventEpisodeReleased is the event name of new episode payloads
+const EventEpisodeReleased = "episode.released"
+
+// Payload is the JSON body POSTed to subscribers
+type Payload struct {
+	Event   string              `json:"event"`
+	EventID uint64              `json:"event_id"`
+	Time    time.Time           `json:"time"`
+	Episode anime.LatestEpisode `json:"episode"`
+}
+
+// Dispatcher delivers release events to the matching subscriptions
+type Dispatcher struct {
+	store       *Store
+	client      *http.Client
+	maxAttempts int
+	backoff     time.Duration
+}
+
+// NewDispatcher creates a dispatcher retrying failed deliveries up to
+// maxAttempts times, doubling the wait from backoff after every attempt
+func NewDispatcher(store *Store, maxAttempts int, backoff time.Duration) *Dispatcher {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	return &Dispatcher{
+		store: store,
+		// Targets are checked when subscribing, but may resolve elsewhere later
+		client:      &http.Client{Timeout: 10 * time.Second, Transport: netguard.Transport()},
+		maxAttempts: maxAttempts,
+		backoff:     backoff,
+	}
+}
+
+// Run delivers every event published on the broker until ctx is cancelled
+func (d *Dispatcher) Run(ctx context.Context, broker *events.Broker) {
+	events.Follow(ctx, broker, func(event events.Event) {
+		d.dispatch(ctx, event)
+	})
+}
+
+func (d *Dispatcher) dispatch(ctx context.Context, event events.Event) {
+	for _, sub := range d.store.List() {
+		if sub.Matches(event.Episode.Slug) {
+			go d.deliver(ctx, sub, event)
+		}
+	}
+}
+
+// deliver POSTs the event to a subscription, retrying with exponential backoff
+func (d *Dispatcher) deliver(ctx context.Context, sub Subscription, event events.Event) {
+	body, err := json.Marshal(Payload{
+		Event:   EventEpisodeReleased,
+		EventID: event.ID,
+		Time:    event.Time,
+		Episode: event.Episode,
+	})
+	if err != nil {
+		logrus.Errorf("Error encoding webhook payload: %v", err)
+		return
+	}
+
+	deliveryID := randomHex(8)
+	wait := d.backoff
+
+	for attempt := 1; attempt <= d.maxAttempts; attempt++ {
+		delivery := d.attempt(ctx, sub, body, deliveryID)
+		delivery.EventID = event.ID
+		delivery.Attempt = attempt
+
+		if err := d.store.Record(delivery); err != nil {
+			logrus.Errorf("Error recording webhook delivery: %v", err)
+		}
+
+		if delivery.Success {
+			return
+		}
+
+		logrus.Warnf("Webhook delivery %s to subscription %s failed (attempt %d/%d): %s",
+			deliveryID, sub.ID, attempt, d.maxAttempts, delivery.Error)
+
+		if attempt == d.maxAttempts {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
+
+func (d *Dispatcher) attempt(ctx context.Context, sub Subscription, body []byte, deliveryID string) Delivery {
+	delivery := Delivery{
+		ID:             deliveryID,
+		SubscriptionID: sub.ID,
+		Time:           time.Now().UTC(),
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "okarun-webhook")
+	req.Header.Set(HeaderEvent, EventEpisodeReleased)
+	req.Header.Set(HeaderDelivery, deliveryID)
+	req.Header.Set(HeaderSignature, Sign(sub.Secret, body))
+
+	start := time.Now()
+	resp, err := d.client.Do(req)
+	delivery.DurationMs = time.Since(start).Milliseconds()
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	delivery.StatusCode = resp.StatusCode
+	delivery.Success = resp.StatusCode >= 200 && resp.StatusCode < 300
+	if !delivery.Success {
+		delivery.Error = fmt.Sprintf("unexpected status %s", resp.Status)
+	}
+
+	return delivery
+}
+
+// Sign returns the signature header value of a payload, an HMAC-SHA256 of
+// the raw body keyed with the subscription secret
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,153 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+	"yokai/internal/anime"
+	"yokai/internal/events"
+)
+
+func TestSign(t *testing.T) {
+	got := Sign("topsecret", []byte(`{"event":"episode.released"}`))
+	want := "sha256=5d8892f73895ac0d917d1214b6cce13a5a6d4026b9b8971499ceb2427e506d12"
+	if got != want {
+		t.Errorf("Sign = %s, want %s", got, want)
+	}
+}
+
+// target is a subscriber answering the statuses in turn, the last one for
+// every delivery after them
+type target struct {
+	t        *testing.T
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (tg *target) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		tg.t.Errorf("reading delivery: %v", err)
+	}
+
+	tg.mu.Lock()
+	defer tg.mu.Unlock()
+
+	status := tg.statuses[min(len(tg.requests), len(tg.statuses)-1)]
+	tg.requests = append(tg.requests, r)
+	tg.bodies = append(tg.bodies, body)
+	w.WriteHeader(status)
+}
+
+// setup creates a dispatcher delivering to a test server, without the
+// public address check that would refuse it
+func setup(t *testing.T, maxAttempts int, statuses ...int) (*Dispatcher, Subscription, *target) {
+	t.Helper()
+
+	tg := &target{t: t, statuses: statuses}
+	srv := httptest.NewServer(tg)
+	t.Cleanup(srv.Close)
+
+	store, err := NewStore(filepath.Join(t.TempDir(), "webhooks.json"))
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	sub, err := store.Create("ops", srv.URL, nil)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	d := NewDispatcher(store, maxAttempts, 0)
+	d.client = srv.Client()
+	return d, sub, tg
+}
+
+func release() events.Event {
+	return events.Event{
+		ID:      7,
+		Type:    events.EventNewEpisode,
+		Time:    time.Now().UTC(),
+		Episode: anime.LatestEpisode{Slug: "dandadan", Title: "Dandadan", Episode: "3"},
+	}
+}
+
+func TestDeliverRetries(t *testing.T) {
+	d, sub, tg := setup(t, 3, http.StatusInternalServerError, http.StatusBadGateway, http.StatusNoContent)
+
+	d.deliver(context.Background(), sub, release())
+
+	if len(tg.requests) != 3 {
+		t.Fatalf("got %d attempts, want 3", len(tg.requests))
+	}
+	for i, r := range tg.requests {
+		if got := r.Header.Get(HeaderSignature); got != Sign(sub.Secret, tg.bodies[i]) {
+			t.Errorf("attempt %d signed %s", i+1, got)
+		}
+		if r.Header.Get(HeaderDelivery) != tg.requests[0].Header.Get(HeaderDelivery) {
+			t.Errorf("attempt %d has another delivery ID", i+1)
+		}
+	}
+
+	var payload Payload
+	if err := json.Unmarshal(tg.bodies[0], &payload); err != nil {
+		t.Fatalf("decoding payload: %v", err)
+	}
+	if payload.Event != EventEpisodeReleased || payload.EventID != 7 || payload.Episode.Slug != "dandadan" {
+		t.Errorf("payload = %+v", payload)
+	}
+
+	deliveries, _ := d.store.Deliveries(sub.ID)
+	if len(deliveries) != 3 {
+		t.Fatalf("logged %d deliveries, want 3", len(deliveries))
+	}
+	if latest := deliveries[0]; !latest.Success || latest.Attempt != 3 || latest.StatusCode != http.StatusNoContent {
+		t.Errorf("latest delivery = %+v, want the successful third attempt", latest)
+	}
+	if first := deliveries[2]; first.Success || first.StatusCode != http.StatusInternalServerError || first.Error == "" {
+		t.Errorf("first delivery = %+v, want a failure", first)
+	}
+}
+
+func TestDeliverGivesUp(t *testing.T) {
+	d, sub, tg := setup(t, 2, http.StatusInternalServerError)
+
+	d.deliver(context.Background(), sub, release())
+
+	if len(tg.requests) != 2 {
+		t.Errorf("got %d attempts, want 2", len(tg.requests))
+	}
+}
+
+func TestDeliveryLogIsCapped(t *testing.T) {
+	d, sub, _ := setup(t, maxDeliveries+5, http.StatusInternalServerError)
+
+	d.deliver(context.Background(), sub, release())
+
+	deliveries, _ := d.store.Deliveries(sub.ID)
+	if len(deliveries) != maxDeliveries {
+		t.Fatalf("logged %d deliveries, want %d", len(deliveries), maxDeliveries)
+	}
+	if newest, oldest := deliveries[0].Attempt, deliveries[maxDeliveries-1].Attempt; newest != maxDeliveries+5 || oldest != 6 {
+		t.Errorf("kept attempts %d to %d, want 6 to %d", oldest, newest, maxDeliveries+5)
+	}
+}
+
+func TestDispatcherRefusesPrivateTargets(t *testing.T) {
+	d, sub, tg := setup(t, 1, http.StatusNoContent)
+	d.client = NewDispatcher(d.store, 1, 0).client
+
+	d.deliver(context.Background(), sub, release())
+
+	deliveries, _ := d.store.Deliveries(sub.ID)
+	if len(tg.requests) != 0 || len(deliveries) != 1 || deliveries[0].Success {
+		t.Errorf("delivered to a loopback target: %+v", deliveries)
+	}
+}
@@ -0,0 +1,230 @@
+package webhook
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned for unknown subscriptions
+var ErrNotFound = errors.New("webhook subscription not found")
+
+// maxDeliveries is how many delivery attempts are kept per subscription
+const maxDeliveries = 50
+
+// Subscription is a target URL notified about new episodes
+type Subscription struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Slugs     []string  `json:"slugs,omitempty"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	// Owner is the client that created the subscription, only it may see it
+	Owner string `json:"owner"`
+}
+
+// Matches reports whether the subscription wants events for slug
+func (s Subscription) Matches(slug string) bool {
+	if len(s.Slugs) == 0 {
+		return true
+	}
+	for _, candidate := range s.Slugs {
+		if candidate == slug {
+			return true
+		}
+	}
+	return false
+}
+
+// Redacted returns the subscription without its signing secret
+func (s Subscription) Redacted() Subscription {
+	s.Secret = ""
+	return s
+}
+
+// Delivery is one attempt to deliver an event to a subscription
+type Delivery struct {
+	ID             string    `json:"id"`
+	SubscriptionID string    `json:"subscription_id"`
+	EventID        uint64    `json:"event_id"`
+	Attempt        int       `json:"attempt"`
+	StatusCode     int       `json:"status_code,omitempty"`
+	Error          string    `json:"error,omitempty"`
+	Success        bool      `json:"success"`
+	DurationMs     int64     `json:"duration_ms"`
+	Time           time.Time `json:"time"`
+}
+
+// Store persists subscriptions and their recent deliveries in a JSON file
+type Store struct {
+	mu            sync.Mutex
+	path          string
+	subscriptions map[string]Subscription
+	deliveries    map[string][]Delivery
+}
+
+type storeFile struct {
+	Subscriptions []Subscription        `json:"subscriptions"`
+	Deliveries    map[string][]Delivery `json:"deliveries"`
+}
+
+// NewStore loads the store persisted at path, if any
+func NewStore(path string) (*Store, error) {
+	s := &Store{
+		path:          path,
+		subscriptions: make(map[string]Subscription),
+		deliveries:    make(map[string][]Delivery),
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var file storeFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+
+	for _, sub := range file.Subscriptions {
+		s.subscriptions[sub.ID] = sub
+	}
+	for id, deliveries := range file.Deliveries {
+		s.deliveries[id] = deliveries
+	}
+
+	return s, nil
+}
+
+// Create registers a new subscription of owner with a generated ID and secret
+func (s *Store) Create(owner, url string, slugs []string) (Subscription, error) {
+	sub := Subscription{
+		ID:        randomHex(8),
+		Owner:     owner,
+		URL:       url,
+		Slugs:     slugs,
+		Secret:    randomHex(32),
+		CreatedAt: time.Now().UTC(),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.subscriptions[sub.ID] = sub
+	return sub, s.save()
+}
+
+// Get returns a subscription by ID
+func (s *Store) Get(id string) (Subscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sub, ok := s.subscriptions[id]
+	if !ok {
+		return Subscription{}, ErrNotFound
+	}
+	return sub, nil
+}
+
+// List returns every subscription, oldest first
+func (s *Store) List() []Subscription {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	subs := make([]Subscription, 0, len(s.subscriptions))
+	for _, sub := range s.subscriptions {
+		subs = append(subs, sub)
+	}
+	sort.Slice(subs, func(i, j int) bool {
+		return subs[i].CreatedAt.Before(subs[j].CreatedAt)
+	})
+	return subs
+}
+
+// Delete removes a subscription and its delivery log
+func (s *Store) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.subscriptions[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.subscriptions, id)
+	delete(s.deliveries, id)
+	return s.save()
+}
+
+// Deliveries returns the delivery log of a subscription, newest first
+func (s *Store) Deliveries(id string) ([]Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.subscriptions[id]; !ok {
+		return nil, ErrNotFound
+	}
+
+	log := s.deliveries[id]
+	deliveries := make([]Delivery, len(log))
+	for i, delivery := range log {
+		deliveries[len(log)-1-i] = delivery
+	}
+	return deliveries, nil
+}
+
+// Record appends a delivery attempt to the log of its subscription
+func (s *Store) Record(delivery Delivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// The subscription may have been deleted while the delivery was retrying
+	if _, ok := s.subscriptions[delivery.SubscriptionID]; !ok {
+		return nil
+	}
+
+	log := append(s.deliveries[delivery.SubscriptionID], delivery)
+	if len(log) > maxDeliveries {
+		log = log[len(log)-maxDeliveries:]
+	}
+	s.deliveries[delivery.SubscriptionID] = log
+	return s.save()
+}
+
+func (s *Store) save() error {
+	file := storeFile{
+		Subscriptions: make([]Subscription, 0, len(s.subscriptions)),
+		Deliveries:    s.deliveries,
+	}
+	for _, sub := range s.subscriptions {
+		file.Subscriptions = append(file.Subscriptions, sub)
+	}
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+func randomHex(n int) string {
+	buf := make([]byte, n)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}